@@ -0,0 +1,133 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	promapi "github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// StepAnalysis evaluates a PromQL query while the step bakes, see
+// Step.HoldSeconds. The query may use {{namespace}} and {{name}} for the
+// workload.
+type StepAnalysis struct {
+	Query string `json:"query"`
+	// The query result must satisfy "result Operator Threshold".
+	Threshold float64 `json:"threshold"`
+	// Operator is one of <, <=, >, >=, "<=" by default.
+	Operator string `json:"operator,omitempty"`
+	// IntervalSeconds between measurements, 60 by default.
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+	// FailureLimit is the number of failed measurements tolerated.
+	FailureLimit int `json:"failure_limit,omitempty"`
+	// Rollback returns to the previous step's replicas when the analysis
+	// fails, instead of staying at the current step.
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+func (a *StepAnalysis) interval() time.Duration {
+	if a.IntervalSeconds > 0 {
+		return time.Duration(a.IntervalSeconds) * time.Second
+	}
+	return time.Minute
+}
+
+func (a *StepAnalysis) operator() string {
+	if a.Operator == "" {
+		return "<="
+	}
+	return a.Operator
+}
+
+func (a *StepAnalysis) passes(value float64) (bool, error) {
+	switch a.operator() {
+	case "<=":
+		return value <= a.Threshold, nil
+	case "<":
+		return value < a.Threshold, nil
+	case ">":
+		return value > a.Threshold, nil
+	case ">=":
+		return value >= a.Threshold, nil
+	}
+	return false, fmt.Errorf("unknown analysis operator %q", a.Operator)
+}
+
+// analyzeStep measures the analysis of an available step when a measurement
+// is due and fails the step once FailureLimit is exceeded. It returns true
+// when the reconcile should stop here.
+func (r *DeploymentReconciler) analyzeStep(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (bool, reconcile.Result, error) {
+	step := &scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1]
+	analysis := step.Analysis
+	if analysis == nil {
+		return false, reconcile.Result{}, nil
+	}
+	now := r.now()
+	if step.AnalyzedAt != nil && now.Sub(*step.AnalyzedAt) < analysis.interval() {
+		return false, reconcile.Result{}, nil
+	}
+
+	value, err := r.queryPrometheus(ctx, analysis.Query, workload, now)
+	passed := false
+	if err == nil {
+		passed, err = analysis.passes(value)
+	}
+	step.AnalyzedAt = &now
+	if passed {
+		logger.V(2).Info("analysis passed", "value", value, "threshold", analysis.Threshold)
+	} else {
+		step.AnalysisFailures++
+		reason := fmt.Sprintf("analysis failed: %v %s %v does not hold", value, analysis.operator(), analysis.Threshold)
+		if err != nil {
+			reason = fmt.Sprintf("analysis failed: %s", err)
+		}
+		logger.V(2).Info(reason, "failures", step.AnalysisFailures, "failure limit", analysis.FailureLimit)
+		if step.AnalysisFailures > analysis.FailureLimit {
+			if analysis.Rollback && scaleAnnotation.CurrentStepIndex > 1 {
+				scaleAnnotation.CurrentStepIndex--
+				workload.Replicas = scaleAnnotation.StepReplicas(scaleAnnotation.CurrentStepIndex)
+				reason += fmt.Sprintf(", rolled back to step %d", scaleAnnotation.CurrentStepIndex)
+			}
+			return true, reconcile.Result{}, r.failStep(ctx, logger, workload, scaleAnnotation, store, reason)
+		}
+	}
+	return true, reconcile.Result{RequeueAfter: r.requeue.base()}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+}
+
+// queryPrometheus evaluates query for workload at now.
+func (r *DeploymentReconciler) queryPrometheus(ctx context.Context, query string, workload *Workload, now time.Time) (float64, error) {
+	if r.prometheusAddress == "" {
+		return 0, fmt.Errorf("no prometheus address configured")
+	}
+	client, err := promapi.NewClient(promapi.Config{Address: r.prometheusAddress})
+	if err != nil {
+		return 0, err
+	}
+	query = strings.NewReplacer(
+		"{{namespace}}", workload.Object.GetNamespace(),
+		"{{name}}", workload.Object.GetName(),
+	).Replace(query)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	result, _, err := promv1.NewAPI(client).Query(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	switch value := result.(type) {
+	case *model.Scalar:
+		return float64(value.Value), nil
+	case model.Vector:
+		if len(value) == 0 {
+			return 0, fmt.Errorf("query %q returned no data", query)
+		}
+		return float64(value[0].Value), nil
+	}
+	return 0, fmt.Errorf("query %q returned unsupported %s", query, result.Type())
+}
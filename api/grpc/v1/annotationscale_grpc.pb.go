@@ -0,0 +1,402 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v3.21.12
+// source: api/grpc/v1/annotationscale.proto
+
+package annotationscalev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	PlanService_ApplyPlan_FullMethodName     = "/annotationscale.v1.PlanService/ApplyPlan"
+	PlanService_GetPlanStatus_FullMethodName = "/annotationscale.v1.PlanService/GetPlanStatus"
+	PlanService_PausePlan_FullMethodName     = "/annotationscale.v1.PlanService/PausePlan"
+	PlanService_ResumePlan_FullMethodName    = "/annotationscale.v1.PlanService/ResumePlan"
+	PlanService_AbortPlan_FullMethodName     = "/annotationscale.v1.PlanService/AbortPlan"
+	PlanService_SkipStep_FullMethodName      = "/annotationscale.v1.PlanService/SkipStep"
+	PlanService_RetryStep_FullMethodName     = "/annotationscale.v1.PlanService/RetryStep"
+	PlanService_WatchPlan_FullMethodName     = "/annotationscale.v1.PlanService/WatchPlan"
+)
+
+// PlanServiceClient is the client API for PlanService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PlanServiceClient interface {
+	// ApplyPlan starts a plan from its first step, replacing any plan in flight.
+	ApplyPlan(ctx context.Context, in *ApplyPlanRequest, opts ...grpc.CallOption) (*PlanStatus, error)
+	GetPlanStatus(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error)
+	PausePlan(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error)
+	ResumePlan(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error)
+	AbortPlan(ctx context.Context, in *AbortPlanRequest, opts ...grpc.CallOption) (*PlanStatus, error)
+	SkipStep(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error)
+	RetryStep(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error)
+	// WatchPlan streams an event for the current step and for every step
+	// transition after it, until the client cancels.
+	WatchPlan(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (PlanService_WatchPlanClient, error)
+}
+
+type planServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPlanServiceClient(cc grpc.ClientConnInterface) PlanServiceClient {
+	return &planServiceClient{cc}
+}
+
+func (c *planServiceClient) ApplyPlan(ctx context.Context, in *ApplyPlanRequest, opts ...grpc.CallOption) (*PlanStatus, error) {
+	out := new(PlanStatus)
+	err := c.cc.Invoke(ctx, PlanService_ApplyPlan_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planServiceClient) GetPlanStatus(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error) {
+	out := new(PlanStatus)
+	err := c.cc.Invoke(ctx, PlanService_GetPlanStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planServiceClient) PausePlan(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error) {
+	out := new(PlanStatus)
+	err := c.cc.Invoke(ctx, PlanService_PausePlan_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planServiceClient) ResumePlan(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error) {
+	out := new(PlanStatus)
+	err := c.cc.Invoke(ctx, PlanService_ResumePlan_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planServiceClient) AbortPlan(ctx context.Context, in *AbortPlanRequest, opts ...grpc.CallOption) (*PlanStatus, error) {
+	out := new(PlanStatus)
+	err := c.cc.Invoke(ctx, PlanService_AbortPlan_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planServiceClient) SkipStep(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error) {
+	out := new(PlanStatus)
+	err := c.cc.Invoke(ctx, PlanService_SkipStep_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planServiceClient) RetryStep(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (*PlanStatus, error) {
+	out := new(PlanStatus)
+	err := c.cc.Invoke(ctx, PlanService_RetryStep_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *planServiceClient) WatchPlan(ctx context.Context, in *PlanRef, opts ...grpc.CallOption) (PlanService_WatchPlanClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PlanService_ServiceDesc.Streams[0], PlanService_WatchPlan_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &planServiceWatchPlanClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PlanService_WatchPlanClient interface {
+	Recv() (*PlanEvent, error)
+	grpc.ClientStream
+}
+
+type planServiceWatchPlanClient struct {
+	grpc.ClientStream
+}
+
+func (x *planServiceWatchPlanClient) Recv() (*PlanEvent, error) {
+	m := new(PlanEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PlanServiceServer is the server API for PlanService service.
+// All implementations must embed UnimplementedPlanServiceServer
+// for forward compatibility
+type PlanServiceServer interface {
+	// ApplyPlan starts a plan from its first step, replacing any plan in flight.
+	ApplyPlan(context.Context, *ApplyPlanRequest) (*PlanStatus, error)
+	GetPlanStatus(context.Context, *PlanRef) (*PlanStatus, error)
+	PausePlan(context.Context, *PlanRef) (*PlanStatus, error)
+	ResumePlan(context.Context, *PlanRef) (*PlanStatus, error)
+	AbortPlan(context.Context, *AbortPlanRequest) (*PlanStatus, error)
+	SkipStep(context.Context, *PlanRef) (*PlanStatus, error)
+	RetryStep(context.Context, *PlanRef) (*PlanStatus, error)
+	// WatchPlan streams an event for the current step and for every step
+	// transition after it, until the client cancels.
+	WatchPlan(*PlanRef, PlanService_WatchPlanServer) error
+	mustEmbedUnimplementedPlanServiceServer()
+}
+
+// UnimplementedPlanServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedPlanServiceServer struct {
+}
+
+func (UnimplementedPlanServiceServer) ApplyPlan(context.Context, *ApplyPlanRequest) (*PlanStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApplyPlan not implemented")
+}
+func (UnimplementedPlanServiceServer) GetPlanStatus(context.Context, *PlanRef) (*PlanStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPlanStatus not implemented")
+}
+func (UnimplementedPlanServiceServer) PausePlan(context.Context, *PlanRef) (*PlanStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PausePlan not implemented")
+}
+func (UnimplementedPlanServiceServer) ResumePlan(context.Context, *PlanRef) (*PlanStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumePlan not implemented")
+}
+func (UnimplementedPlanServiceServer) AbortPlan(context.Context, *AbortPlanRequest) (*PlanStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AbortPlan not implemented")
+}
+func (UnimplementedPlanServiceServer) SkipStep(context.Context, *PlanRef) (*PlanStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SkipStep not implemented")
+}
+func (UnimplementedPlanServiceServer) RetryStep(context.Context, *PlanRef) (*PlanStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RetryStep not implemented")
+}
+func (UnimplementedPlanServiceServer) WatchPlan(*PlanRef, PlanService_WatchPlanServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchPlan not implemented")
+}
+func (UnimplementedPlanServiceServer) mustEmbedUnimplementedPlanServiceServer() {}
+
+// UnsafePlanServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PlanServiceServer will
+// result in compilation errors.
+type UnsafePlanServiceServer interface {
+	mustEmbedUnimplementedPlanServiceServer()
+}
+
+func RegisterPlanServiceServer(s grpc.ServiceRegistrar, srv PlanServiceServer) {
+	s.RegisterService(&PlanService_ServiceDesc, srv)
+}
+
+func _PlanService_ApplyPlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApplyPlanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanServiceServer).ApplyPlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlanService_ApplyPlan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanServiceServer).ApplyPlan(ctx, req.(*ApplyPlanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanService_GetPlanStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlanRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanServiceServer).GetPlanStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlanService_GetPlanStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanServiceServer).GetPlanStatus(ctx, req.(*PlanRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanService_PausePlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlanRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanServiceServer).PausePlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlanService_PausePlan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanServiceServer).PausePlan(ctx, req.(*PlanRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanService_ResumePlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlanRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanServiceServer).ResumePlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlanService_ResumePlan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanServiceServer).ResumePlan(ctx, req.(*PlanRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanService_AbortPlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AbortPlanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanServiceServer).AbortPlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlanService_AbortPlan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanServiceServer).AbortPlan(ctx, req.(*AbortPlanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanService_SkipStep_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlanRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanServiceServer).SkipStep(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlanService_SkipStep_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanServiceServer).SkipStep(ctx, req.(*PlanRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanService_RetryStep_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PlanRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PlanServiceServer).RetryStep(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PlanService_RetryStep_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PlanServiceServer).RetryStep(ctx, req.(*PlanRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PlanService_WatchPlan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PlanRef)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PlanServiceServer).WatchPlan(m, &planServiceWatchPlanServer{stream})
+}
+
+type PlanService_WatchPlanServer interface {
+	Send(*PlanEvent) error
+	grpc.ServerStream
+}
+
+type planServiceWatchPlanServer struct {
+	grpc.ServerStream
+}
+
+func (x *planServiceWatchPlanServer) Send(m *PlanEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// PlanService_ServiceDesc is the grpc.ServiceDesc for PlanService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PlanService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "annotationscale.v1.PlanService",
+	HandlerType: (*PlanServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ApplyPlan",
+			Handler:    _PlanService_ApplyPlan_Handler,
+		},
+		{
+			MethodName: "GetPlanStatus",
+			Handler:    _PlanService_GetPlanStatus_Handler,
+		},
+		{
+			MethodName: "PausePlan",
+			Handler:    _PlanService_PausePlan_Handler,
+		},
+		{
+			MethodName: "ResumePlan",
+			Handler:    _PlanService_ResumePlan_Handler,
+		},
+		{
+			MethodName: "AbortPlan",
+			Handler:    _PlanService_AbortPlan_Handler,
+		},
+		{
+			MethodName: "SkipStep",
+			Handler:    _PlanService_SkipStep_Handler,
+		},
+		{
+			MethodName: "RetryStep",
+			Handler:    _PlanService_RetryStep_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPlan",
+			Handler:       _PlanService_WatchPlan_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/grpc/v1/annotationscale.proto",
+}
@@ -0,0 +1,18 @@
+// Package v1alpha1 contains the ScalePlan API, an alternative to driving
+// plans through annotations.
+// +kubebuilder:object:generate=true
+// +groupName=annotationscale.arcosx.io
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	GroupVersion = schema.GroupVersion{Group: "annotationscale.arcosx.io", Version: "v1alpha1"}
+
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	AddToScheme = SchemeBuilder.AddToScheme
+)
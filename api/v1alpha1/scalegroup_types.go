@@ -0,0 +1,74 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type GroupMember struct {
+	// Name of a Deployment in the group's namespace.
+	Name string `json:"name"`
+	// Percent of each step's replicas the member runs, 100 by default.
+	// +kubebuilder:validation:Minimum=0
+	Percent int32 `json:"percent,omitempty"`
+	// DependsOn are members that must be available at a step before this one
+	// is scaled up to it. Steps scaling down go in the reverse order.
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Reciprocal members run totalReplicas minus the step's replicas, and
+	// none at the last step, e.g. the "blue" side of a blue/green rollout.
+	Reciprocal bool `json:"reciprocal,omitempty"`
+}
+
+type GroupStep struct {
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+	// MaxWaitAvailableSeconds overrides the group-level value for this step.
+	// +kubebuilder:validation:Minimum=0
+	MaxWaitAvailableSeconds int `json:"maxWaitAvailableSeconds,omitempty"`
+}
+
+type ScaleGroupSpec struct {
+	// +kubebuilder:validation:MinItems=1
+	Members []GroupMember `json:"members"`
+	// +kubebuilder:validation:MinItems=1
+	Steps []GroupStep `json:"steps"`
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=600
+	MaxWaitAvailableSeconds int `json:"maxWaitAvailableSeconds,omitempty"`
+	// TotalReplicas is what reciprocal members are the complement of.
+	// +kubebuilder:validation:Minimum=0
+	TotalReplicas int32 `json:"totalReplicas,omitempty"`
+}
+
+type ScaleGroupStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	CurrentStepIndex   int                `json:"currentStepIndex,omitempty"`
+	CurrentStepState   string             `json:"currentStepState,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	LastUpdateTime     metav1.Time        `json:"lastUpdateTime,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ScaleGroup scales several Deployments in lockstep, a step completes once
+// every member is available at its share of the step's replicas.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Step",type=integer,JSONPath=`.status.currentStepIndex`
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.currentStepState`
+type ScaleGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScaleGroupSpec   `json:"spec,omitempty"`
+	Status ScaleGroupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+type ScaleGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScaleGroup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ScaleGroup{}, &ScaleGroupList{})
+}
@@ -0,0 +1,201 @@
+package v1alpha1
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type TargetReference struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Name       string `json:"name"`
+}
+
+type Step struct {
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas,omitempty"`
+	// Percent of spec.targetReplicas, used instead of replicas when set.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Percent int32 `json:"percent,omitempty"`
+	Pause   bool  `json:"pause,omitempty"`
+	// MaxWaitAvailableSeconds overrides the plan-level value for this step.
+	// +kubebuilder:validation:Minimum=0
+	MaxWaitAvailableSeconds int `json:"maxWaitAvailableSeconds,omitempty"`
+	// HoldSeconds is how long the step must stay available before the plan
+	// moves on.
+	// +kubebuilder:validation:Minimum=0
+	HoldSeconds int `json:"holdSeconds,omitempty"`
+	// Webhook must accept the step before the plan moves on.
+	Webhook *StepWebhook `json:"webhook,omitempty"`
+	// Job must succeed before the step is done.
+	Job *StepJob `json:"job,omitempty"`
+	// Analysis is evaluated while the step holds.
+	Analysis *StepAnalysis `json:"analysis,omitempty"`
+	// Probe must pass before an available step is done.
+	Probe *StepProbe `json:"probe,omitempty"`
+	// Drain drains the pods this step scales away before it is entered.
+	Drain *StepDrain `json:"drain,omitempty"`
+}
+
+type StepDrain struct {
+	Path string `json:"path,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=65535
+	Port int `json:"port,omitempty"`
+	// TimeoutSeconds defaults to 30.
+	// +kubebuilder:validation:Minimum=0
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+type StepAnalysis struct {
+	Query string `json:"query"`
+	// Threshold is a decimal, e.g. "0.01".
+	Threshold string `json:"threshold"`
+	// +kubebuilder:validation:Enum="<";"<=";">";">="
+	Operator string `json:"operator,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	FailureLimit int  `json:"failureLimit,omitempty"`
+	Rollback     bool `json:"rollback,omitempty"`
+}
+
+type StepJob struct {
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	Template batchv1.JobTemplateSpec `json:"template"`
+}
+
+type StepProbe struct {
+	Path string `json:"path,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int `json:"port"`
+	// +kubebuilder:validation:Enum=http;https
+	Scheme string `json:"scheme,omitempty"`
+	// Service probes the Service instead of every pod.
+	Service string `json:"service,omitempty"`
+	// ExpectedStatus accepts only this status code instead of any 2xx.
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	PeriodSeconds int `json:"periodSeconds,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+type StepWebhook struct {
+	URL string `json:"url"`
+	// Method defaults to POST.
+	// +kubebuilder:validation:Enum=GET;POST;PUT
+	Method string `json:"method,omitempty"`
+	// TimeoutSeconds defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// ExpectedStatus accepts only this status code instead of any 2xx.
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+}
+
+type ScalePlanSpec struct {
+	TargetRef TargetReference `json:"targetRef"`
+	// TargetReplicas is the replica count percentage steps are relative to.
+	// +kubebuilder:validation:Minimum=0
+	TargetReplicas int32 `json:"targetReplicas,omitempty"`
+	// Direction, when Up or Down, requires the steps to only scale that way.
+	// +kubebuilder:validation:Enum=Up;Down;Any
+	Direction string `json:"direction,omitempty"`
+	// +kubebuilder:validation:MinItems=1
+	Steps []Step `json:"steps"`
+	// +kubebuilder:validation:Minimum=0
+	MaxUnavailableReplicas int `json:"maxUnavailableReplicas,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=600
+	MaxWaitAvailableSeconds int `json:"maxWaitAvailableSeconds,omitempty"`
+	// Service must list the target's pods as ready endpoints before a step
+	// is done.
+	Service string `json:"service,omitempty"`
+	// Completion is applied once the plan completed.
+	Completion *CompletionPolicy `json:"completion,omitempty"`
+}
+
+type CompletionPolicy struct {
+	HPA *HPAHandoff `json:"hpa,omitempty"`
+}
+
+type HPAHandoff struct {
+	// Name of the HPA, the target's name by default.
+	Name string `json:"name,omitempty"`
+	// MinReplicas defaults to the replicas of the last step.
+	// +kubebuilder:validation:Minimum=0
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+	// +kubebuilder:validation:Minimum=0
+	TargetCPUUtilizationPercentage int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+}
+
+// StepStatus records when the step with the same index was entered and when
+// it reached its replicas.
+type StepStatus struct {
+	StartedAt        *metav1.Time `json:"startedAt,omitempty"`
+	FinishedAt       *metav1.Time `json:"finishedAt,omitempty"`
+	AnalyzedAt       *metav1.Time `json:"analyzedAt,omitempty"`
+	AnalysisFailures int          `json:"analysisFailures,omitempty"`
+	ProbeSuccesses   int          `json:"probeSuccesses,omitempty"`
+	DrainStartedAt   *metav1.Time `json:"drainStartedAt,omitempty"`
+}
+
+// TransitionRecord is a change of the step or state of the plan.
+type TransitionRecord struct {
+	FromStep  int         `json:"fromStep,omitempty"`
+	FromState string      `json:"fromState,omitempty"`
+	ToStep    int         `json:"toStep"`
+	ToState   string      `json:"toState"`
+	Reason    string      `json:"reason,omitempty"`
+	Time      metav1.Time `json:"time,omitempty"`
+	Actor     string      `json:"actor,omitempty"`
+}
+
+type ScalePlanStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	CurrentStepIndex   int                `json:"currentStepIndex,omitempty"`
+	CurrentStepState   string             `json:"currentStepState,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	LastUpdateTime     metav1.Time        `json:"lastUpdateTime,omitempty"`
+	StepAvailableTime  metav1.Time        `json:"stepAvailableTime,omitempty"`
+	Steps              []StepStatus       `json:"steps,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	// HandedOff is set once the completion policy was applied.
+	HandedOff bool `json:"handedOff,omitempty"`
+	// PlanID correlates the logs, Events, metrics and notifications of the
+	// plan, a new one for every generation.
+	PlanID string `json:"planID,omitempty"`
+	// Transitions are the last changes of the step or state, oldest first.
+	Transitions []TransitionRecord `json:"transitions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.targetRef.name`
+// +kubebuilder:printcolumn:name="Step",type=integer,JSONPath=`.status.currentStepIndex`
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.currentStepState`
+type ScalePlan struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ScalePlanSpec   `json:"spec,omitempty"`
+	Status ScalePlanStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+type ScalePlanList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScalePlan `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ScalePlan{}, &ScalePlanList{})
+}
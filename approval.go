@@ -0,0 +1,143 @@
+package annotationscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ApproveStepAnnotationKey approves the pause step of the 1-based index
+	// it holds, e.g. "4".
+	ApproveStepAnnotationKey = "annotationscale.arcosx.io/approve-step"
+	// ApprovedByAnnotationKey is who approved the step. The defaulting
+	// webhook sets it to the user writing ApproveStepAnnotationKey, without
+	// the webhook it is taken as written.
+	ApprovedByAnnotationKey = "annotationscale.arcosx.io/approved-by"
+)
+
+var (
+	ErrorApprovalRequired error = errors.New("step requires approval")
+	ErrorPlanNotPaused    error = errors.New("plan is not paused")
+)
+
+// approver returns who approved the current step of scaleAnnotation with the
+// annotations, and whether the approval is valid for the step.
+func approver(annotations map[string]string, scaleAnnotation *ScaleAnnotation) (string, bool) {
+	if annotations[ApproveStepAnnotationKey] != strconv.Itoa(scaleAnnotation.CurrentStepIndex) {
+		return "", false
+	}
+	approvedBy := annotations[ApprovedByAnnotationKey]
+	approvers := scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Approvers
+	if len(approvers) == 0 {
+		return approvedBy, true
+	}
+	for _, approver := range approvers {
+		if approver == approvedBy {
+			return approvedBy, true
+		}
+	}
+	return approvedBy, false
+}
+
+// clearApproval removes the approval annotations from obj, so that an
+// approval is used once. They are written by users rather than applied by
+// the controller, so they are removed with a merge patch of the version of
+// obj they were read from.
+func clearApproval(ctx context.Context, c client.Client, obj client.Object) error {
+	annotations := obj.GetAnnotations()
+	_, approveStep := annotations[ApproveStepAnnotationKey]
+	_, approvedBy := annotations[ApprovedByAnnotationKey]
+	if !approveStep && !approvedBy {
+		return nil
+	}
+	patch := client.MergeFromWithOptions(obj.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+	annotations = copyAnnotations(annotations)
+	delete(annotations, ApproveStepAnnotationKey)
+	delete(annotations, ApprovedByAnnotationKey)
+	obj.SetAnnotations(annotations)
+	return c.Patch(ctx, obj, patch)
+}
+
+// approveStep moves a paused plan whose current step was approved to
+// StepReady, using up the approval. Steps with Approvers left StepPaused
+// without their approval are paused again. It returns true when the plan
+// changed.
+func (r *DeploymentReconciler) approveStep(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (bool, error) {
+	index := scaleAnnotation.CurrentStepIndex
+	step := scaleAnnotation.Steps[index-1]
+	if !step.Pause {
+		return false, nil
+	}
+	switch scaleAnnotation.CurrentStepState {
+	case StepStatePaused:
+		if step.FinishedAt == nil {
+			return false, nil
+		}
+		approvedBy, ok := approver(workload.Object.GetAnnotations(), scaleAnnotation)
+		if !ok {
+			if approvedBy != "" {
+				logger.Info("approval refused", "step", index, "approved-by", approvedBy)
+				r.event(workload, corev1.EventTypeWarning, "ApprovalRefused", fmt.Sprintf("%s may not approve step %d", approvedBy, index))
+			}
+			return false, nil
+		}
+		if err := clearApproval(ctx, r.Client, workload.Object); err != nil {
+			logger.Error(err, "failed to clear approval")
+			return true, err
+		}
+		scaleAnnotation.Steps[index-1].ApprovedBy = approvedBy
+		scaleAnnotation.CurrentStepState = StepStateReady
+		scaleAnnotation.Message = fmt.Sprintf("step %d approved", index)
+		if approvedBy != "" {
+			scaleAnnotation.Message += " by " + approvedBy
+		}
+		scaleAnnotation.LastUpdateTime = r.now()
+		workload.Paused = false
+		logger.Info("step approved", "approvedBy", approvedBy)
+		r.event(workload, corev1.EventTypeNormal, "StepApproved", scaleAnnotation.Message)
+		return true, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+
+	case StepStateReady:
+		if len(step.Approvers) == 0 || step.ApprovedBy != "" || step.Skipped {
+			return false, nil
+		}
+		// resumed by hand, the approvers must approve
+		scaleAnnotation.CurrentStepState = StepStatePaused
+		scaleAnnotation.Message = fmt.Sprintf("step %d requires approval by one of %v", index, step.Approvers)
+		scaleAnnotation.LastUpdateTime = r.now()
+		logger.Info("step requires approval", "approvers", step.Approvers)
+		return true, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+	}
+	return false, nil
+}
+
+// ApproveStep approves the current pause step of the Deployment key with
+// ApproveStepAnnotationKey, as the user of c when the defaulting webhook is
+// installed. An earlier ApprovedByAnnotationKey is dropped for the webhook
+// to record the new approver.
+func ApproveStep(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	workload, err := (&deploymentClient{client: c}).Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	scaleAnnotation, err := storeFor(workload).Read(ctx, workload)
+	if err != nil {
+		return err
+	}
+	if scaleAnnotation.CurrentStepState != StepStatePaused {
+		return fmt.Errorf("%w: %s", ErrorPlanNotPaused, scaleAnnotation.CurrentStepState)
+	}
+	patch := client.MergeFrom(workload.Object.DeepCopyObject().(client.Object))
+	annotations := workload.Object.GetAnnotations()
+	annotations[ApproveStepAnnotationKey] = strconv.Itoa(scaleAnnotation.CurrentStepIndex)
+	delete(annotations, ApprovedByAnnotationKey)
+	workload.Object.SetAnnotations(annotations)
+	return c.Patch(ctx, workload.Object, patch)
+}
@@ -0,0 +1,142 @@
+package annotationscale
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// MaxTransitionRecords bounds ScaleAnnotation.Transitions.
+const MaxTransitionRecords = 20
+
+// controllerActor is the actor of the transitions the controller makes.
+const controllerActor = "annotationscale"
+
+// TransitionRecord is a change of the step or state of a plan.
+type TransitionRecord struct {
+	From   StepTransition `json:"from"`
+	To     StepTransition `json:"to"`
+	Reason string         `json:"reason,omitempty"`
+	Time   time.Time      `json:"time"`
+	// Actor is "annotationscale" for the controller, otherwise the user the
+	// defaulting webhook saw make the change, if installed.
+	Actor string `json:"actor,omitempty"`
+}
+
+func (sa *ScaleAnnotation) stepTransition() StepTransition {
+	return StepTransition{Step: sa.CurrentStepIndex, State: sa.CurrentStepState}
+}
+
+// recordTransition records the change of sa from from to its current step
+// and state at LastUpdateTime, dropping the oldest records beyond
+// MaxTransitionRecords. The records are copied, they may be shared with the
+// plan cache.
+func (sa *ScaleAnnotation) recordTransition(from StepTransition, reason, actor string) {
+	records := sa.Transitions
+	if len(records) >= MaxTransitionRecords {
+		records = records[len(records)-MaxTransitionRecords+1:]
+	}
+	sa.Transitions = append(append(make([]TransitionRecord, 0, len(records)+1), records...), TransitionRecord{
+		From:   from,
+		To:     sa.stepTransition(),
+		Reason: reason,
+		Time:   sa.LastUpdateTime,
+		Actor:  actor,
+	})
+}
+
+// auditStore records a transition in every plan written with another step
+// or state than the last one.
+type auditStore struct {
+	StateStore
+	from StepTransition
+	// message is the message of the last plan, a message set since explains
+	// the transition better than reason.
+	message string
+	// reason is the reason of the transition the reconciler took.
+	reason string
+}
+
+func newAuditStore(store StateStore, scaleAnnotation *ScaleAnnotation) *auditStore {
+	return &auditStore{StateStore: store, from: scaleAnnotation.stepTransition(), message: scaleAnnotation.Message}
+}
+
+func (s *auditStore) Write(ctx context.Context, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	if to := scaleAnnotation.stepTransition(); to != s.from {
+		reason := s.reason
+		if scaleAnnotation.Message != "" && scaleAnnotation.Message != s.message {
+			reason = scaleAnnotation.Message
+		}
+		scaleAnnotation.recordTransition(s.from, reason, controllerActor)
+		s.from, s.message = to, scaleAnnotation.Message
+	}
+	return s.StateStore.Write(ctx, workload, scaleAnnotation)
+}
+
+// recordActor attributes the transitions req adds to the plan to the user of
+// req, and records the changes of the step or state req makes without
+// recording them, e.g. by editing the annotations, at now when the plan was
+// not updated.
+func recordActor(req admission.Request, annotations map[string]string, now time.Time) map[string]string {
+	after, err := ReadScaleAnnotation(annotations)
+	if err != nil {
+		return annotations
+	}
+	// created objects and new plans have no transitions yet
+	before := &ScaleAnnotation{}
+	if len(req.OldObject.Raw) > 0 {
+		old := &unstructured.Unstructured{}
+		if err := old.UnmarshalJSON(req.OldObject.Raw); err == nil {
+			if plan, err := ReadScaleAnnotation(old.GetAnnotations()); err == nil {
+				before = plan
+			}
+		}
+	}
+	added, attributed := 0, false
+	for i := range after.Transitions {
+		if containsTransition(before.Transitions, after.Transitions[i]) {
+			continue
+		}
+		added++
+		if after.Transitions[i].Actor == "" {
+			after.Transitions[i].Actor = req.UserInfo.Username
+			attributed = true
+		}
+	}
+	if added == 0 && after.stepTransition() != before.stepTransition() {
+		reason := "plan edited"
+		if len(before.Steps) == 0 {
+			reason = "plan applied"
+		}
+		after.recordTransition(before.stepTransition(), reason, req.UserInfo.Username)
+		if after.LastUpdateTime.Equal(before.LastUpdateTime) {
+			after.Transitions[len(after.Transitions)-1].Time = now
+		}
+		attributed = true
+	}
+	if !attributed {
+		return annotations
+	}
+	var fixed map[string]string
+	if _, ok := annotations[PlanAnnotationKey]; ok {
+		fixed, err = SetScaleAnnotationJSON(copyAnnotations(annotations), after)
+	} else {
+		fixed, err = SetScaleAnnotation(copyAnnotations(annotations), after)
+	}
+	if err != nil {
+		return annotations
+	}
+	return fixed
+}
+
+func containsTransition(records []TransitionRecord, record TransitionRecord) bool {
+	for i := range records {
+		if reflect.DeepEqual(records[i], record) {
+			return true
+		}
+	}
+	return false
+}
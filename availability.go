@@ -0,0 +1,104 @@
+package annotationscale
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AvailabilityCriterion selects the replicas a step waits for.
+type AvailabilityCriterion string
+
+const (
+	// AvailabilityAvailable waits for the available replicas, ready for
+	// minReadySeconds. It is the default.
+	AvailabilityAvailable AvailabilityCriterion = "Available"
+	// AvailabilityReady waits for the ready replicas.
+	AvailabilityReady AvailabilityCriterion = "Ready"
+	// AvailabilityUpdatedAvailable waits for available replicas of the
+	// current pod template, e.g. so that a step is not done by the pods of a
+	// rollout in progress.
+	AvailabilityUpdatedAvailable AvailabilityCriterion = "UpdatedAvailable"
+)
+
+// AvailableReplicasFunc returns how many replicas of workload count as
+// available, e.g. after checking that they serve traffic.
+type AvailableReplicasFunc func(ctx context.Context, workload *Workload) (int32, error)
+
+// PodReadiness counts only the pods passing extra checks as available, e.g.
+// because a service mesh sidecar becomes ready after the application.
+type PodReadiness struct {
+	// Containers must be ready in the pods running them, e.g. "istio-proxy".
+	// Restartable init containers, native sidecars, are checked as well.
+	Containers []string
+	// ReadinessGates requires the conditions of the readiness gates of the
+	// pods to be True.
+	ReadinessGates bool
+}
+
+// ready reports whether pod is ready and passes the checks of p.
+func (p *PodReadiness) ready(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || !podReady(pod) {
+		return false
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, name := range p.Containers {
+		for _, status := range statuses {
+			if status.Name == name && !status.Ready {
+				return false
+			}
+		}
+	}
+	if !p.ReadinessGates {
+		return true
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		if !podCondition(pod, gate.ConditionType) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyAvailability replaces the available replicas of workload by the
+// replicas r counts as available, at most its pods passing r.podReadiness.
+func (r *DeploymentReconciler) applyAvailability(ctx context.Context, workload *Workload) error {
+	status := &workload.Status
+	available := status.AvailableReplicas
+	switch {
+	case r.availableReplicas != nil:
+		var err error
+		if available, err = r.availableReplicas(ctx, workload); err != nil {
+			return err
+		}
+	case r.availability == AvailabilityReady:
+		available = status.ReadyReplicas
+	case r.availability == AvailabilityUpdatedAvailable:
+		if status.UpdatedReplicas < available {
+			available = status.UpdatedReplicas
+		}
+	case r.podReadiness == nil:
+		return nil
+	}
+	if r.podReadiness != nil && workload.Selector != nil && !workload.Selector.Empty() {
+		pods, err := r.listPods(ctx, workload)
+		if err != nil {
+			return err
+		}
+		var ready int32
+		for i := range pods {
+			if r.podReadiness.ready(&pods[i]) {
+				ready++
+			}
+		}
+		if ready < available {
+			available = ready
+		}
+	}
+	status.AvailableReplicas = available
+	status.UnavailableReplicas = 0
+	if status.Replicas > available {
+		status.UnavailableReplicas = status.Replicas - available
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package annotationscale
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const queuedMessage = "queued: too many plans running"
+
+// planBudget bounds how many plans run at once across the manager. A plan
+// takes a slot when it leaves its first step and keeps it until it
+// completes, fails or is aborted, so started ramps are never starved. The
+// slots are rebuilt from the plans seen after a restart.
+type planBudget struct {
+	mu      sync.Mutex
+	max     int
+	running map[types.NamespacedName]bool
+}
+
+func newPlanBudget(max int) *planBudget {
+	if max <= 0 {
+		return nil
+	}
+	return &planBudget{max: max, running: map[types.NamespacedName]bool{}}
+}
+
+// acquire takes a slot for key. It returns false when every slot is taken
+// by other plans.
+func (b *planBudget) acquire(key types.NamespacedName) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running[key] {
+		return true
+	}
+	if len(b.running) >= b.max {
+		return false
+	}
+	b.running[key] = true
+	return true
+}
+
+// observe updates the slot of key from the state of its plan.
+func (b *planBudget) observe(key types.NamespacedName, scaleAnnotation *ScaleAnnotation) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch scaleAnnotation.CurrentStepState {
+	case StepStateUpgrade, StepStatePaused:
+		b.running[key] = true
+	case StepStateReady:
+		if scaleAnnotation.CurrentStepIndex > 1 {
+			b.running[key] = true
+		}
+	default:
+		delete(b.running, key)
+	}
+}
+
+// release frees the slot of key, e.g. when its plan or workload is removed.
+func (b *planBudget) release(key types.NamespacedName) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.running, key)
+}
+
+func (b *planBudget) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return fmt.Sprintf("%d of %d plans running", len(b.running), b.max)
+}
@@ -0,0 +1,180 @@
+package annotationscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PlanBuilder builds a plan step by step, e.g.
+//
+//	NewPlan().To(20).LinearSteps(5).PauseAt(8).MaxUnavailable(1).MaxWait(10*time.Minute).Apply(ctx, c, key)
+//
+// Errors are kept until Build or Apply.
+type PlanBuilder struct {
+	plan   ScaleAnnotation
+	from   *int32
+	to     *int32
+	linear int
+	steps  []int32
+	pauses []int32
+	err    error
+}
+
+// NewPlan starts a plan with the NewScaleAnnotation defaults.
+func NewPlan() *PlanBuilder {
+	return &PlanBuilder{plan: NewScaleAnnotation()}
+}
+
+// From makes replicas the first step of LinearSteps, the current replicas
+// of the workload usually. LinearSteps otherwise count up from 0.
+func (b *PlanBuilder) From(replicas int32) *PlanBuilder {
+	b.from = &replicas
+	return b
+}
+
+// To is the replicas of the last step of LinearSteps.
+func (b *PlanBuilder) To(replicas int32) *PlanBuilder {
+	b.to = &replicas
+	return b
+}
+
+// LinearSteps spreads n steps evenly from From up or down to To, rounded
+// away from From.
+func (b *PlanBuilder) LinearSteps(n int) *PlanBuilder {
+	if n < 1 {
+		b.fail(fmt.Errorf("linear steps %d must be positive", n))
+	}
+	b.linear = n
+	return b
+}
+
+// Steps appends steps with the given replicas.
+func (b *PlanBuilder) Steps(replicas ...int32) *PlanBuilder {
+	b.steps = append(b.steps, replicas...)
+	return b
+}
+
+// PauseAt makes the step with replicas a pause step, adding it when no step
+// has these replicas.
+func (b *PlanBuilder) PauseAt(replicas int32) *PlanBuilder {
+	b.pauses = append(b.pauses, replicas)
+	return b
+}
+
+func (b *PlanBuilder) MaxUnavailable(replicas int) *PlanBuilder {
+	b.plan.MaxUnavailableReplicas = replicas
+	return b
+}
+
+// Direction requires the steps to only scale up or down, see
+// ScaleAnnotation.Direction.
+func (b *PlanBuilder) Direction(direction Direction) *PlanBuilder {
+	b.plan.Direction = direction
+	return b
+}
+
+// MaxWait is how long each step may take to become available, rounded to
+// seconds.
+func (b *PlanBuilder) MaxWait(d time.Duration) *PlanBuilder {
+	b.plan.MaxWaitAvailableSecond = int(d.Round(time.Second) / time.Second)
+	return b
+}
+
+func (b *PlanBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Build returns the plan, ready to be applied from its first step.
+func (b *PlanBuilder) Build() (*ScaleAnnotation, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	replicas := append([]int32(nil), b.steps...)
+	if b.linear > 0 {
+		if b.to == nil {
+			return nil, errors.New("linear steps need To")
+		}
+		replicas = append(replicas, linearSteps(b.from, *b.to, b.linear)...)
+	} else if b.to != nil && (len(replicas) == 0 || replicas[len(replicas)-1] != *b.to) {
+		replicas = append(replicas, *b.to)
+	}
+	if len(replicas) == 0 {
+		return nil, ErrorScaleAnnotationParseSteps
+	}
+
+	plan := b.plan
+	plan.Steps = make([]Step, 0, len(replicas)+len(b.pauses))
+	for _, r := range replicas {
+		plan.Steps = append(plan.Steps, Step{Replicas: r})
+	}
+	for _, pause := range b.pauses {
+		plan.Steps = pauseAt(plan.Steps, pause)
+	}
+	plan.CurrentStepIndex = 1
+	plan.CurrentStepState = StepStateReady
+	plan.LastUpdateTime = time.Now()
+	if errs := ValidatePlan(&plan); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return &plan, nil
+}
+
+// Apply builds the plan and starts it on the Deployment key, see ApplyPlan.
+func (b *PlanBuilder) Apply(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	plan, err := b.Build()
+	if err != nil {
+		return err
+	}
+	return ApplyPlan(ctx, c, key, plan)
+}
+
+// linearSteps returns n steps evenly spaced after from, or 0 when nil, to
+// to, preceded by from when set.
+func linearSteps(from *int32, to int32, n int) []int32 {
+	var start int32
+	replicas := make([]int32, 0, n+1)
+	if from != nil {
+		start = *from
+		replicas = append(replicas, start)
+	}
+	span := int64(to) - int64(start)
+	for i := 1; i <= n; i++ {
+		delta := int64(i) * span
+		// round away from start
+		step := delta / int64(n)
+		if delta%int64(n) != 0 {
+			if span > 0 {
+				step++
+			} else {
+				step--
+			}
+		}
+		replicas = append(replicas, start+int32(step))
+	}
+	return replicas
+}
+
+// pauseAt marks the step with replicas paused, inserting it in order when
+// missing.
+func pauseAt(steps []Step, replicas int32) []Step {
+	for i := range steps {
+		if steps[i].Replicas == replicas {
+			steps[i].Pause = true
+			return steps
+		}
+	}
+	for i := 1; i < len(steps); i++ {
+		previous, next := steps[i-1].Replicas, steps[i].Replicas
+		if (previous < replicas && replicas < next) || (previous > replicas && replicas > next) {
+			return append(steps[:i], append([]Step{{Replicas: replicas, Pause: true}}, steps[i:]...)...)
+		}
+	}
+	return append(steps, Step{Replicas: replicas, Pause: true})
+}
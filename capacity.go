@@ -0,0 +1,113 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// CapacityCheck estimates, before a step adds replicas, whether the nodes the
+// pods could run on have room for them: allocatable minus the requests of the
+// pods already there. It only considers node selectors and taints.
+type CapacityCheck struct {
+	// WarnOnly only logs the shortfall instead of pausing the plan, e.g. for
+	// clusters running cluster-autoscaler.
+	WarnOnly bool
+}
+
+// capacityShortfall returns why replicas more pods of the workload would not
+// fit on the cluster's nodes, or "" when they would.
+func (r *DeploymentReconciler) capacityShortfall(ctx context.Context, workload *Workload, replicas int32) (string, error) {
+	template := podTemplate(workload)
+	if template == nil {
+		return "", nil
+	}
+	reader := r.apiReader
+	if reader == nil {
+		reader = r.Client
+	}
+	nodes := &corev1.NodeList{}
+	if err := reader.List(ctx, nodes); err != nil {
+		return "", err
+	}
+	pods := &corev1.PodList{}
+	if err := reader.List(ctx, pods); err != nil {
+		return "", err
+	}
+	requested := make(map[string]corev1.ResourceList)
+	podCount := make(map[string]int64)
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if requested[pod.Spec.NodeName] == nil {
+			requested[pod.Spec.NodeName] = corev1.ResourceList{}
+		}
+		addResources(requested[pod.Spec.NodeName], podResources(&pod.Spec, 1))
+		podCount[pod.Spec.NodeName]++
+	}
+
+	perPod := podResources(&template.Spec, 1)
+	var fits int64
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !schedulable(node, &template.Spec) {
+			continue
+		}
+		n := node.Status.Allocatable.Pods().Value() - podCount[node.Name]
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			request, ok := perPod[name]
+			if !ok || request.IsZero() {
+				continue
+			}
+			free := node.Status.Allocatable[name].DeepCopy()
+			free.Sub(requested[node.Name][name])
+			if m := free.MilliValue() / request.MilliValue(); m < n {
+				n = m
+			}
+		}
+		if n > 0 {
+			fits += n
+		}
+		if fits >= int64(replicas) {
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("only %d of %d new pods fit on the nodes", fits, replicas), nil
+}
+
+// schedulable reports whether a pod of spec could be placed on node, looking
+// only at readiness, cordoning, the node selector and NoSchedule taints.
+func schedulable(node *corev1.Node, spec *corev1.PodSpec) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	ready := false
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			ready = condition.Status == corev1.ConditionTrue
+		}
+	}
+	if !ready || !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range spec.Tolerations {
+			if spec.Tolerations[j].ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
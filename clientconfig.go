@@ -0,0 +1,78 @@
+package annotationscale
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/rest"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+// ClientRateLimit is the client-side rate limit of the requests to the API
+// server, shared by all controllers of a manager.
+type ClientRateLimit struct {
+	QPS   float32
+	Burst int
+}
+
+// defaultClientRateLimit applies to configs without a rate limit, client-go
+// would otherwise throttle the controller to 5 QPS. These are the defaults of
+// ctrl.GetConfig and of the Kubernetes controller manager.
+var defaultClientRateLimit = ClientRateLimit{QPS: 20, Burst: 30}
+
+// DefaultUserAgent identifies the requests of the controller to the API
+// server, e.g. in its audit log, unless the config sets another.
+const DefaultUserAgent = "annotationscale"
+
+// clientConfig returns a copy of config with the user agent, impersonation
+// and rate limit of options.
+func clientConfig(log logr.Logger, config *rest.Config, options *Options) *rest.Config {
+	config = rest.CopyConfig(config)
+	if options.UserAgent != "" {
+		config.UserAgent = options.UserAgent
+	} else if config.UserAgent == "" {
+		config.UserAgent = DefaultUserAgent
+	}
+	if options.Impersonate != nil {
+		config.Impersonate = *options.Impersonate
+	}
+	limitClient(log, config, options.ClientRateLimit)
+	return config
+}
+
+// limitClient rate limits config by limit. Without limit it keeps the rate
+// limit config was tuned with, if any.
+func limitClient(log logr.Logger, config *rest.Config, limit *ClientRateLimit) {
+	if config.RateLimiter != nil {
+		if limit != nil {
+			log.Info("config has a RateLimiter, ignoring the client rate limit", "qps", limit.QPS, "burst", limit.Burst)
+		}
+		return
+	}
+	if limit == nil {
+		if config.QPS != 0 {
+			return
+		}
+		limit = &defaultClientRateLimit
+	}
+	config.QPS, config.Burst = limit.QPS, limit.Burst
+}
+
+// rateLimiterLatency observes the time requests waited for the client-side
+// rate limiter.
+type rateLimiterLatency struct {
+	next clientmetrics.LatencyMetric
+}
+
+func (l rateLimiterLatency) Observe(ctx context.Context, verb string, u url.URL, latency time.Duration) {
+	clientRateLimiterDurationSeconds.WithLabelValues(verb, u.Host).Observe(latency.Seconds())
+	l.next.Observe(ctx, verb, u, latency)
+}
+
+func init() {
+	// client-go takes the metrics registered first, controller-runtime
+	// registers its own without this one.
+	clientmetrics.RateLimiterLatency = rateLimiterLatency{next: clientmetrics.RateLimiterLatency}
+}
@@ -0,0 +1,70 @@
+package annotationscale
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CloneSetGVK is the OpenKruise CloneSet driven with WithCloneSets.
+var CloneSetGVK = schema.GroupVersionKind{Group: "apps.kruise.io", Version: "v1alpha1", Kind: "CloneSet"}
+
+// cloneSetClient drives OpenKruise CloneSets. Paused maps to
+// spec.updateStrategy.paused, which like spec.paused of a Deployment stops
+// the rollout of a new template but not scaling.
+type cloneSetClient struct {
+	client client.Client
+}
+
+func (c *cloneSetClient) Get(ctx context.Context, key types.NamespacedName) (*Workload, error) {
+	obj := newUnstructured(CloneSetGVK)
+	if err := c.client.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	workload := newCloneSetWorkload(obj)
+	workload.client = c
+	return workload, nil
+}
+
+func newCloneSetWorkload(obj *unstructured.Unstructured) *Workload {
+	var replicas int32 = 1
+	if specReplicas, ok := nestedInt32(obj, "spec", "replicas"); ok {
+		replicas = specReplicas
+	}
+	paused, _, _ := unstructured.NestedBool(obj.Object, "spec", "updateStrategy", "paused")
+	status := WorkloadStatus{}
+	status.Replicas, _ = nestedInt32(obj, "status", "replicas")
+	status.AvailableReplicas, _ = nestedInt32(obj, "status", "availableReplicas")
+	status.ReadyReplicas, _ = nestedInt32(obj, "status", "readyReplicas")
+	status.UpdatedReplicas, _ = nestedInt32(obj, "status", "updatedReplicas")
+	if status.Replicas > status.AvailableReplicas {
+		status.UnavailableReplicas = status.Replicas - status.AvailableReplicas
+	}
+	// a status of an older generation may predate the update
+	observedGeneration, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	status.RolloutInProgress = observedGeneration == obj.GetGeneration() && status.UpdatedReplicas < status.Replicas
+	return &Workload{
+		Object:        obj,
+		Selector:      nestedSelector(obj, "spec", "selector"),
+		Replicas:      replicas,
+		Paused:        paused,
+		SupportsPause: true,
+		Status:        status,
+	}
+}
+
+// Patch applies replicas, paused and the plan annotations with server-side
+// apply, like for Deployments.
+func (c *cloneSetClient) Patch(ctx context.Context, workload *Workload) error {
+	apply := applyObject(CloneSetGVK, workload)
+	if err := unstructured.SetNestedField(apply.Object, int64(workload.Replicas), "spec", "replicas"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(apply.Object, workload.Paused, "spec", "updateStrategy", "paused"); err != nil {
+		return err
+	}
+	return c.client.Patch(ctx, apply, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
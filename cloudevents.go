@@ -0,0 +1,112 @@
+package annotationscale
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// CloudEventTransitionType is the type of the CloudEvents sent for plan
+// transitions.
+const CloudEventTransitionType = "io.arcosx.annotationscale.plan.transition"
+
+// CloudEventsSink receives a CloudEvent, in the structured JSON mode, for
+// every state or step change of a plan.
+type CloudEventsSink struct {
+	URL string
+	// Source of the events, "annotationscale.arcosx.io" by default.
+	Source string
+	// Headers are added to each request, e.g. Authorization.
+	Headers map[string]string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// cloudEvent is a CloudEvents 1.0 event in the structured JSON mode.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            TransitionEvent `json:"data"`
+}
+
+// TransitionEvent is the data of a CloudEventTransitionType event.
+type TransitionEvent struct {
+	PlanID    string         `json:"plan_id,omitempty"`
+	Cluster   string         `json:"cluster,omitempty"`
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace"`
+	Name      string         `json:"name"`
+	UID       string         `json:"uid"`
+	From      StepTransition `json:"from"`
+	To        StepTransition `json:"to"`
+	Replicas  int32          `json:"replicas"`
+	Steps     []Step         `json:"steps"`
+	Message   string         `json:"message,omitempty"`
+}
+
+// StepTransition is the step and state of a plan.
+type StepTransition struct {
+	Step  int       `json:"step"`
+	State StepState `json:"state"`
+}
+
+func (s *CloudEventsSink) send(ctx context.Context, event cloudEvent) error {
+	headers := map[string]string{"Content-Type": "application/cloudevents+json"}
+	for key, value := range s.Headers {
+		headers[key] = value
+	}
+	return postJSON(ctx, s.HTTPClient, s.URL, headers, event)
+}
+
+// emitCloudEvent sends the change of the plan of workload from before to
+// after to the CloudEvents sink, if any.
+func (r *DeploymentReconciler) emitCloudEvent(ctx context.Context, workload *Workload, before stepSnapshot, after *ScaleAnnotation) {
+	sink := r.cloudEvents
+	if sink == nil || (before.index == after.CurrentStepIndex && before.state == after.CurrentStepState) {
+		return
+	}
+	obj := workload.Object
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if kind == "" {
+		kind = "Deployment"
+	}
+	source := sink.Source
+	if source == "" {
+		source = "annotationscale.arcosx.io"
+	}
+	if r.cluster != "" {
+		source += "/" + r.cluster
+	}
+	event := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              string(uuid.NewUUID()),
+		Source:          source,
+		Type:            CloudEventTransitionType,
+		Subject:         obj.GetNamespace() + "/" + obj.GetName(),
+		Time:            r.now().UTC(),
+		DataContentType: "application/json",
+		Data: TransitionEvent{
+			PlanID:    after.ID,
+			Cluster:   r.cluster,
+			Kind:      kind,
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			UID:       string(obj.GetUID()),
+			From:      StepTransition{Step: before.index, State: before.state},
+			To:        StepTransition{Step: after.CurrentStepIndex, State: after.CurrentStepState},
+			Replicas:  workload.Replicas,
+			Steps:     after.Steps,
+			Message:   after.Message,
+		},
+	}
+	if err := sink.send(ctx, event); err != nil {
+		r.log.Error(err, "failed to send cloudevent", "workload", obj.GetName(), "namespace", obj.GetNamespace())
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	annotationscale "github.com/arcosx/annotationscale"
+)
+
+// newActionCommand wraps a library call taking the deployment key.
+func newActionCommand(o *globalOptions, use, short, done string, action func(context.Context, client.Client, types.NamespacedName) error) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " DEPLOYMENT",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, key, err := o.client(args[0])
+			if err != nil {
+				return err
+			}
+			if err := action(cmd.Context(), c, key); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", key, done)
+			return nil
+		},
+	}
+}
+
+func newPauseCommand(o *globalOptions) *cobra.Command {
+	return newActionCommand(o, "pause", "Pause the plan at the current step", "paused", annotationscale.PausePlan)
+}
+
+func newResumeCommand(o *globalOptions) *cobra.Command {
+	return newActionCommand(o, "resume", "Resume a paused or timed out plan", "resumed", annotationscale.ResumePlan)
+}
+
+func newApproveCommand(o *globalOptions) *cobra.Command {
+	return newActionCommand(o, "approve", "Approve the current pause step", "step approved", annotationscale.ApproveStep)
+}
+
+func newSkipCommand(o *globalOptions) *cobra.Command {
+	return newActionCommand(o, "skip", "Skip the current step", "step skipped", annotationscale.SkipStep)
+}
+
+func newRetryCommand(o *globalOptions) *cobra.Command {
+	return newActionCommand(o, "retry", "Retry the current step of a timed out or failed plan", "step retried", annotationscale.RetryStep)
+}
+
+func newAbortCommand(o *globalOptions) *cobra.Command {
+	abortOptions := annotationscale.AbortOptions{}
+	cmd := newActionCommand(o, "abort", "Abort the plan", "aborted",
+		func(ctx context.Context, c client.Client, key types.NamespacedName) error {
+			return annotationscale.AbortPlan(ctx, c, key, abortOptions)
+		})
+	cmd.Flags().BoolVar(&abortOptions.Revert, "revert", false, "scale back to the replicas from before the plan")
+	cmd.Flags().StringVar(&abortOptions.Message, "message", "", "reason recorded in the plan")
+	return cmd
+}
+
+func getDeployment(ctx context.Context, o *globalOptions, name string) (*appsv1.Deployment, error) {
+	c, key, err := o.client(name)
+	if err != nil {
+		return nil, err
+	}
+	deployment := &appsv1.Deployment{}
+	if err := c.Get(ctx, key, deployment); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
+
+func newStatusCommand(o *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status DEPLOYMENT",
+		Short: "Show the progress of the plan",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deployment, err := getDeployment(cmd.Context(), o, args[0])
+			if err != nil {
+				return err
+			}
+			status, err := annotationscale.GetPlanStatus(deployment)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			if status.ID != "" {
+				fmt.Fprintf(w, "Plan:\t%s\n", status.ID)
+			}
+			fmt.Fprintf(w, "State:\t%s\n", status.State)
+			fmt.Fprintf(w, "Step:\t%d/%d\n", status.Step, status.TotalSteps)
+			fmt.Fprintf(w, "Progress:\t%d%%\n", status.PercentComplete)
+			fmt.Fprintf(w, "Time in step:\t%s\n", status.TimeInStep.Round(time.Second))
+			if status.ETA > 0 {
+				fmt.Fprintf(w, "ETA:\t%s\n", status.ETA.Round(time.Second))
+			}
+			if status.Message != "" {
+				fmt.Fprintf(w, "Message:\t%s\n", status.Message)
+			}
+			if next, err := annotationscale.DeploymentNextTransition(deployment, time.Now()); err == nil {
+				fmt.Fprintf(w, "Next:\t%s\n", next)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newHistoryCommand(o *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "history DEPLOYMENT",
+		Short: "List the finished plans",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deployment, err := getDeployment(cmd.Context(), o, args[0])
+			if err != nil {
+				return err
+			}
+			history, err := annotationscale.ReadPlanHistory(deployment.Annotations)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "FINISHED\tOUTCOME\tSTEPS\tDURATION\tMESSAGE")
+			for i := len(history) - 1; i >= 0; i-- {
+				record := history[i]
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", record.FinishedAt.Format(time.RFC3339), record.Outcome,
+					len(record.Steps), time.Duration(record.DurationSeconds)*time.Second, record.Message)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newTransitionsCommand(o *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "transitions DEPLOYMENT",
+		Short: "List the last step and state changes of the plan",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deployment, err := getDeployment(cmd.Context(), o, args[0])
+			if err != nil {
+				return err
+			}
+			scaleAnnotation, err := annotationscale.ReadScaleAnnotation(deployment.Annotations)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tFROM\tTO\tACTOR\tREASON")
+			for _, record := range scaleAnnotation.Transitions {
+				from := "-"
+				if record.From.Step > 0 {
+					from = fmt.Sprintf("%d/%s", record.From.Step, record.From.State)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d/%s\t%s\t%s\n", record.Time.Format(time.RFC3339), from,
+					record.To.Step, record.To.State, record.Actor, record.Reason)
+			}
+			return w.Flush()
+		},
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	annotationscalev1 "github.com/arcosx/annotationscale/api/grpc/v1"
+	"github.com/arcosx/annotationscale/grpcserver"
+)
+
+func newServeGRPCCommand(o *globalOptions) *cobra.Command {
+	var addr, tlsCert, tlsKey, clientCA string
+	var impersonateCallers bool
+	cmd := &cobra.Command{
+		Use:   "serve-grpc",
+		Short: "Serve the plan API over gRPC",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := o.restConfig()
+			if err != nil {
+				return err
+			}
+			c, err := client.NewWithWatch(config, client.Options{})
+			if err != nil {
+				return fmt.Errorf("could not create client: %w", err)
+			}
+			var serverOptions []grpc.ServerOption
+			var opts []grpcserver.Option
+			if tlsCert != "" {
+				tlsConfig, err := serverTLSConfig(tlsCert, tlsKey, clientCA)
+				if err != nil {
+					return err
+				}
+				serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+			}
+			if clientCA != "" && tlsCert == "" {
+				return errors.New("--client-ca needs --tls-cert")
+			}
+			if impersonateCallers {
+				if clientCA == "" {
+					return errors.New("--impersonate-callers needs --client-ca")
+				}
+				opts = append(opts, grpcserver.WithCallerImpersonation(config, grpcserver.CallerFromClientCert))
+			}
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			server := grpc.NewServer(serverOptions...)
+			annotationscalev1.RegisterPlanServiceServer(server, grpcserver.NewServer(c, opts...))
+			go func() {
+				<-cmd.Context().Done()
+				server.GracefulStop()
+			}()
+			fmt.Fprintf(cmd.OutOrStdout(), "serving gRPC on %s\n", listener.Addr())
+			return server.Serve(listener)
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", ":9090", "listen address")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "serve TLS with this certificate")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "key of --tls-cert")
+	cmd.Flags().StringVar(&clientCA, "client-ca", "", "require client certificates signed by this CA")
+	cmd.Flags().BoolVar(&impersonateCallers, "impersonate-callers", false, "act as the user of each client certificate")
+	return cmd
+}
+
+func serverTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,92 @@
+// Command annotationscale manages the scale plans of Deployments.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type globalOptions struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := newRootCommand().ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	o := &globalOptions{}
+	cmd := &cobra.Command{
+		Use:          "annotationscale",
+		Short:        "Manage annotationscale plans of Deployments",
+		SilenceUsage: true,
+	}
+	cmd.PersistentFlags().StringVar(&o.kubeconfig, "kubeconfig", "", "kubeconfig path")
+	cmd.PersistentFlags().StringVar(&o.context, "context", "", "kubeconfig context")
+	cmd.PersistentFlags().StringVarP(&o.namespace, "namespace", "n", "", "namespace of the deployment")
+
+	cmd.AddCommand(
+		newPlanCommand(o),
+		newStatusCommand(o),
+		newPauseCommand(o),
+		newResumeCommand(o),
+		newApproveCommand(o),
+		newAbortCommand(o),
+		newSkipCommand(o),
+		newRetryCommand(o),
+		newHistoryCommand(o),
+		newTransitionsCommand(o),
+		newServeGRPCCommand(o),
+	)
+	return cmd
+}
+
+func (o *globalOptions) clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: o.context})
+}
+
+func (o *globalOptions) restConfig() (*rest.Config, error) {
+	return o.clientConfig().ClientConfig()
+}
+
+// client returns a client for the kubeconfig and the key of the deployment
+// name in the selected namespace.
+func (o *globalOptions) client(name string) (client.Client, types.NamespacedName, error) {
+	clientConfig := o.clientConfig()
+	namespace := o.namespace
+	if namespace == "" {
+		var err error
+		namespace, _, err = clientConfig.Namespace()
+		if err != nil {
+			return nil, types.NamespacedName{}, err
+		}
+	}
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, types.NamespacedName{}, err
+	}
+	c, err := client.New(config, client.Options{})
+	if err != nil {
+		return nil, types.NamespacedName{}, fmt.Errorf("could not create client: %w", err)
+	}
+	return c, types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	annotationscale "github.com/arcosx/annotationscale"
+)
+
+func newPlanCommand(o *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Manage plans",
+	}
+	cmd.AddCommand(newPlanApplyCommand(o), newPlanPreviewCommand(), newPlanGetCommand(o))
+	return cmd
+}
+
+func newPlanApplyCommand(o *globalOptions) *cobra.Command {
+	var filename, steps string
+	cmd := &cobra.Command{
+		Use:   "apply DEPLOYMENT (-f plan.yaml | --steps 1,5p,10)",
+		Short: "Start a plan on a deployment, replacing any plan in flight",
+		Long: `Start a plan on a deployment, replacing any plan in flight.
+
+The plan file uses the annotation field names, e.g.
+
+  steps:
+  - replicas: 1
+  - replicas: 5
+    pause: true
+  - replicas: 10
+  max_wait_available_second: 600
+  max_unavailable_replicas: 1
+
+or --steps gives the steps as an expression like "1,2,5,10..50/10,100p",
+where a..b/s counts from a to b by s and p makes a pause step.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scaleAnnotation, err := loadPlan(filename, steps)
+			if err != nil {
+				return err
+			}
+			c, key, err := o.client(args[0])
+			if err != nil {
+				return err
+			}
+			if err := annotationscale.ApplyPlan(cmd.Context(), c, key, scaleAnnotation); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "plan with %d steps applied to %s\n", len(scaleAnnotation.Steps), key)
+			return nil
+		},
+	}
+	addPlanFlags(cmd, &filename, &steps)
+	return cmd
+}
+
+func newPlanPreviewCommand() *cobra.Command {
+	var filename, steps string
+	var replicas int32
+	var rolloutTime time.Duration
+	cmd := &cobra.Command{
+		Use:   "preview (-f plan.yaml | --steps 1,5p,10)",
+		Short: "Show when each step of a plan would finish",
+		Long: `Show when each step of a plan would finish, from the earliest case where
+new replicas are available after --rollout-time to the latest case where
+every step takes until its deadline. Pause steps are resumed at once.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scaleAnnotation, err := loadPlan(filename, steps)
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("replicas") {
+				replicas = scaleAnnotation.StepReplicas(1)
+			}
+			start := time.Now()
+			timeline, err := annotationscale.SimulatePlan(scaleAnnotation, replicas, annotationscale.SimulateOptions{
+				Start:       start,
+				RolloutTime: rolloutTime,
+			})
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "STEP\tREPLICAS\tPAUSE\tEARLIEST\tLATEST")
+			for _, step := range timeline {
+				fmt.Fprintf(w, "%d\t%d\t%t\t%s\t%s\n", step.Step, step.Replicas, step.Pause,
+					step.Earliest.Sub(start).Round(time.Second), step.Latest.Sub(start).Round(time.Second))
+			}
+			return w.Flush()
+		},
+	}
+	addPlanFlags(cmd, &filename, &steps)
+	cmd.Flags().Int32Var(&replicas, "replicas", 0, "current replicas of the deployment, the first step's by default")
+	cmd.Flags().DurationVar(&rolloutTime, "rollout-time", 30*time.Second, "time for new replicas to become available in the earliest case")
+	return cmd
+}
+
+func newPlanGetCommand(o *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get DEPLOYMENT",
+		Short: "Print the plan of a deployment as a plan file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deployment, err := getDeployment(cmd.Context(), o, args[0])
+			if err != nil {
+				return err
+			}
+			scaleAnnotation, err := annotationscale.ReadScaleAnnotation(deployment.Annotations)
+			if err != nil {
+				return err
+			}
+			data, err := annotationscale.WritePlanToYAML(scaleAnnotation)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(data)
+			return err
+		},
+	}
+}
+
+func addPlanFlags(cmd *cobra.Command, filename, steps *string) {
+	cmd.Flags().StringVarP(filename, "filename", "f", "", "plan file")
+	cmd.Flags().StringVar(steps, "steps", "", "steps expression, e.g. 1,2,5,10..50/10,100p")
+	cmd.MarkFlagsMutuallyExclusive("filename", "steps")
+}
+
+// loadPlan reads the plan from filename or builds it from the steps
+// expression.
+func loadPlan(filename, steps string) (*annotationscale.ScaleAnnotation, error) {
+	if steps != "" {
+		return annotationscale.LoadPlanFromYAML([]byte("steps: " + strconv.Quote(steps)))
+	}
+	if filename == "" {
+		return nil, errors.New("one of --filename or --steps is required")
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	scaleAnnotation, err := annotationscale.LoadPlanFromYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %w", filename, err)
+	}
+	return scaleAnnotation, nil
+}
@@ -0,0 +1,107 @@
+package annotationscale
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// CompletionPolicy says what happens to the workload once its plan completed.
+type CompletionPolicy struct {
+	// HPA hands the workload to a HorizontalPodAutoscaler instead of leaving
+	// it at the replicas of the last step.
+	HPA *HPAHandoff `json:"hpa,omitempty"`
+}
+
+// HPAHandoff creates the HPA, or updates the replica bounds of an existing
+// one, when the plan completed.
+type HPAHandoff struct {
+	// Name of the HPA, the workload's name by default.
+	Name string `json:"name,omitempty"`
+	// MinReplicas defaults to the replicas of the last step.
+	MinReplicas int32 `json:"min_replicas,omitempty"`
+	MaxReplicas int32 `json:"max_replicas"`
+	// TargetCPUUtilizationPercent of a created HPA, 80 by default. An
+	// existing HPA keeps its metrics.
+	TargetCPUUtilizationPercent int32 `json:"target_cpu_utilization_percent,omitempty"`
+}
+
+// handOff applies the completion policy of a completed plan. It returns true
+// once the workload was handed off, after which the reconciler no longer
+// pins its replicas.
+func (r *DeploymentReconciler) handOff(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) (bool, error) {
+	completion := scaleAnnotation.Completion
+	if completion == nil || completion.HPA == nil {
+		return false, nil
+	}
+	handoff := completion.HPA
+	key := types.NamespacedName{Namespace: workload.Object.GetNamespace(), Name: handoff.Name}
+	if key.Name == "" {
+		key.Name = workload.Object.GetName()
+	}
+	minReplicas := handoff.MinReplicas
+	if minReplicas == 0 {
+		minReplicas = scaleAnnotation.StepReplicas(len(scaleAnnotation.Steps))
+	}
+	if minReplicas < 1 {
+		minReplicas = 1
+	}
+	maxReplicas := handoff.MaxReplicas
+	if maxReplicas < minReplicas {
+		maxReplicas = minReplicas
+	}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, key, hpa)
+	if kerrors.IsNotFound(err) {
+		utilization := handoff.TargetCPUUtilizationPercent
+		if utilization == 0 {
+			utilization = 80
+		}
+		hpa = &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: scaleTargetRef(workload),
+				MinReplicas:    &minReplicas,
+				MaxReplicas:    maxReplicas,
+				Metrics: []autoscalingv2.MetricSpec{{
+					Type: autoscalingv2.ResourceMetricSourceType,
+					Resource: &autoscalingv2.ResourceMetricSource{
+						Name: corev1.ResourceCPU,
+						Target: autoscalingv2.MetricTarget{
+							Type:               autoscalingv2.UtilizationMetricType,
+							AverageUtilization: &utilization,
+						},
+					},
+				}},
+			},
+		}
+		logger.V(2).Info("hand off to new hpa", "hpa", key.Name, "min", minReplicas, "max", maxReplicas)
+		return true, r.Create(ctx, hpa)
+	}
+	if err != nil {
+		return false, err
+	}
+	hpa.Spec.ScaleTargetRef = scaleTargetRef(workload)
+	hpa.Spec.MinReplicas = &minReplicas
+	hpa.Spec.MaxReplicas = maxReplicas
+	logger.V(2).Info("hand off to hpa", "hpa", key.Name, "min", minReplicas, "max", maxReplicas)
+	return true, r.Update(ctx, hpa)
+}
+
+func scaleTargetRef(workload *Workload) autoscalingv2.CrossVersionObjectReference {
+	apiVersion := "apps/v1"
+	if gvk := workload.Object.GetObjectKind().GroupVersionKind(); !gvk.Empty() {
+		apiVersion = gvk.GroupVersion().String()
+	}
+	return autoscalingv2.CrossVersionObjectReference{
+		APIVersion: apiVersion,
+		Kind:       workloadKind(workload),
+		Name:       workload.Object.GetName(),
+	}
+}
@@ -0,0 +1,77 @@
+package annotationscale
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PodDeletionCostAnnotationKey is read by the ReplicaSet controller, pods
+// with lower costs are removed first on scale down.
+const PodDeletionCostAnnotationKey = "controller.kubernetes.io/pod-deletion-cost"
+
+// PodDeletionCostFunc returns the deletion cost of the workload's pods by pod
+// name. Pods missing from the result keep their current cost.
+type PodDeletionCostFunc func(ctx context.Context, pods []corev1.Pod) (map[string]int32, error)
+
+// NewestPodsFirst is a PodDeletionCostFunc removing the most recently created
+// pods first.
+func NewestPodsFirst(ctx context.Context, pods []corev1.Pod) (map[string]int32, error) {
+	sorted := append([]corev1.Pod{}, pods...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+	})
+	costs := make(map[string]int32, len(sorted))
+	for i, pod := range sorted {
+		costs[pod.Name] = int32(i)
+	}
+	return costs, nil
+}
+
+// setPodDeletionCosts annotates the pods of the workload with the costs of
+// r.podDeletionCost before it is scaled down.
+func (r *DeploymentReconciler) setPodDeletionCosts(ctx context.Context, logger logr.Logger, workload *Workload) error {
+	if r.podDeletionCost == nil {
+		return nil
+	}
+	pods, err := r.listPods(ctx, workload)
+	if err != nil {
+		return err
+	}
+	running := pods[:0]
+	for _, pod := range pods {
+		// draining pods keep the cost that makes them go first
+		if _, draining := pod.Annotations[DrainingAnnotationKey]; pod.DeletionTimestamp == nil && !draining {
+			running = append(running, pod)
+		}
+	}
+	costs, err := r.podDeletionCost(ctx, running)
+	if err != nil {
+		return err
+	}
+	for i := range running {
+		pod := &running[i]
+		cost, ok := costs[pod.Name]
+		if !ok {
+			continue
+		}
+		value := strconv.Itoa(int(cost))
+		if pod.Annotations[PodDeletionCostAnnotationKey] == value {
+			continue
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[PodDeletionCostAnnotationKey] = value
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			return err
+		}
+		logger.V(5).Info("set pod deletion cost", "pod", pod.Name, "cost", value)
+	}
+	return nil
+}
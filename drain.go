@@ -0,0 +1,187 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DrainingAnnotationKey is set on the pods a downward step is about to
+// remove, with the time the drain started.
+const DrainingAnnotationKey = "annotationscale.arcosx.io/draining"
+
+// StepDrain drains the pods a step scales away before replicas are lowered.
+// The pods are annotated with DrainingAnnotationKey, sent a POST to Path when
+// Port is set, and given TimeoutSeconds to finish their connections.
+type StepDrain struct {
+	Path string `json:"path,omitempty"`
+	Port int    `json:"port,omitempty"`
+	// TimeoutSeconds defaults to 30.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+func (d *StepDrain) timeout() time.Duration {
+	if d.TimeoutSeconds > 0 {
+		return time.Duration(d.TimeoutSeconds) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// drainStep drains the pods removed by moving to step index. It returns true
+// while the drain is in progress.
+func (r *DeploymentReconciler) drainStep(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore, index int) (bool, reconcile.Result, error) {
+	step := &scaleAnnotation.Steps[index-1]
+	drain := step.Drain
+	if drain == nil {
+		return false, reconcile.Result{}, nil
+	}
+	now := r.now()
+	if step.DrainStartedAt != nil {
+		if remaining := step.DrainStartedAt.Add(drain.timeout()).Sub(now); remaining > 0 {
+			logger.V(2).Info("draining", "step", index, "remaining", remaining.String())
+			return true, reconcile.Result{RequeueAfter: remaining}, nil
+		}
+		return false, reconcile.Result{}, nil
+	}
+
+	pods, err := r.listPods(ctx, workload)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return true, reconcile.Result{}, err
+	}
+	for _, pod := range drainVictims(pods, int(workload.Replicas-scaleAnnotation.StepReplicas(index))) {
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[DrainingAnnotationKey] = now.UTC().Format(time.RFC3339)
+		// make sure the ReplicaSet controller removes exactly these pods
+		pod.Annotations[PodDeletionCostAnnotationKey] = drainDeletionCost
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			logger.Error(err, "failed to annotate draining pod", "pod", pod.Name)
+			return true, reconcile.Result{}, err
+		}
+		if drain.Port != 0 && pod.Status.PodIP != "" {
+			if err := r.callDrain(ctx, drain, pod.Status.PodIP); err != nil {
+				// the pod still gets the drain timeout
+				logger.Info("drain request failed", "pod", pod.Name, "error", err.Error())
+			}
+		}
+		logger.V(2).Info("drain pod", "pod", pod.Name)
+	}
+	step.DrainStartedAt = &now
+	return true, reconcile.Result{RequeueAfter: drain.timeout()}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+}
+
+// drainDeletionCost is the deletion cost of draining pods.
+var drainDeletionCost = strconv.Itoa(math.MinInt32)
+
+// clearDrains removes the marks of drainStep from the pods that were not
+// removed, e.g. because the plan was aborted, retried or edited before the
+// scale down. Marks are kept while the drain of the next step is pending and
+// while the workload is still scaling down.
+func (r *DeploymentReconciler) clearDrains(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	index := scaleAnnotation.CurrentStepIndex
+	if index < 1 || index > len(scaleAnnotation.Steps) {
+		return nil
+	}
+	switch scaleAnnotation.CurrentStepState {
+	case StepStateReady, StepStatePaused:
+		for _, step := range scaleAnnotation.Steps[index:] {
+			if step.DrainStartedAt != nil {
+				return nil
+			}
+		}
+	}
+	if workload.Status.Replicas > workload.Replicas {
+		return nil
+	}
+	pods, err := r.listPodMetadata(ctx, workload)
+	if err != nil {
+		return err
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if _, draining := pod.Annotations[DrainingAnnotationKey]; !draining || pod.DeletionTimestamp != nil {
+			continue
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		delete(pod.Annotations, DrainingAnnotationKey)
+		if pod.Annotations[PodDeletionCostAnnotationKey] == drainDeletionCost {
+			delete(pod.Annotations, PodDeletionCostAnnotationKey)
+		}
+		if err := r.Patch(ctx, pod, patch); err != nil {
+			return err
+		}
+		logger.V(2).Info("clear drain", "pod", pod.Name)
+	}
+	return nil
+}
+
+// drainVictims picks the n pods the ReplicaSet controller will remove: the
+// lowest deletion cost first, then the newest.
+func drainVictims(pods []corev1.Pod, n int) []*corev1.Pod {
+	var candidates []*corev1.Pod
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil {
+			candidates = append(candidates, &pods[i])
+		}
+	}
+	cost := func(pod *corev1.Pod) int {
+		value, _ := strconv.Atoi(pod.Annotations[PodDeletionCostAnnotationKey])
+		return value
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if ci, cj := cost(candidates[i]), cost(candidates[j]); ci != cj {
+			return ci < cj
+		}
+		return candidates[j].CreationTimestamp.Before(&candidates[i].CreationTimestamp)
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return candidates[:n]
+}
+
+func (r *DeploymentReconciler) callDrain(ctx context.Context, drain *StepDrain, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	path := drain.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, strconv.Itoa(drain.Port)), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	httpClient := r.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package annotationscale
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// StepsEncodingKey marks a steps annotation that is not plain JSON.
+	StepsEncodingKey = "steps_encoding"
+	// StepsEncodingGzip is gzipped JSON in standard base64.
+	StepsEncodingGzip = "gzip+base64"
+	// StepsCompressionThreshold is the size of the steps JSON above which
+	// the steps are written with StepsEncodingGzip, as annotations are
+	// limited to 256KiB in total.
+	StepsCompressionThreshold = 32 * 1024
+)
+
+var ErrorScaleAnnotationStepsEncoding error = errors.New("unsupported steps_encoding")
+
+// encodeSteps returns the steps annotation and its encoding for stepsJSON,
+// compressed when larger than StepsCompressionThreshold.
+func encodeSteps(stepsJSON string) (string, string, error) {
+	if len(stepsJSON) <= StepsCompressionThreshold {
+		return stepsJSON, "", nil
+	}
+	buf := jsonBuffers.Get().(*bytes.Buffer)
+	defer jsonBuffers.Put(buf)
+	buf.Reset()
+	w := gzip.NewWriter(buf)
+	if _, err := io.WriteString(w, stepsJSON); err != nil {
+		return "", "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), StepsEncodingGzip, nil
+}
+
+// decodeSteps returns the JSON of a steps annotation with encoding.
+func decodeSteps(steps, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(steps), nil
+	case StepsEncodingGzip:
+		compressed, err := base64.StdEncoding.DecodeString(steps)
+		if err != nil {
+			return nil, err
+		}
+		r, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrorScaleAnnotationStepsEncoding, encoding)
+	}
+}
@@ -0,0 +1,56 @@
+package annotationscale
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// endpointsReady reports whether the plan's Service lists as many ready pods
+// of the workload as it has replicas. Plans without a Service are always
+// ready.
+func (r *DeploymentReconciler) endpointsReady(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) bool {
+	if scaleAnnotation.Service == "" {
+		return true
+	}
+	pods, err := r.listPodMetadata(ctx, workload)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return false
+	}
+	owned := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil {
+			owned[pod.Name] = true
+		}
+	}
+
+	slices := &discoveryv1.EndpointSliceList{}
+	err = r.List(ctx, slices, client.InNamespace(workload.Object.GetNamespace()),
+		client.MatchingLabels{discoveryv1.LabelServiceName: scaleAnnotation.Service})
+	if err != nil {
+		logger.Error(err, "failed to list endpointslices", "service", scaleAnnotation.Service)
+		return false
+	}
+	ready := make(map[string]bool)
+	for _, slice := range slices.Items {
+		for _, endpoint := range slice.Endpoints {
+			ref := endpoint.TargetRef
+			if ref == nil || ref.Kind != "Pod" || !owned[ref.Name] {
+				continue
+			}
+			// a nil ready condition means ready
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				ready[ref.Name] = true
+			}
+		}
+	}
+	if int32(len(ready)) < workload.Replicas {
+		logger.V(2).Info("waiting for service endpoints", "service", scaleAnnotation.Service,
+			"ready", len(ready), "replicas", workload.Replicas)
+		return false
+	}
+	return true
+}
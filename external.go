@@ -0,0 +1,90 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ExternalReplicasPolicy decides what happens to a plan when someone else,
+// e.g. an operator or another controller, changes the replicas of its
+// workload mid-plan.
+type ExternalReplicasPolicy string
+
+const (
+	// ExternalReplicasRevert scales the workload back to the current step,
+	// the default.
+	ExternalReplicasRevert ExternalReplicasPolicy = "Revert"
+	// ExternalReplicasAdopt makes the new replicas those of the current step.
+	ExternalReplicasAdopt ExternalReplicasPolicy = "Adopt"
+	// ExternalReplicasAbort aborts the plan and leaves the new replicas.
+	ExternalReplicasAbort ExternalReplicasPolicy = "Abort"
+)
+
+// replicasChangedExternally reports whether the replicas differ from a step
+// the controller already scaled to, rather than from a step not started yet.
+func replicasChangedExternally(scaleAnnotation *ScaleAnnotation) bool {
+	return scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].StartedAt != nil
+}
+
+// handleExternalReplicas applies r.externalReplicas to a workload whose
+// replicas were changed externally.
+func (r *DeploymentReconciler) handleExternalReplicas(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (reconcile.Result, error) {
+	index := scaleAnnotation.CurrentStepIndex
+	replicas, stepReplicas := workload.Replicas, scaleAnnotation.StepReplicas(index)
+	switch r.externalReplicas {
+	case ExternalReplicasAdopt:
+		scaleAnnotation.Message = fmt.Sprintf("adopted replicas %d changed externally from %d at step %d", replicas, stepReplicas, index)
+		logger.Info("adopt replicas changed externally", "replicas", replicas, "stepReplicas", stepReplicas)
+		r.event(workload, corev1.EventTypeNormal, "ReplicasAdopted", scaleAnnotation.Message)
+		scaleAnnotation.Steps[index-1].Replicas = replicas
+		scaleAnnotation.Steps[index-1].Percent = 0
+		if scaleAnnotation.Steps[index-1].Pause {
+			scaleAnnotation.CurrentStepState = StepStatePaused
+		} else {
+			scaleAnnotation.CurrentStepState = StepStateUpgrade
+		}
+		scaleAnnotation.LastUpdateTime = r.now()
+		scaleAnnotation.StepAvailableTime = time.Time{}
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+
+	case ExternalReplicasAbort:
+		scaleAnnotation.Message = fmt.Sprintf("aborted: replicas changed externally from %d to %d at step %d", stepReplicas, replicas, index)
+		logger.Info("abort plan, replicas changed externally", "replicas", replicas, "stepReplicas", stepReplicas)
+		r.event(workload, corev1.EventTypeWarning, "PlanAborted", scaleAnnotation.Message)
+		scaleAnnotation.CurrentStepState = StepStateAborted
+		scaleAnnotation.LastUpdateTime = r.now()
+		return reconcile.Result{}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+
+	default:
+		scaleAnnotation.Message = fmt.Sprintf("reverted replicas %d changed externally to %d at step %d", replicas, stepReplicas, index)
+		logger.Info("revert replicas changed externally", "replicas", replicas, "stepReplicas", stepReplicas)
+		r.event(workload, corev1.EventTypeNormal, "ReplicasReverted", scaleAnnotation.Message)
+		r.fixWorkloadReplicas(ctx, logger, workload, scaleAnnotation, store)
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, nil
+	}
+}
+
+// event records an Event on the workload, when the reconciler has a
+// recorder. Events of shadow mode carry ShadowEventAnnotationKey.
+func (r *DeploymentReconciler) event(workload *Workload, eventType, reason, message string) {
+	if r.recorder == nil {
+		return
+	}
+	annotations := map[string]string{}
+	if workload.planID != "" {
+		annotations[PlanIDEventAnnotationKey] = workload.planID
+	}
+	if r.shadow {
+		annotations[ShadowEventAnnotationKey] = "true"
+	}
+	if len(annotations) > 0 {
+		r.recorder.AnnotatedEventf(workload.Object, annotations, eventType, reason, "%s", message)
+		return
+	}
+	r.recorder.Event(workload.Object, eventType, reason, message)
+}
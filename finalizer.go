@@ -0,0 +1,94 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// PlanFinalizer keeps a workload with a plan in flight until the controller
+// recorded the interrupted plan, see ReconcilerOptions.Finalizer.
+const PlanFinalizer = "annotationscale.arcosx.io/plan"
+
+const interruptedMessage = "interrupted: the workload is being deleted"
+
+// syncFinalizer adds PlanFinalizer while a plan is in flight and removes it
+// otherwise. scaleAnnotation is nil when the workload has no plan.
+func (r *DeploymentReconciler) syncFinalizer(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	want := r.finalizer && planInFlight(scaleAnnotation)
+	if controllerutil.ContainsFinalizer(workload.Object, PlanFinalizer) == want {
+		return nil
+	}
+	logger.V(2).Info("update finalizer", "finalizer", PlanFinalizer, "add", want)
+	return r.updateFinalizer(ctx, workload, want)
+}
+
+// updateFinalizer adds or removes PlanFinalizer on a fresh copy of the
+// workload, leaving the finalizers of others alone.
+func (r *DeploymentReconciler) updateFinalizer(ctx context.Context, workload *Workload, add bool) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := workload.Object.DeepCopyObject().(client.Object)
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			return err
+		}
+		if controllerutil.ContainsFinalizer(obj, PlanFinalizer) == add {
+			return nil
+		}
+		patch := client.MergeFromWithOptions(obj.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+		if add {
+			controllerutil.AddFinalizer(obj, PlanFinalizer)
+		} else {
+			controllerutil.RemoveFinalizer(obj, PlanFinalizer)
+		}
+		return r.Patch(ctx, obj, patch)
+	})
+	return client.IgnoreNotFound(err)
+}
+
+// teardown handles a workload being deleted: a plan in flight is aborted and
+// recorded in the history, the resources of the plan are released and
+// PlanFinalizer is removed.
+func (r *DeploymentReconciler) teardown(ctx context.Context, workload *Workload, store StateStore) (reconcile.Result, error) {
+	logger := r.workloadLogger(workload)
+	key := client.ObjectKeyFromObject(workload.Object)
+	if scaleAnnotation, err := store.Read(ctx, workload); err == nil && planInFlight(scaleAnnotation) {
+		workload.planID = scaleAnnotation.ID
+		if scaleAnnotation.ID != "" {
+			logger = logger.WithValues("plan", scaleAnnotation.ID)
+		}
+		logger.Info(interruptedMessage, "step", scaleAnnotation.CurrentStepIndex, "state", scaleAnnotation.CurrentStepState)
+		r.event(workload, corev1.EventTypeWarning, "PlanInterrupted",
+			fmt.Sprintf("%s at step %d in %s", interruptedMessage, scaleAnnotation.CurrentStepIndex, scaleAnnotation.CurrentStepState))
+		from := scaleAnnotation.stepTransition()
+		scaleAnnotation.CurrentStepState = StepStateAborted
+		scaleAnnotation.Message = interruptedMessage
+		scaleAnnotation.LastUpdateTime = r.now()
+		scaleAnnotation.recordTransition(from, interruptedMessage, controllerActor)
+		if err := r.savePlan(ctx, logger, workload, scaleAnnotation, store); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+		if err := r.recordHistory(ctx, logger, workload, scaleAnnotation); err != nil {
+			logger.Error(err, "failed to record plan history")
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+	}
+	if err := r.syncScaledObjects(ctx, logger, workload, nil); err != nil {
+		logger.Error(err, "failed to sync scaledobjects")
+		return reconcile.Result{}, err
+	}
+	if err := r.releaseOwnership(ctx, workload); err != nil {
+		logger.Error(err, "failed to release the ownership lease")
+		return reconcile.Result{}, err
+	}
+	r.planBudget.release(key)
+	r.planCache.forget(key)
+	forgetWorkloadMetrics(r.cluster, key.Namespace, key.Name)
+	logger.V(2).Info("remove finalizer", "finalizer", PlanFinalizer)
+	return reconcile.Result{}, r.updateFinalizer(ctx, workload, false)
+}
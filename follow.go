@@ -0,0 +1,96 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// FollowAnnotationKey names a Deployment in the same namespace whose
+	// replicas the workload follows.
+	FollowAnnotationKey = "annotationscale.arcosx.io/follow"
+	// FollowRatioAnnotationKey is the decimal ratio of the followed replicas
+	// the workload runs, rounded up. It is 1 by default.
+	FollowRatioAnnotationKey = "annotationscale.arcosx.io/follow-ratio"
+)
+
+// reconcileFollow applies a one step plan to the followed replicas times the
+// ratio whenever they differ and no plan is in flight. It returns true when
+// a plan was applied.
+func (r *DeploymentReconciler) reconcileFollow(ctx context.Context, logger logr.Logger, workload *Workload, store StateStore) (bool, error) {
+	annotations := workload.Object.GetAnnotations()
+	leaderName, ok := annotations[FollowAnnotationKey]
+	if !ok || leaderName == "" {
+		return false, nil
+	}
+	ratio := 1.0
+	if ratioString, ok := annotations[FollowRatioAnnotationKey]; ok {
+		var err error
+		ratio, err = strconv.ParseFloat(ratioString, 64)
+		if err != nil || ratio < 0 {
+			logger.Info("invalid follow ratio", "ratio", ratioString)
+			return false, nil
+		}
+	}
+	leader := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: workload.Object.GetNamespace(), Name: leaderName}, leader)
+	if err != nil {
+		logger.V(2).Info("failed to get followed deployment", "deployment", leaderName, "error", err.Error())
+		return false, client.IgnoreNotFound(err)
+	}
+	leaderReplicas := int32(1)
+	if leader.Spec.Replicas != nil {
+		leaderReplicas = *leader.Spec.Replicas
+	}
+	desired := int32(math.Ceil(float64(leaderReplicas) * ratio))
+
+	if scaleAnnotation, err := store.Read(ctx, workload); err == nil {
+		if planInFlight(scaleAnnotation) {
+			return false, nil
+		}
+		if scaleAnnotation.StepReplicas(len(scaleAnnotation.Steps)) == desired {
+			return false, nil
+		}
+	}
+
+	logger.V(2).Info("follow", "leader", leaderName, "replicas", workload.Replicas, "newReplicas", desired)
+	plan := NewScaleAnnotation()
+	plan.Steps = []Step{{Replicas: desired}}
+	plan.CurrentStepIndex = 1
+	plan.CurrentStepState = StepStateReady
+	plan.Message = fmt.Sprintf("following %s", leaderName)
+	plan.LastUpdateTime = r.now()
+	plan.recordTransition(StepTransition{}, plan.Message, controllerActor)
+	if err := store.Write(ctx, workload, &plan); err != nil {
+		return false, err
+	}
+	if err := r.patchWorkload(ctx, logger, workload); err != nil {
+		logger.Error(err, "failed to patch")
+		return false, err
+	}
+	return true, nil
+}
+
+// followersOf maps a Deployment event to the Deployments following it.
+func (r *DeploymentReconciler) followersOf(obj client.Object) []reconcile.Request {
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(context.Background(), deployments, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.log.Error(err, "failed to list deployments")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, deployment := range deployments.Items {
+		if deployment.Annotations[FollowAnnotationKey] == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&deployment)})
+		}
+	}
+	return requests
+}
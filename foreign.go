@@ -0,0 +1,82 @@
+package annotationscale
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ForeignControllers recognizes workloads driven by other progressive
+// delivery controllers, which the reconciler refuses to manage so that the
+// controllers do not fight over their replicas.
+type ForeignControllers struct {
+	// OwnerGroups are API groups of owner references, e.g. argoproj.io.
+	OwnerGroups []string
+	// Annotations and Labels are keys marking a workload as driven by
+	// another controller.
+	Annotations []string
+	Labels      []string
+}
+
+// DefaultForeignControllers recognizes workloads owned by Argo Rollouts,
+// Flagger and OpenKruise.
+var DefaultForeignControllers = ForeignControllers{
+	OwnerGroups: []string{"argoproj.io", "flagger.app", "apps.kruise.io", "rollouts.kruise.io"},
+}
+
+// managedBy returns what makes obj a workload of another controller, empty
+// when there is none.
+func (f *ForeignControllers) managedBy(obj client.Object) string {
+	if f == nil {
+		return ""
+	}
+	for _, owner := range obj.GetOwnerReferences() {
+		group := schema.FromAPIVersionAndKind(owner.APIVersion, owner.Kind).Group
+		for _, ownerGroup := range f.OwnerGroups {
+			if group == ownerGroup {
+				return fmt.Sprintf("owned by %s %s", owner.Kind, owner.Name)
+			}
+		}
+	}
+	for _, key := range f.Annotations {
+		if _, ok := obj.GetAnnotations()[key]; ok {
+			return fmt.Sprintf("annotated with %s", key)
+		}
+	}
+	for _, key := range f.Labels {
+		if _, ok := obj.GetLabels()[key]; ok {
+			return fmt.Sprintf("labeled with %s", key)
+		}
+	}
+	return ""
+}
+
+// hasPlanAnnotations reports whether obj carries any annotation of the
+// controller.
+func hasPlanAnnotations(obj client.Object) bool {
+	for key := range obj.GetAnnotations() {
+		if isScaleAnnotation(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// refuseForeign reports whether workload is driven by another controller,
+// recording an Event when it carries a plan nonetheless.
+func (r *DeploymentReconciler) refuseForeign(workload *Workload) bool {
+	reason := r.foreignControllers.managedBy(workload.Object)
+	if reason == "" {
+		return false
+	}
+	if hasPlanAnnotations(workload.Object) {
+		message := "plan ignored, the workload is " + reason
+		r.log.Info(message, "workload", workload.Object.GetName(), "namespace", workload.Object.GetNamespace())
+		r.event(workload, corev1.EventTypeWarning, "ForeignController", message)
+	} else {
+		r.log.V(5).Info("skip workload of another controller", "workload", workload.Object.GetName(), "reason", reason)
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package annotationscale
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// FreezeConfigMapName is the ConfigMap whose FreezeAnnotationKey freezes
+	// all plans, see ReconcilerOptions.FreezeConfigMapNamespace.
+	FreezeConfigMapName = "annotationscale-freeze"
+	// FreezeAnnotationKey holds why plans are frozen, "false" or empty
+	// unfreezes them.
+	FreezeAnnotationKey = "annotationscale.arcosx.io/freeze"
+
+	frozenMessage = "frozen: plans do not advance"
+	// freezeCheckInterval bounds how often the freeze ConfigMap is read.
+	freezeCheckInterval = 5 * time.Second
+)
+
+// Freeze stops every plan from advancing to its next step while frozen, e.g.
+// during an incident. Steps in flight still finish. The zero Freeze is not
+// frozen.
+type Freeze struct {
+	mu     sync.Mutex
+	reason string
+}
+
+func NewFreeze() *Freeze {
+	return &Freeze{}
+}
+
+// Freeze freezes plans, reason is recorded in the log and Events.
+func (f *Freeze) Freeze(reason string) {
+	if reason == "" {
+		reason = "frozen"
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reason = reason
+}
+
+func (f *Freeze) Unfreeze() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reason = ""
+}
+
+// Frozen returns why plans are frozen, if they are.
+func (f *Freeze) Frozen() (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reason, f.reason != ""
+}
+
+// freezeConfigMap reads FreezeAnnotationKey of the freeze ConfigMap at most
+// every freezeCheckInterval. A nil freezeConfigMap is never frozen.
+type freezeConfigMap struct {
+	key types.NamespacedName
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	reason    string
+}
+
+func newFreezeConfigMap(namespace string) *freezeConfigMap {
+	if namespace == "" {
+		return nil
+	}
+	return &freezeConfigMap{key: types.NamespacedName{Namespace: namespace, Name: FreezeConfigMapName}}
+}
+
+func (f *freezeConfigMap) frozen(ctx context.Context, reader client.Reader, now time.Time) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now.Sub(f.checkedAt) < freezeCheckInterval {
+		return f.reason, nil
+	}
+	configMap := &corev1.ConfigMap{}
+	if err := reader.Get(ctx, f.key, configMap); err != nil && !kerrors.IsNotFound(err) {
+		// keep the last known state
+		return f.reason, err
+	}
+	f.checkedAt = now
+	f.reason = configMap.Annotations[FreezeAnnotationKey]
+	if f.reason == "false" {
+		f.reason = ""
+	}
+	return f.reason, nil
+}
+
+// frozen returns why plans are frozen by the Freeze or the freeze ConfigMap,
+// empty when they are not.
+func (r *DeploymentReconciler) frozen(ctx context.Context, logger logr.Logger) string {
+	reason, frozen := r.freeze.Frozen()
+	if !frozen {
+		var err error
+		reason, err = r.freezeConfigMap.frozen(ctx, r.apiReader, r.now())
+		if err != nil {
+			logger.Error(err, "failed to read the freeze configmap")
+		}
+	}
+	if reason != "" {
+		freezeActive.WithLabelValues(r.cluster).Set(1)
+	} else {
+		freezeActive.WithLabelValues(r.cluster).Set(0)
+	}
+	return reason
+}
@@ -0,0 +1,135 @@
+package annotationscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// StepWebhook is an external check, e.g. a load test or SLO checker, that
+// must accept a ready step before the plan leaves it.
+type StepWebhook struct {
+	URL string `json:"url"`
+	// Method defaults to POST.
+	Method string `json:"method,omitempty"`
+	// TimeoutSeconds defaults to 10.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// ExpectedStatus accepts only this status code instead of any 2xx.
+	ExpectedStatus int `json:"expected_status,omitempty"`
+}
+
+// StepWebhookRequest is the JSON body sent to a StepWebhook.
+type StepWebhookRequest struct {
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Step       int    `json:"step"`
+	TotalSteps int    `json:"total_steps"`
+	Replicas   int32  `json:"replicas"`
+}
+
+// heldMessagePrefix marks the plan message of a step held by a gate.
+const heldMessagePrefix = "held: "
+
+// stepGate returns why a ready step may not be left yet, "" to let it go.
+type stepGate func(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) string
+
+// gateStep holds a ready step until all gates let it go. It returns true
+// while the step is held.
+func (r *DeploymentReconciler) gateStep(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (bool, reconcile.Result, error) {
+	for _, gate := range []stepGate{r.webhookGate, r.resourceGate} {
+		reason := gate(ctx, logger, workload, scaleAnnotation)
+		if reason == "" {
+			continue
+		}
+		logger.V(2).Info("step held", "reason", reason)
+		message := heldMessagePrefix + reason
+		if scaleAnnotation.Message == message {
+			return true, reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+		scaleAnnotation.Message = message
+		return true, reconcile.Result{RequeueAfter: 30 * time.Second}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+	}
+	// persisted with the transition out of the step
+	if strings.HasPrefix(scaleAnnotation.Message, heldMessagePrefix) {
+		scaleAnnotation.Message = ""
+	}
+	return false, reconcile.Result{}, nil
+}
+
+func (r *DeploymentReconciler) webhookGate(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) string {
+	webhook := scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Webhook
+	if webhook == nil {
+		return ""
+	}
+	err := r.callStepWebhook(ctx, webhook, StepWebhookRequest{
+		Namespace:  workload.Object.GetNamespace(),
+		Name:       workload.Object.GetName(),
+		Step:       scaleAnnotation.CurrentStepIndex,
+		TotalSteps: len(scaleAnnotation.Steps),
+		Replicas:   workload.Replicas,
+	})
+	if err != nil {
+		return fmt.Sprintf("webhook %s: %s", webhook.URL, err)
+	}
+	logger.V(2).Info("step webhook accepted", "url", webhook.URL)
+	return ""
+}
+
+func (r *DeploymentReconciler) callStepWebhook(ctx context.Context, webhook *StepWebhook, stepRequest StepWebhookRequest) error {
+	timeout := 10 * time.Second
+	if webhook.TimeoutSeconds > 0 {
+		timeout = time.Duration(webhook.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := webhook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	var body io.Reader
+	if method != http.MethodGet {
+		data, err := json.Marshal(stepRequest)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, webhook.URL, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := r.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if webhook.ExpectedStatus != 0 {
+		if resp.StatusCode != webhook.ExpectedStatus {
+			return fmt.Errorf("status %d, want %d", resp.StatusCode, webhook.ExpectedStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package annotationscale
+
+import "math"
+
+// GenerateLinearSteps splits from --> to into n evenly sized steps ending at
+// to. The first step pauses so the first increment can be verified before
+// the rest of the plan runs.
+func GenerateLinearSteps(from, to int32, n int) []Step {
+	if n < 1 {
+		n = 1
+	}
+	var steps []Step
+	for i := 1; i <= n; i++ {
+		replicas := from + int32(math.Round(float64(to-from)*float64(i)/float64(n)))
+		steps = appendStep(steps, replicas)
+	}
+	return pauseFirst(steps)
+}
+
+// GenerateExponentialSteps multiplies (or divides, when scaling down) the
+// replica count by factor until to is reached. A from of 0 starts at 1. The
+// first step pauses like GenerateLinearSteps.
+func GenerateExponentialSteps(from, to int32, factor float64) []Step {
+	if factor <= 1 {
+		return []Step{{Replicas: to}}
+	}
+	var steps []Step
+	current := float64(from)
+	if to >= from {
+		if current < 1 {
+			current = 1
+			steps = appendStep(steps, 1)
+		}
+		for {
+			current = math.Ceil(current * factor)
+			if current >= float64(to) {
+				break
+			}
+			steps = appendStep(steps, int32(current))
+		}
+	} else {
+		for {
+			current = math.Floor(current / factor)
+			if current <= float64(to) {
+				break
+			}
+			steps = appendStep(steps, int32(current))
+		}
+	}
+	steps = appendStep(steps, to)
+	return pauseFirst(steps)
+}
+
+// GenerateCanarySteps ramps to target through a single canary replica and
+// 10%, 25%, 50% of target, pausing after the canary and at 25%.
+func GenerateCanarySteps(target int32) []Step {
+	var steps []Step
+	for _, step := range []struct {
+		percent int64
+		pause   bool
+	}{
+		{0, true},
+		{10, false},
+		{25, true},
+		{50, false},
+		{100, false},
+	} {
+		replicas := int32(1)
+		if step.percent > 0 {
+			replicas = int32((int64(target)*step.percent + 99) / 100)
+		}
+		if replicas > target {
+			replicas = target
+		}
+		if len(steps) > 0 && steps[len(steps)-1].Replicas == replicas {
+			steps[len(steps)-1].Pause = steps[len(steps)-1].Pause || step.pause
+			continue
+		}
+		steps = append(steps, Step{Replicas: replicas, Pause: step.pause})
+	}
+	// never pause at the final step, the plan would never complete
+	steps[len(steps)-1].Pause = false
+	return steps
+}
+
+func appendStep(steps []Step, replicas int32) []Step {
+	if len(steps) > 0 && steps[len(steps)-1].Replicas == replicas {
+		return steps
+	}
+	return append(steps, Step{Replicas: replicas})
+}
+
+func pauseFirst(steps []Step) []Step {
+	if len(steps) > 1 {
+		steps[0].Pause = true
+	}
+	return steps
+}
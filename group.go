@@ -0,0 +1,303 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/arcosx/annotationscale/api/v1alpha1"
+)
+
+// GroupReconciler drives the members of a ScaleGroup step by step. Members
+// are scaled to their share of a step once the members they depend on are
+// available, and the group only moves on when every member is available.
+type GroupReconciler struct {
+	client.Client
+	log        *logr.Logger
+	namespaces *NamespaceFilter
+	shadow     bool
+	// clock defaults to the wall clock.
+	clock Clock
+	// requeue backs off groups waiting on their members, apart from the
+	// workloads of the same names.
+	requeue *requeueBackoff
+}
+
+func (r *GroupReconciler) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+	return r.clock.Now()
+}
+
+func (r *GroupReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	r.log.V(2).Info("Reconcile", "scalegroup", req)
+	if allowed, err := r.namespaces.allows(ctx, r.Client, req.Namespace); !allowed {
+		r.log.V(5).Info("namespace not managed", "namespace", req.Namespace)
+		return reconcile.Result{}, err
+	}
+	group := &v1alpha1.ScaleGroup{}
+	err := r.Get(ctx, req.NamespacedName, group)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			r.log.Info("scalegroup resource not found. Ignoring since object must be deleted")
+			r.requeue.forget(req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		r.log.Error(err, "failed to get scalegroup", "scalegroup", req.Name, "namespace", req.Namespace)
+		return reconcile.Result{}, err
+	}
+	logger := r.log.WithValues("scalegroup", group.Name, "namespace", group.Namespace)
+	before := group.Status.DeepCopy()
+
+	if group.Status.ObservedGeneration != group.Generation {
+		logger.V(2).Info("spec changed, restart group", "generation", group.Generation)
+		group.Status.ObservedGeneration = group.Generation
+		group.Status.CurrentStepIndex = 1
+		group.Status.CurrentStepState = string(StepStateUpgrade)
+		group.Status.Message = ""
+		group.Status.LastUpdateTime = metav1.NewTime(r.now())
+	}
+
+	result, err := r.reconcileGroup(ctx, logger, group)
+	if err != nil {
+		return result, err
+	}
+	result = r.requeue.backoff(group, nil, result, r.now())
+	setGroupCondition(group)
+	if !equality.Semantic.DeepEqual(before, &group.Status) {
+		if err := r.Status().Update(ctx, group); err != nil {
+			logger.Error(err, "failed to update scalegroup status")
+			return reconcile.Result{}, err
+		}
+	}
+	return result, nil
+}
+
+func (r *GroupReconciler) InjectClient(c client.Client) error {
+	r.Client = shadowed(c, r.shadow, r.log, "")
+	return nil
+}
+
+func (r *GroupReconciler) reconcileGroup(ctx context.Context, logger logr.Logger, group *v1alpha1.ScaleGroup) (reconcile.Result, error) {
+	status := &group.Status
+	if StepState(status.CurrentStepState) != StepStateUpgrade {
+		logger.V(2).Info("group is not running", "state", status.CurrentStepState)
+		return reconcile.Result{}, nil
+	}
+	if status.CurrentStepIndex < 1 || status.CurrentStepIndex > len(group.Spec.Steps) {
+		return reconcile.Result{}, fmt.Errorf("current step index %d out of range", status.CurrentStepIndex)
+	}
+	step := group.Spec.Steps[status.CurrentStepIndex-1]
+	down := status.CurrentStepIndex > 1 && step.Replicas < group.Spec.Steps[status.CurrentStepIndex-2].Replicas
+	members, waitFor, err := orderMembers(group.Spec.Members, down)
+	if err == nil {
+		err = validateReciprocal(group)
+	}
+	if err != nil {
+		logger.V(2).Info("change step state", "state", status.CurrentStepState, "newState", StepStateError, "error", err.Error())
+		status.CurrentStepState = string(StepStateError)
+		status.Message = err.Error()
+		status.LastUpdateTime = metav1.NewTime(r.now())
+		return reconcile.Result{}, nil
+	}
+	workloads := &deploymentClient{client: r.Client}
+
+	var unavailable, blocked []string
+	available := make(map[string]bool, len(members))
+	for _, member := range members {
+		if waiting := notIn(waitFor[member.Name], available); len(waiting) > 0 {
+			logger.V(5).Info("member waits", "member", member.Name, "for", waiting)
+			blocked = append(blocked, member.Name)
+			continue
+		}
+		workload, err := workloads.Get(ctx, types.NamespacedName{Namespace: group.Namespace, Name: member.Name})
+		if err != nil {
+			if kerrors.IsNotFound(err) {
+				status.Message = fmt.Sprintf("member %s not found", member.Name)
+				return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+			}
+			logger.Error(err, "failed to get member", "member", member.Name)
+			return reconcile.Result{}, err
+		}
+		replicas := memberReplicas(group, status.CurrentStepIndex, member)
+		if workload.Replicas != replicas || workload.Paused {
+			logger.V(2).Info("scale member", "member", member.Name, "replicas", workload.Replicas, "newReplicas", replicas)
+			workload.Replicas = replicas
+			workload.Paused = false
+			if err := workload.client.Patch(ctx, workload); err != nil {
+				logger.Error(err, "failed to patch member", "member", member.Name)
+				return reconcile.Result{}, err
+			}
+			unavailable = append(unavailable, member.Name)
+			continue
+		}
+		if workload.Status.Replicas != replicas || workload.Status.AvailableReplicas != replicas {
+			unavailable = append(unavailable, member.Name)
+			continue
+		}
+		available[member.Name] = true
+	}
+
+	now := r.now()
+	if len(unavailable) > 0 || len(blocked) > 0 {
+		sort.Strings(unavailable)
+		maxWait := group.Spec.MaxWaitAvailableSeconds
+		if step.MaxWaitAvailableSeconds > 0 {
+			maxWait = step.MaxWaitAvailableSeconds
+		}
+		if maxWait > 0 && now.After(status.LastUpdateTime.Add(time.Duration(maxWait)*time.Second)) {
+			logger.V(2).Info("change step state", "state", status.CurrentStepState, "newState", StepStateTimeout, "unavailable", unavailable)
+			status.CurrentStepState = string(StepStateTimeout)
+			status.Message = fmt.Sprintf("step %d: %s not available", status.CurrentStepIndex, strings.Join(unavailable, ", "))
+			if len(blocked) > 0 {
+				status.Message += fmt.Sprintf(", %s blocked", strings.Join(blocked, ", "))
+			}
+			status.LastUpdateTime = metav1.NewTime(now)
+			return reconcile.Result{}, nil
+		}
+		logger.V(5).Info("waiting for members", "unavailable", unavailable)
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, nil
+	}
+
+	status.Message = ""
+	status.LastUpdateTime = metav1.NewTime(now)
+	if status.CurrentStepIndex == len(group.Spec.Steps) {
+		logger.V(2).Info("change step state", "state", status.CurrentStepState, "newState", StepStateCompleted)
+		status.CurrentStepState = string(StepStateCompleted)
+		return reconcile.Result{}, nil
+	}
+	logger.V(2).Info("change", "step", status.CurrentStepIndex, "newStep", status.CurrentStepIndex+1)
+	status.CurrentStepIndex++
+	return reconcile.Result{Requeue: true}, nil
+}
+
+// orderMembers sorts members so that each comes after the members it waits
+// for: its dependencies when scaling up, its dependents when scaling down.
+func orderMembers(members []v1alpha1.GroupMember, down bool) ([]v1alpha1.GroupMember, map[string][]string, error) {
+	byName := make(map[string]v1alpha1.GroupMember, len(members))
+	for _, member := range members {
+		if _, ok := byName[member.Name]; ok {
+			return nil, nil, fmt.Errorf("duplicate member %s", member.Name)
+		}
+		byName[member.Name] = member
+	}
+	waitFor := make(map[string][]string, len(members))
+	for _, member := range members {
+		for _, dependency := range member.DependsOn {
+			if _, ok := byName[dependency]; !ok {
+				return nil, nil, fmt.Errorf("member %s depends on unknown member %s", member.Name, dependency)
+			}
+			if down {
+				waitFor[dependency] = append(waitFor[dependency], member.Name)
+			} else {
+				waitFor[member.Name] = append(waitFor[member.Name], dependency)
+			}
+		}
+	}
+
+	var ordered []v1alpha1.GroupMember
+	done := make(map[string]bool, len(members))
+	for len(ordered) < len(members) {
+		progress := false
+		for _, member := range members {
+			if done[member.Name] || len(notIn(waitFor[member.Name], done)) > 0 {
+				continue
+			}
+			done[member.Name] = true
+			ordered = append(ordered, member)
+			progress = true
+		}
+		if !progress {
+			var cycle []string
+			for _, member := range members {
+				if !done[member.Name] {
+					cycle = append(cycle, member.Name)
+				}
+			}
+			return nil, nil, fmt.Errorf("dependency cycle between members %s", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, waitFor, nil
+}
+
+func validateReciprocal(group *v1alpha1.ScaleGroup) error {
+	for _, member := range group.Spec.Members {
+		if member.Reciprocal && group.Spec.TotalReplicas == 0 {
+			return fmt.Errorf("reciprocal member %s needs totalReplicas", member.Name)
+		}
+	}
+	return nil
+}
+
+func notIn(names []string, set map[string]bool) []string {
+	var missing []string
+	for _, name := range names {
+		if !set[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// memberReplicas is the member's share of the replicas of step index,
+// rounded up.
+func memberReplicas(group *v1alpha1.ScaleGroup, index int, member v1alpha1.GroupMember) int32 {
+	replicas := group.Spec.Steps[index-1].Replicas
+	if member.Reciprocal {
+		replicas = group.Spec.TotalReplicas - replicas
+		if index == len(group.Spec.Steps) || replicas < 0 {
+			replicas = 0
+		}
+	}
+	percent := member.Percent
+	if percent == 0 {
+		percent = 100
+	}
+	return int32((int64(replicas)*int64(percent) + 99) / 100)
+}
+
+func setGroupCondition(group *v1alpha1.ScaleGroup) {
+	condition := metav1.Condition{
+		Type:               ScalePlanConditionCompleted,
+		Status:             metav1.ConditionFalse,
+		Reason:             group.Status.CurrentStepState,
+		Message:            fmt.Sprintf("step %d of %d", group.Status.CurrentStepIndex, len(group.Spec.Steps)),
+		ObservedGeneration: group.Generation,
+	}
+	if StepState(group.Status.CurrentStepState) == StepStateCompleted {
+		condition.Status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&group.Status.Conditions, condition)
+}
+
+// groupsForDeployment maps a Deployment event to the ScaleGroups it is a
+// member of.
+func (r *GroupReconciler) groupsForDeployment(obj client.Object) []reconcile.Request {
+	groups := &v1alpha1.ScaleGroupList{}
+	if err := r.List(context.Background(), groups, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.log.Error(err, "failed to list scalegroups")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, group := range groups.Items {
+		for _, member := range group.Spec.Members {
+			if member.Name == obj.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&group)})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,295 @@
+// Package grpcserver serves the annotationscale plan API over gRPC, see
+// api/grpc/v1.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	appsv1 "k8s.io/api/apps/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	annotationscale "github.com/arcosx/annotationscale"
+	annotationscalev1 "github.com/arcosx/annotationscale/api/grpc/v1"
+)
+
+type Server struct {
+	annotationscalev1.UnimplementedPlanServiceServer
+	client client.WithWatch
+
+	// config and caller impersonate the callers, see WithCallerImpersonation.
+	config *rest.Config
+	caller func(context.Context) (rest.ImpersonationConfig, bool)
+
+	mu      sync.Mutex
+	clients map[string]client.WithWatch
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithCallerImpersonation makes the requests of each call as the caller
+// identifies, so that audit logs and the defaulting webhook attribute plans
+// to the human who submitted them. The user of config must be allowed to
+// impersonate them. Calls from unidentified callers are rejected.
+func WithCallerImpersonation(config *rest.Config, caller func(context.Context) (rest.ImpersonationConfig, bool)) Option {
+	return func(s *Server) {
+		s.config = config
+		s.caller = caller
+		s.clients = map[string]client.WithWatch{}
+	}
+}
+
+// CallerFromClientCert identifies callers by their verified TLS client
+// certificate like the API server does: the common name is the user and the
+// organizations are its groups.
+func CallerFromClientCert(ctx context.Context) (rest.ImpersonationConfig, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return rest.ImpersonationConfig{}, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return rest.ImpersonationConfig{}, false
+	}
+	subject := tlsInfo.State.VerifiedChains[0][0].Subject
+	return rest.ImpersonationConfig{UserName: subject.CommonName, Groups: subject.Organization}, subject.CommonName != ""
+}
+
+// NewServer returns the PlanService implementation. Register it with
+// annotationscalev1.RegisterPlanServiceServer.
+func NewServer(c client.WithWatch, opts ...Option) *Server {
+	s := &Server{client: c}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// clientFor returns the client for the calls of the caller of ctx.
+func (s *Server) clientFor(ctx context.Context) (client.WithWatch, error) {
+	if s.caller == nil {
+		return s.client, nil
+	}
+	impersonate, ok := s.caller(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unidentified caller")
+	}
+	key := impersonate.UserName + "\x00" + strings.Join(impersonate.Groups, ",")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.clients[key]; ok {
+		return c, nil
+	}
+	config := rest.CopyConfig(s.config)
+	config.Impersonate = impersonate
+	c, err := client.NewWithWatch(config, client.Options{Scheme: s.client.Scheme(), Mapper: s.client.RESTMapper()})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.clients[key] = c
+	return c, nil
+}
+
+func (s *Server) ApplyPlan(ctx context.Context, req *annotationscalev1.ApplyPlanRequest) (*annotationscalev1.PlanStatus, error) {
+	key, err := planKey(req.GetRef())
+	if err != nil {
+		return nil, err
+	}
+	plan := req.GetPlan()
+	scaleAnnotation := annotationscale.NewScaleAnnotation()
+	for _, step := range plan.GetSteps() {
+		scaleAnnotation.Steps = append(scaleAnnotation.Steps, annotationscale.Step{
+			Replicas:               step.GetReplicas(),
+			Percent:                step.GetPercent(),
+			Pause:                  step.GetPause(),
+			MaxWaitAvailableSecond: int(step.GetMaxWaitAvailableSeconds()),
+			HoldSeconds:            int(step.GetHoldSeconds()),
+		})
+	}
+	if plan.GetMaxWaitAvailableSeconds() > 0 {
+		scaleAnnotation.MaxWaitAvailableSecond = int(plan.GetMaxWaitAvailableSeconds())
+	}
+	scaleAnnotation.MaxUnavailableReplicas = int(plan.GetMaxUnavailableReplicas())
+	scaleAnnotation.TargetReplicas = plan.GetTargetReplicas()
+	c, err := s.clientFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := annotationscale.ApplyPlan(ctx, c, key, &scaleAnnotation); err != nil {
+		return nil, toStatus(err)
+	}
+	return s.planStatus(ctx, c, key)
+}
+
+func (s *Server) GetPlanStatus(ctx context.Context, ref *annotationscalev1.PlanRef) (*annotationscalev1.PlanStatus, error) {
+	key, err := planKey(ref)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.clientFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.planStatus(ctx, c, key)
+}
+
+func (s *Server) PausePlan(ctx context.Context, ref *annotationscalev1.PlanRef) (*annotationscalev1.PlanStatus, error) {
+	return s.action(ctx, ref, annotationscale.PausePlan)
+}
+
+func (s *Server) ResumePlan(ctx context.Context, ref *annotationscalev1.PlanRef) (*annotationscalev1.PlanStatus, error) {
+	return s.action(ctx, ref, annotationscale.ResumePlan)
+}
+
+func (s *Server) SkipStep(ctx context.Context, ref *annotationscalev1.PlanRef) (*annotationscalev1.PlanStatus, error) {
+	return s.action(ctx, ref, annotationscale.SkipStep)
+}
+
+func (s *Server) RetryStep(ctx context.Context, ref *annotationscalev1.PlanRef) (*annotationscalev1.PlanStatus, error) {
+	return s.action(ctx, ref, annotationscale.RetryStep)
+}
+
+func (s *Server) AbortPlan(ctx context.Context, req *annotationscalev1.AbortPlanRequest) (*annotationscalev1.PlanStatus, error) {
+	return s.action(ctx, req.GetRef(), func(ctx context.Context, c client.Client, key types.NamespacedName) error {
+		return annotationscale.AbortPlan(ctx, c, key, annotationscale.AbortOptions{
+			Revert:  req.GetRevert(),
+			Message: req.GetMessage(),
+		})
+	})
+}
+
+func (s *Server) WatchPlan(ref *annotationscalev1.PlanRef, stream annotationscalev1.PlanService_WatchPlanServer) error {
+	key, err := planKey(ref)
+	if err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	c, err := s.clientFor(ctx)
+	if err != nil {
+		return err
+	}
+	var last *annotationscale.ScaleAnnotation
+	for {
+		deployments := &appsv1.DeploymentList{}
+		w, err := c.Watch(ctx, deployments,
+			client.InNamespace(key.Namespace),
+			client.MatchingFieldsSelector{Selector: fields.OneTermEqualSelector("metadata.name", key.Name)})
+		if err != nil {
+			return toStatus(err)
+		}
+		for event := range w.ResultChan() {
+			deployment, ok := event.Object.(*appsv1.Deployment)
+			if !ok || event.Type == watch.Deleted {
+				continue
+			}
+			scaleAnnotation, err := annotationscale.ReadScaleAnnotation(deployment.Annotations)
+			if err != nil {
+				continue
+			}
+			if last != nil && last.CurrentStepIndex == scaleAnnotation.CurrentStepIndex && last.CurrentStepState == scaleAnnotation.CurrentStepState {
+				continue
+			}
+			planEvent := &annotationscalev1.PlanEvent{
+				Ref:        ref,
+				Step:       int32(scaleAnnotation.CurrentStepIndex),
+				TotalSteps: int32(len(scaleAnnotation.Steps)),
+				State:      string(scaleAnnotation.CurrentStepState),
+				Message:    scaleAnnotation.Message,
+				Time:       timestamppb.New(scaleAnnotation.LastUpdateTime),
+			}
+			if last != nil {
+				planEvent.PreviousState = string(last.CurrentStepState)
+			}
+			if err := stream.Send(planEvent); err != nil {
+				w.Stop()
+				return err
+			}
+			last = scaleAnnotation
+		}
+		w.Stop()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Server) action(ctx context.Context, ref *annotationscalev1.PlanRef, action func(context.Context, client.Client, types.NamespacedName) error) (*annotationscalev1.PlanStatus, error) {
+	key, err := planKey(ref)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.clientFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := action(ctx, c, key); err != nil {
+		return nil, toStatus(err)
+	}
+	return s.planStatus(ctx, c, key)
+}
+
+func (s *Server) planStatus(ctx context.Context, c client.Client, key types.NamespacedName) (*annotationscalev1.PlanStatus, error) {
+	deployment := &appsv1.Deployment{}
+	if err := c.Get(ctx, key, deployment); err != nil {
+		return nil, toStatus(err)
+	}
+	planStatus, err := annotationscale.GetPlanStatus(deployment)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &annotationscalev1.PlanStatus{
+		State:             string(planStatus.State),
+		Message:           planStatus.Message,
+		Step:              int32(planStatus.Step),
+		TotalSteps:        int32(planStatus.TotalSteps),
+		StepsDone:         int32(planStatus.StepsDone),
+		PercentComplete:   int32(planStatus.PercentComplete),
+		TimeInStepSeconds: int64(planStatus.TimeInStep.Seconds()),
+		EtaSeconds:        int64(planStatus.ETA.Seconds()),
+	}, nil
+}
+
+func planKey(ref *annotationscalev1.PlanRef) (types.NamespacedName, error) {
+	if ref.GetNamespace() == "" || ref.GetDeployment() == "" {
+		return types.NamespacedName{}, status.Error(codes.InvalidArgument, "namespace and deployment are required")
+	}
+	return types.NamespacedName{Namespace: ref.GetNamespace(), Name: ref.GetDeployment()}, nil
+}
+
+// toStatus maps library and API errors to gRPC codes.
+func toStatus(err error) error {
+	switch {
+	case kerrors.IsNotFound(err):
+		return status.Error(codes.NotFound, err.Error())
+	case kerrors.IsConflict(err):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, annotationscale.ErrorPlanFinished),
+		errors.Is(err, annotationscale.ErrorPlanNotResumable),
+		errors.Is(err, annotationscale.ErrorPlanNotFailed),
+		errors.Is(err, annotationscale.ErrorPlanNotRunning),
+		errors.Is(err, annotationscale.ErrorReplicasMismatch),
+		errors.Is(err, annotationscale.ErrorNoNextStep):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, annotationscale.ErrorScaleAnnotationParseSteps),
+		errors.Is(err, annotationscale.ErrorScaleAnnotationParseCurrentStepIndex),
+		errors.Is(err, annotationscale.ErrorScaleAnnotationParseCurrentStepState):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
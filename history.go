@@ -0,0 +1,96 @@
+package annotationscale
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// HistoryAnnotationKey holds a JSON list of PlanRecord, oldest first.
+	HistoryAnnotationKey = "annotationscale.arcosx.io/history"
+	// DefaultHistoryLimit is the number of finished plans kept by default.
+	DefaultHistoryLimit = 10
+)
+
+// PlanRecord is a finished plan as kept in HistoryAnnotationKey.
+type PlanRecord struct {
+	ID         string    `json:"plan_id,omitempty"`
+	Outcome    StepState `json:"outcome"`
+	Message    string    `json:"message,omitempty"`
+	Steps      []Step    `json:"steps"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+	// DurationSeconds is FinishedAt - StartedAt, 0 when the start is unknown.
+	DurationSeconds int64 `json:"duration_seconds,omitempty"`
+}
+
+// ReadPlanHistory returns the finished plans recorded in annotations.
+func ReadPlanHistory(annotations map[string]string) ([]PlanRecord, error) {
+	historyJSON, ok := annotations[HistoryAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+	var history []PlanRecord
+	if err := json.Unmarshal([]byte(historyJSON), &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func newPlanRecord(scaleAnnotation *ScaleAnnotation) PlanRecord {
+	record := PlanRecord{
+		ID:         scaleAnnotation.ID,
+		Outcome:    scaleAnnotation.CurrentStepState,
+		Message:    scaleAnnotation.Message,
+		Steps:      scaleAnnotation.Steps,
+		FinishedAt: scaleAnnotation.LastUpdateTime,
+		StartedAt:  planStartedAt(scaleAnnotation),
+	}
+	if !record.StartedAt.IsZero() {
+		record.DurationSeconds = int64(record.FinishedAt.Sub(record.StartedAt).Seconds())
+	}
+	return record
+}
+
+// recordHistory appends a Completed or Aborted plan to the history of the
+// workload once, keeping the last historyLimit records.
+func (r *DeploymentReconciler) recordHistory(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	switch scaleAnnotation.CurrentStepState {
+	case StepStateCompleted, StepStateAborted:
+	default:
+		return nil
+	}
+	limit := r.historyLimit
+	if limit == 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit < 0 {
+		return nil
+	}
+	annotations := workload.Object.GetAnnotations()
+	history, err := ReadPlanHistory(annotations)
+	if err != nil {
+		// a corrupt history is dropped rather than blocking the plan
+		logger.Error(err, "failed to read plan history, reset it")
+		history = nil
+	}
+	if n := len(history); n > 0 && history[n-1].Outcome == scaleAnnotation.CurrentStepState &&
+		history[n-1].FinishedAt.Equal(scaleAnnotation.LastUpdateTime) {
+		return nil
+	}
+	history = append(history, newPlanRecord(scaleAnnotation))
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	annotations[HistoryAnnotationKey] = string(historyJSON)
+	workload.Object.SetAnnotations(annotations)
+	logger.V(2).Info("record plan history", "outcome", scaleAnnotation.CurrentStepState, "records", len(history))
+	return r.patchWorkload(ctx, logger, workload)
+}
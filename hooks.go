@@ -0,0 +1,75 @@
+package annotationscale
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Hooks are called by the reconciler after a transition was persisted. They
+// run in the reconcile loop and should return quickly. Embed NoopHooks to
+// implement only some of them.
+type Hooks interface {
+	// OnStepStart is called when the workload is scaled to the current step.
+	OnStepStart(ctx context.Context, obj client.Object, plan *ScaleAnnotation)
+	// OnStepComplete is called when the 1-based step index reached its replicas.
+	OnStepComplete(ctx context.Context, obj client.Object, plan *ScaleAnnotation, index int)
+	OnPlanComplete(ctx context.Context, obj client.Object, plan *ScaleAnnotation)
+	OnTimeout(ctx context.Context, obj client.Object, plan *ScaleAnnotation)
+	// OnError is called when the plan moved to StepStateError, see plan.Message.
+	OnError(ctx context.Context, obj client.Object, plan *ScaleAnnotation)
+}
+
+type NoopHooks struct{}
+
+func (NoopHooks) OnStepStart(context.Context, client.Object, *ScaleAnnotation)         {}
+func (NoopHooks) OnStepComplete(context.Context, client.Object, *ScaleAnnotation, int) {}
+func (NoopHooks) OnPlanComplete(context.Context, client.Object, *ScaleAnnotation)      {}
+func (NoopHooks) OnTimeout(context.Context, client.Object, *ScaleAnnotation)           {}
+func (NoopHooks) OnError(context.Context, client.Object, *ScaleAnnotation)             {}
+
+// stepSnapshot is the part of a plan the hooks compare across a reconcile.
+// Steps are shared with the plan being mutated, so their times are copied.
+type stepSnapshot struct {
+	index     int
+	state     StepState
+	startedAt time.Time
+	finished  bool
+}
+
+func snapshotStep(scaleAnnotation *ScaleAnnotation) stepSnapshot {
+	snapshot := stepSnapshot{index: scaleAnnotation.CurrentStepIndex, state: scaleAnnotation.CurrentStepState}
+	if snapshot.index >= 1 && snapshot.index <= len(scaleAnnotation.Steps) {
+		step := scaleAnnotation.Steps[snapshot.index-1]
+		if step.StartedAt != nil {
+			snapshot.startedAt = *step.StartedAt
+		}
+		snapshot.finished = step.FinishedAt != nil
+	}
+	return snapshot
+}
+
+func (r *DeploymentReconciler) runHooks(ctx context.Context, workload *Workload, before stepSnapshot, after *ScaleAnnotation) {
+	if r.hooks == nil {
+		return
+	}
+	obj := workload.Object
+	if before.index >= 1 && before.index <= len(after.Steps) && !before.finished && after.Steps[before.index-1].FinishedAt != nil {
+		r.hooks.OnStepComplete(ctx, obj, after, before.index)
+	}
+	if after.CurrentStepState != before.state {
+		switch after.CurrentStepState {
+		case StepStateCompleted:
+			r.hooks.OnPlanComplete(ctx, obj, after)
+		case StepStateTimeout:
+			r.hooks.OnTimeout(ctx, obj, after)
+		case StepStateError:
+			r.hooks.OnError(ctx, obj, after)
+		}
+	}
+	current := snapshotStep(after)
+	if current.index != before.index || !current.startedAt.Equal(before.startedAt) {
+		r.hooks.OnStepStart(ctx, obj, after)
+	}
+}
@@ -0,0 +1,126 @@
+package annotationscale
+
+import (
+	"context"
+	"encoding/json"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var hpaGVK = autoscalingv2.SchemeGroupVersion.WithKind("HorizontalPodAutoscaler")
+
+// HPAOptions configures how plans drive HorizontalPodAutoscalers. Step
+// replicas are the minReplicas of the HPA, so a plan raises the floor of an
+// autoscaled workload, e.g. gradually before a sale.
+type HPAOptions struct {
+	// PinMaxReplicas sets maxReplicas to the step replicas too. Otherwise
+	// maxReplicas is only raised to the step replicas when it is below them.
+	PinMaxReplicas bool
+}
+
+// hpaClient drives the replica bounds of HPAs. A step is available once the
+// scale target of the HPA has as many available replicas.
+type hpaClient struct {
+	client         client.Client
+	pinMaxReplicas bool
+}
+
+func (c *hpaClient) Get(ctx context.Context, key types.NamespacedName) (*Workload, error) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+	if err := c.client.Get(ctx, key, hpa); err != nil {
+		return nil, err
+	}
+	var minReplicas int32 = 1
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
+	}
+	workload := &Workload{Object: hpa, Replicas: minReplicas, client: c}
+
+	ref := hpa.Spec.ScaleTargetRef
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	target := newUnstructured(gv.WithKind(ref.Kind))
+	if err := c.client.Get(ctx, types.NamespacedName{Namespace: key.Namespace, Name: ref.Name}, target); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		// without target nothing becomes available
+		workload.Status.Replicas = -1
+		return workload, nil
+	}
+	workload.Selector = nestedSelector(target, "spec", "selector")
+	targetReplicas, _ := nestedInt32(target, "spec", "replicas")
+	available, ok := nestedInt32(target, "status", "availableReplicas")
+	if !ok {
+		available, _ = nestedInt32(target, "status", "readyReplicas")
+	}
+	if targetReplicas < minReplicas {
+		// the HPA did not apply the floor yet
+		workload.Status = WorkloadStatus{Replicas: targetReplicas, AvailableReplicas: available, ReadyReplicas: available}
+		return workload, nil
+	}
+	// the HPA may scale the target beyond minReplicas
+	if available > minReplicas {
+		available = minReplicas
+	}
+	workload.Status = WorkloadStatus{
+		Replicas:            minReplicas,
+		AvailableReplicas:   available,
+		UnavailableReplicas: minReplicas - available,
+		ReadyReplicas:       available,
+		UpdatedReplicas:     minReplicas,
+	}
+	return workload, nil
+}
+
+// Patch applies the plan annotations and the replica bounds with server-side
+// apply. maxReplicas is only applied when it must change or was applied
+// before, so that its owner may keep changing it.
+func (c *hpaClient) Patch(ctx context.Context, workload *Workload) error {
+	hpa := workload.Object.(*autoscalingv2.HorizontalPodAutoscaler)
+	apply := applyObject(hpaGVK, workload)
+	if err := unstructured.SetNestedField(apply.Object, int64(workload.Replicas), "spec", "minReplicas"); err != nil {
+		return err
+	}
+	maxReplicas := hpa.Spec.MaxReplicas
+	if c.pinMaxReplicas || maxReplicas < workload.Replicas {
+		maxReplicas = workload.Replicas
+	}
+	if maxReplicas != hpa.Spec.MaxReplicas || appliedField(hpa, "spec", "maxReplicas") {
+		if err := unstructured.SetNestedField(apply.Object, int64(maxReplicas), "spec", "maxReplicas"); err != nil {
+			return err
+		}
+	}
+	return c.client.Patch(ctx, apply, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// appliedField reports whether the controller applied the field at path of
+// obj before, according to its managed fields.
+func appliedField(obj client.Object, path ...string) bool {
+entries:
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager != FieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		for _, name := range path {
+			value, ok := fields["f:"+name]
+			if !ok {
+				continue entries
+			}
+			fields, _ = value.(map[string]interface{})
+		}
+		return true
+	}
+	return false
+}
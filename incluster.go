@@ -0,0 +1,26 @@
+package annotationscale
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// DefaultSyncPeriod is the resync period of NewAnnotationScaleManagerInCluster,
+// the controller-runtime default.
+const DefaultSyncPeriod = 10 * time.Hour
+
+// NewAnnotationScaleManagerInCluster creates a manager for the workloads
+// matching match from the service account of the pod it runs in. The token
+// is reread from its file as the kubelet rotates it. The manager resyncs every
+// DefaultSyncPeriod and serves metrics on :8080 unless opts say otherwise.
+func NewAnnotationScaleManagerInCluster(log *logr.Logger, match *metav1.LabelSelector, opts ...Option) (*AnnotationScaleManager, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]Option{WithMetricsBindAddress(":8080")}, opts...)
+	return NewAnnotationScaleManager(log, match, config, DefaultSyncPeriod, opts...)
+}
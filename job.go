@@ -0,0 +1,97 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	JobWorkloadLabelKey = "annotationscale.arcosx.io/workload"
+	JobStepLabelKey     = "annotationscale.arcosx.io/step"
+)
+
+// StepJob runs a Job, e.g. a smoke test or cache warm-up, once the step is
+// available. The step is only done once the Job succeeded; a failed Job
+// moves the plan to StepStateError.
+type StepJob struct {
+	Template batchv1.JobTemplateSpec `json:"template"`
+}
+
+// stepJobName is unique per run of the step, so retried or restarted steps
+// get a new Job.
+func stepJobName(workload *Workload, scaleAnnotation *ScaleAnnotation) string {
+	run := scaleAnnotation.LastUpdateTime
+	if startedAt := scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].StartedAt; startedAt != nil {
+		run = *startedAt
+	}
+	suffix := fmt.Sprintf("-step%d-%s", scaleAnnotation.CurrentStepIndex, strconv.FormatInt(run.Unix(), 36))
+	name := workload.Object.GetName()
+	if len(name)+len(suffix) > 63 {
+		name = name[:63-len(suffix)]
+	}
+	return name + suffix
+}
+
+// runStepJob holds an available step until its Job succeeded. It returns
+// true while the step is held.
+func (r *DeploymentReconciler) runStepJob(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (bool, reconcile.Result, error) {
+	stepJob := scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Job
+	if stepJob == nil {
+		return false, reconcile.Result{}, nil
+	}
+	key := types.NamespacedName{Namespace: workload.Object.GetNamespace(), Name: stepJobName(workload, scaleAnnotation)}
+	job := &batchv1.Job{}
+	err := r.Get(ctx, key, job)
+	if kerrors.IsNotFound(err) {
+		job = &batchv1.Job{
+			ObjectMeta: *stepJob.Template.ObjectMeta.DeepCopy(),
+			Spec:       *stepJob.Template.Spec.DeepCopy(),
+		}
+		job.Name = key.Name
+		job.Namespace = key.Namespace
+		job.GenerateName = ""
+		if job.Labels == nil {
+			job.Labels = map[string]string{}
+		}
+		job.Labels[JobWorkloadLabelKey] = workload.Object.GetName()
+		job.Labels[JobStepLabelKey] = strconv.Itoa(scaleAnnotation.CurrentStepIndex)
+		if err := controllerutil.SetControllerReference(workload.Object, job, r.Scheme()); err != nil {
+			logger.Error(err, "failed to set job owner")
+		}
+		logger.V(2).Info("create step job", "job", key.Name)
+		if err := r.Create(ctx, job); err != nil && !kerrors.IsAlreadyExists(err) {
+			logger.Error(err, "failed to create step job")
+			return true, reconcile.Result{}, err
+		}
+		return true, reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+	} else if err != nil {
+		logger.Error(err, "failed to get step job")
+		return true, reconcile.Result{}, err
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			logger.V(2).Info("step job succeeded", "job", key.Name)
+			return false, reconcile.Result{}, nil
+		case batchv1.JobFailed:
+			reason := fmt.Sprintf("job %s failed: %s: %s", key.Name, condition.Reason, condition.Message)
+			return true, reconcile.Result{}, r.failStep(ctx, logger, workload, scaleAnnotation, store, reason)
+		}
+	}
+	logger.V(5).Info("waiting for step job", "job", key.Name)
+	return true, reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+}
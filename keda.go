@@ -0,0 +1,101 @@
+package annotationscale
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// KEDAPausedReplicasAnnotationKey pauses a KEDA ScaledObject at the given
+// replica count.
+const KEDAPausedReplicasAnnotationKey = "autoscaling.keda.sh/paused-replicas"
+
+// ScaledObjectPausedAnnotationKey marks ScaledObjects paused by the
+// controller, only those are un-paused when the plan is done.
+const ScaledObjectPausedAnnotationKey = "annotationscale.arcosx.io/paused"
+
+var scaledObjectListGVK = schema.GroupVersionKind{Group: "keda.sh", Version: "v1alpha1", Kind: "ScaledObjectList"}
+
+func planInFlight(scaleAnnotation *ScaleAnnotation) bool {
+	return scaleAnnotation != nil &&
+		scaleAnnotation.CurrentStepState != StepStateCompleted &&
+		scaleAnnotation.CurrentStepState != StepStateAborted
+}
+
+// syncScaledObjects pauses the ScaledObjects targeting the workload at its
+// step replicas while a plan is in flight and un-pauses them afterwards. A
+// nil plan means the workload has none.
+func (r *DeploymentReconciler) syncScaledObjects(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	if !r.keda {
+		return nil
+	}
+	scaledObjects := &unstructured.UnstructuredList{}
+	scaledObjects.SetGroupVersionKind(scaledObjectListGVK)
+	err := r.List(ctx, scaledObjects, client.InNamespace(workload.Object.GetNamespace()))
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return err
+	}
+	inFlight := planInFlight(scaleAnnotation)
+	replicas := strconv.Itoa(int(workload.Replicas))
+	for i := range scaledObjects.Items {
+		scaledObject := &scaledObjects.Items[i]
+		if !targetsWorkload(scaledObject, workload) {
+			continue
+		}
+		annotations := scaledObject.GetAnnotations()
+		_, pausedByUs := annotations[ScaledObjectPausedAnnotationKey]
+		patch := client.MergeFrom(scaledObject.DeepCopy())
+		if inFlight {
+			paused, ok := annotations[KEDAPausedReplicasAnnotationKey]
+			if ok && !pausedByUs {
+				logger.V(2).Info("scaledobject paused by someone else, leave it alone", "scaledobject", scaledObject.GetName())
+				continue
+			}
+			if pausedByUs && paused == replicas {
+				continue
+			}
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[KEDAPausedReplicasAnnotationKey] = replicas
+			annotations[ScaledObjectPausedAnnotationKey] = "true"
+			logger.V(2).Info("pause scaledobject", "scaledobject", scaledObject.GetName(), "replicas", replicas)
+		} else {
+			if !pausedByUs {
+				continue
+			}
+			delete(annotations, KEDAPausedReplicasAnnotationKey)
+			delete(annotations, ScaledObjectPausedAnnotationKey)
+			logger.V(2).Info("un-pause scaledobject", "scaledobject", scaledObject.GetName())
+		}
+		scaledObject.SetAnnotations(annotations)
+		if err := r.Patch(ctx, scaledObject, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func targetsWorkload(scaledObject *unstructured.Unstructured, workload *Workload) bool {
+	name, _, _ := unstructured.NestedString(scaledObject.Object, "spec", "scaleTargetRef", "name")
+	kind, _, _ := unstructured.NestedString(scaledObject.Object, "spec", "scaleTargetRef", "kind")
+	if kind == "" {
+		kind = "Deployment"
+	}
+	return name == workload.Object.GetName() && kind == workloadKind(workload)
+}
+
+func workloadKind(workload *Workload) string {
+	if u, ok := workload.Object.(*unstructured.Unstructured); ok {
+		return u.GetKind()
+	}
+	return "Deployment"
+}
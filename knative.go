@@ -0,0 +1,154 @@
+package annotationscale
+
+import (
+	"context"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// KnativeServiceGVK is the Knative Serving Service driven with WithKnative.
+var KnativeServiceGVK = schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"}
+
+var knativeRevisionGVK = schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Revision"}
+
+// The scale bounds of a Knative revision, with their names before Knative
+// 0.19 still accepted.
+const (
+	KnativeMinScaleAnnotationKey = "autoscaling.knative.dev/min-scale"
+	KnativeMaxScaleAnnotationKey = "autoscaling.knative.dev/max-scale"
+	knativeLegacyMinScaleKey     = "autoscaling.knative.dev/minScale"
+	knativeLegacyMaxScaleKey     = "autoscaling.knative.dev/maxScale"
+	knativeServiceLabelKey       = "serving.knative.dev/service"
+)
+
+// KnativeOptions configures how plans drive Knative Services. Step replicas
+// are the min-scale of the revision template, so a plan pre-warms the
+// service; each step creates a new revision.
+type KnativeOptions struct {
+	// PinMaxScale sets max-scale to the step replicas too, so that the service
+	// runs exactly that many pods. Otherwise max-scale is only raised to the
+	// step replicas when it is below them.
+	PinMaxScale bool
+}
+
+// knativeClient drives the min-scale, and max-scale, of Knative Services. A
+// step is available once the revision with its min-scale runs as many pods.
+type knativeClient struct {
+	client      client.Client
+	pinMaxScale bool
+}
+
+func (c *knativeClient) Get(ctx context.Context, key types.NamespacedName) (*Workload, error) {
+	obj := newUnstructured(KnativeServiceGVK)
+	if err := c.client.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	workload := &Workload{
+		Object:   obj,
+		Selector: labels.SelectorFromSet(labels.Set{knativeServiceLabelKey: key.Name}),
+	}
+	templateAnnotations := knativeTemplateAnnotations(obj)
+	minScale, _ := knativeScale(templateAnnotations, KnativeMinScaleAnnotationKey, knativeLegacyMinScaleKey)
+	workload.Replicas = minScale
+
+	revisionName, _, _ := unstructured.NestedString(obj.Object, "status", "latestCreatedRevisionName")
+	if revisionName == "" {
+		workload.Status.Replicas = -1
+		workload.client = c
+		return workload, nil
+	}
+	revision := newUnstructured(knativeRevisionGVK)
+	if err := c.client.Get(ctx, types.NamespacedName{Namespace: key.Namespace, Name: revisionName}, revision); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	actual, _ := nestedInt32(revision, "status", "actualReplicas")
+	revisionMinScale, _ := knativeScale(revision.GetAnnotations(), KnativeMinScaleAnnotationKey, knativeLegacyMinScaleKey)
+	workload.Status = WorkloadStatus{Replicas: actual, AvailableReplicas: actual, ReadyReplicas: actual, UpdatedReplicas: actual}
+	if revisionMinScale == minScale {
+		// traffic may scale the revision beyond min-scale
+		available := actual
+		if available > minScale {
+			available = minScale
+		}
+		workload.Status = WorkloadStatus{
+			Replicas:            minScale,
+			AvailableReplicas:   available,
+			UnavailableReplicas: minScale - available,
+			ReadyReplicas:       available,
+			UpdatedReplicas:     minScale,
+		}
+	} else {
+		// the revision of the current min-scale is not created yet
+		workload.Status.RolloutInProgress = true
+	}
+	workload.client = c
+	return workload, nil
+}
+
+// Patch applies the plan annotations and the scale bounds of the revision
+// template with server-side apply. Services with the legacy annotation names
+// keep them.
+func (c *knativeClient) Patch(ctx context.Context, workload *Workload) error {
+	apply := applyObject(KnativeServiceGVK, workload)
+	templateAnnotations := map[string]interface{}{}
+	current := knativeTemplateAnnotations(workload.Object.(*unstructured.Unstructured))
+	templateAnnotations[knativeScaleKey(current, KnativeMinScaleAnnotationKey, knativeLegacyMinScaleKey)] = strconv.Itoa(int(workload.Replicas))
+	maxScale, ok := knativeScale(current, KnativeMaxScaleAnnotationKey, knativeLegacyMaxScaleKey)
+	switch {
+	case c.pinMaxScale:
+		maxScale, ok = workload.Replicas, true
+	case ok && maxScale > 0 && maxScale < workload.Replicas:
+		maxScale = workload.Replicas
+	}
+	// a max-scale applied before is applied again, or it would be removed
+	if ok {
+		templateAnnotations[knativeScaleKey(current, KnativeMaxScaleAnnotationKey, knativeLegacyMaxScaleKey)] = strconv.Itoa(int(maxScale))
+	}
+	if err := unstructured.SetNestedMap(apply.Object, templateAnnotations, "spec", "template", "metadata", "annotations"); err != nil {
+		return err
+	}
+	return c.client.Patch(ctx, apply, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+func knativeTemplateAnnotations(obj *unstructured.Unstructured) map[string]string {
+	annotations, _, _ := unstructured.NestedStringMap(obj.Object, "spec", "template", "metadata", "annotations")
+	return annotations
+}
+
+func knativeScale(annotations map[string]string, key, legacyKey string) (int32, bool) {
+	value, ok := annotations[key]
+	if !ok {
+		value, ok = annotations[legacyKey]
+	}
+	if !ok {
+		return 0, false
+	}
+	scale, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(scale), true
+}
+
+func knativeScaleKey(annotations map[string]string, key, legacyKey string) string {
+	if _, ok := annotations[legacyKey]; ok {
+		return legacyKey
+	}
+	return key
+}
+
+// serviceForRevision maps a Revision to its Service, whose availability is
+// the replicas of the revision.
+func serviceForRevision(obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[knativeServiceLabelKey]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
@@ -0,0 +1,145 @@
+package annotationscale
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// LogSampling keeps the identical lines logged on every requeue of a long
+// step, e.g. "waiting for step to be available", from flooding the logs.
+// Lines are identical when their logger name, message and key/value fields
+// are; a line with a changed field is logged at once. Errors are never
+// sampled.
+type LogSampling struct {
+	// Every maps a verbosity to N: of identical lines at that V level, the
+	// first and then every Nth is logged. Levels not listed log every line.
+	Every map[int]int
+	// Expire forgets lines not repeated for so long, so that they are logged
+	// again the next time. 10 minutes by default.
+	Expire time.Duration
+}
+
+// logSampler holds the counts of the lines seen, shared by the sinks of a
+// logger and the loggers derived from it.
+type logSampler struct {
+	every  map[int]int
+	expire time.Duration
+
+	mu        sync.Mutex
+	lines     map[string]*sampledLine
+	lastPrune time.Time
+}
+
+type sampledLine struct {
+	count    int
+	lastSeen time.Time
+}
+
+// sample counts an occurrence of line and returns how many identical lines
+// were dropped since the last one logged, or false to drop it.
+func (s *logSampler) sample(level int, line string) (int, bool) {
+	every := s.every[level]
+	if every <= 1 {
+		return 0, true
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastPrune) > s.expire/10 {
+		for key, seen := range s.lines {
+			if now.Sub(seen.lastSeen) > s.expire {
+				delete(s.lines, key)
+			}
+		}
+		s.lastPrune = now
+	}
+	seen, ok := s.lines[line]
+	if !ok {
+		s.lines[line] = &sampledLine{count: 1, lastSeen: now}
+		return 0, true
+	}
+	seen.count++
+	seen.lastSeen = now
+	if seen.count%every != 0 {
+		return 0, false
+	}
+	return every - 1, true
+}
+
+// samplingSink is a logr.LogSink dropping the lines its sampler drops.
+type samplingSink struct {
+	sink    logr.LogSink
+	sampler *logSampler
+	// prefix identifies the lines of this sink: its name and values.
+	prefix string
+}
+
+// newSampledLogger wraps log in a sink applying sampling.
+func newSampledLogger(log logr.Logger, sampling *LogSampling) logr.Logger {
+	expire := sampling.Expire
+	if expire == 0 {
+		expire = 10 * time.Minute
+	}
+	sink := log.GetSink()
+	if sink == nil {
+		return log
+	}
+	// the caller is one frame further out
+	if callDepthSink, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = callDepthSink.WithCallDepth(1)
+	}
+	return logr.New(&samplingSink{
+		sink:    sink,
+		sampler: &logSampler{every: sampling.Every, expire: expire, lines: map[string]*sampledLine{}},
+	})
+}
+
+// Init does nothing, the wrapped sink was initialized by its own logger.
+func (s *samplingSink) Init(logr.RuntimeInfo) {}
+
+func (s *samplingSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *samplingSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	dropped, ok := s.sampler.sample(level, s.prefix+"|"+msg+"|"+formatValues(keysAndValues))
+	if !ok {
+		return
+	}
+	if dropped > 0 {
+		keysAndValues = append(keysAndValues, "repeated", dropped)
+	}
+	s.sink.Info(level, msg, keysAndValues...)
+}
+
+func (s *samplingSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.sink.Error(err, msg, keysAndValues...)
+}
+
+func (s *samplingSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &samplingSink{sink: s.sink.WithValues(keysAndValues...), sampler: s.sampler, prefix: s.prefix + "|" + formatValues(keysAndValues)}
+}
+
+func (s *samplingSink) WithName(name string) logr.LogSink {
+	return &samplingSink{sink: s.sink.WithName(name), sampler: s.sampler, prefix: s.prefix + "/" + name}
+}
+
+func (s *samplingSink) WithCallDepth(depth int) logr.LogSink {
+	callDepthSink, ok := s.sink.(logr.CallDepthLogSink)
+	if !ok {
+		return s
+	}
+	return &samplingSink{sink: callDepthSink.WithCallDepth(depth), sampler: s.sampler, prefix: s.prefix}
+}
+
+func formatValues(keysAndValues []interface{}) string {
+	var b strings.Builder
+	for _, v := range keysAndValues {
+		fmt.Fprintf(&b, "%v,", v)
+	}
+	return b.String()
+}
@@ -2,67 +2,571 @@ package annotationscale
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
-	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/arcosx/annotationscale/api/v1alpha1"
 )
 
 type AnnotationScaleManager struct {
-	log     *logr.Logger
-	manager manager.Manager
-	config  *rest.Config
-	stopCh  chan struct{}
-	mutex   sync.Mutex
-	stopped bool
+	log        *logr.Logger
+	manager    manager.Manager
+	mgrOptions manager.Options
+	config     *rest.Config
+	options    Options
+	stopCh     chan struct{}
+	mutex      sync.Mutex
+	stopped    bool
+	// used is set once manager has been started; a controller-runtime
+	// manager cannot be started twice, so the next run creates a new one.
+	used    bool
+	running bool
 }
 
-func NewAnnotationScaleManager(log *logr.Logger, match *metav1.LabelSelector, config *rest.Config, syncPeriod time.Duration) (*AnnotationScaleManager, error) {
+var ErrorManagerRunning error = errors.New("manager is already running")
 
-	labelMap, err := metav1.LabelSelectorAsMap(match)
-	if err != nil {
-		log.Error(err, "could not create label map from match")
-		return nil, err
+type Options struct {
+	ReconcilerOptions
+	// MetricsBindAddress serves the controller metrics, "0" disables them.
+	MetricsBindAddress string
+	// LeaderElection lets several replicas of the controller run with only
+	// one of them reconciling.
+	LeaderElection *LeaderElectionOptions
+	// Webhook serves the plan defaulting webhook at DefaultingWebhookPath.
+	Webhook *WebhookOptions
+	// CacheNamespaces scopes the cache to the listed namespaces instead of
+	// the whole cluster.
+	CacheNamespaces []string
+	// ClientRateLimit overrides the QPS and Burst of the config. Without it
+	// a config with a QPS keeps it, others get 20 QPS and a burst of 30.
+	ClientRateLimit *ClientRateLimit
+	// UserAgent overrides the user agent of the config, DefaultUserAgent when
+	// the config has none.
+	UserAgent string
+	// Impersonate makes the manager act as another user, e.g. a service
+	// account the audit policy attributes replica changes to.
+	Impersonate *rest.ImpersonationConfig
+}
+
+type LeaderElectionOptions struct {
+	// ID is the name of the Lease, "annotationscale.arcosx.io" by default.
+	ID string
+	// Namespace of the Lease, the in-cluster namespace by default.
+	Namespace string
+	// Zero durations keep the controller-runtime defaults.
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+type WebhookOptions struct {
+	Port    int
+	Host    string
+	CertDir string
+}
+
+type Option func(*Options)
+
+// WithScaleTarget drives any resource implementing the scale subresource,
+// e.g. ReplicaSets, CloneSets or custom workloads.
+func WithScaleTarget(gvk schema.GroupVersionKind) Option {
+	return func(o *Options) {
+		o.ScaleTarget = &gvk
+	}
+}
+
+// WithArgoRollouts drives the replicas of Argo Rollouts instead of
+// Deployments, e.g. to ramp capacity of Rollouts that canary their images.
+func WithArgoRollouts() Option {
+	return func(o *Options) {
+		o.ArgoRollouts = true
+	}
+}
+
+// WithKnative steps the min-scale of Knative Services instead of the replicas
+// of Deployments, e.g. to pre-warm serverless services before a traffic event.
+func WithKnative(knative KnativeOptions) Option {
+	return func(o *Options) {
+		o.Knative = &knative
+	}
+}
+
+// WithCloneSets drives OpenKruise CloneSets instead of Deployments.
+func WithCloneSets() Option {
+	return func(o *Options) {
+		o.CloneSets = true
+	}
+}
+
+// WithHPAs steps the minReplicas of HorizontalPodAutoscalers instead of the
+// replicas of Deployments, with the plan annotations on the HPA.
+func WithHPAs(hpas HPAOptions) Option {
+	return func(o *Options) {
+		o.HPAs = &hpas
+	}
+}
+
+// WithScalePlans enables the ScalePlan CRD as an alternative to annotations.
+func WithScalePlans() Option {
+	return func(o *Options) {
+		o.ScalePlans = true
+	}
+}
+
+// WithScaleGroups enables the ScaleGroup CRD, plans spanning several
+// Deployments scaled in lockstep.
+func WithScaleGroups() Option {
+	return func(o *Options) {
+		o.ScaleGroups = true
+	}
+}
+
+// WithAnnotationFormat selects how plans are written back to annotations.
+// Plans in either format are always readable.
+func WithAnnotationFormat(format AnnotationFormat) Option {
+	return func(o *Options) {
+		o.AnnotationFormat = format
 	}
+}
+
+// WithDefaultingWebhook serves a mutating webhook that fills in missing plan
+// fields, so users can apply only steps.
+func WithDefaultingWebhook(webhookOptions WebhookOptions) Option {
+	return func(o *Options) {
+		o.Webhook = &webhookOptions
+	}
+}
+
+// WithBlackoutWindows stops every plan from advancing during windows.
+func WithBlackoutWindows(windows ...Window) Option {
+	return func(o *Options) {
+		o.BlackoutWindows = append(o.BlackoutWindows, windows...)
+	}
+}
+
+// WithHistoryLimit keeps the last limit finished plans of each workload in
+// HistoryAnnotationKey. A negative limit disables the history.
+func WithHistoryLimit(limit int) Option {
+	return func(o *Options) {
+		o.HistoryLimit = limit
+	}
+}
+
+// WithHooks calls hooks on the plan transitions of every workload.
+func WithHooks(hooks Hooks) Option {
+	return func(o *Options) {
+		o.Hooks = hooks
+	}
+}
+
+// WithPrometheus sets the Prometheus server step analyses query.
+func WithPrometheus(address string) Option {
+	return func(o *Options) {
+		o.PrometheusAddress = address
+	}
+}
+
+// WithResourceGate keeps plans from advancing while the average CPU or memory
+// utilization of a workload's pods is above the gate's percentages.
+func WithResourceGate(gate ResourceGate) Option {
+	return func(o *Options) {
+		o.ResourceGate = &gate
+	}
+}
+
+// WithKEDA pauses KEDA ScaledObjects targeting a workload at the step
+// replicas while its plan is in flight, so KEDA does not fight the plan.
+func WithKEDA() Option {
+	return func(o *Options) {
+		o.KEDA = true
+	}
+}
+
+// WithCapacityCheck pauses plans whose next step would not fit on the nodes
+// the pods can run on.
+func WithCapacityCheck(check CapacityCheck) Option {
+	return func(o *Options) {
+		o.CapacityCheck = &check
+	}
+}
 
-	var mgr manager.Manager
-	var mgrCreateErr error
+// WithPodDeletionCost sets the pod-deletion-cost of the workload's pods with
+// cost before a step scales down, e.g. NewestPodsFirst.
+func WithPodDeletionCost(cost PodDeletionCostFunc) Option {
+	return func(o *Options) {
+		o.PodDeletionCost = cost
+	}
+}
+
+// WithMaxConcurrentPlans lets at most max plans run at once across the
+// manager, further plans are queued at their first step.
+func WithMaxConcurrentPlans(max int) Option {
+	return func(o *Options) {
+		o.MaxConcurrentPlans = max
+	}
+}
+
+// WithRampLimit delays steps once the plans of the manager, or of a
+// namespace, added more replicas in the last minute than limit allows.
+func WithRampLimit(limit RampLimit) Option {
+	return func(o *Options) {
+		o.RampLimit = &limit
+	}
+}
+
+// WithNamespaceRateLimits bounds the reconciles of each namespace, requests
+// over the limit are requeued until the namespace has a token again.
+func WithNamespaceRateLimits(limits NamespaceRateLimits) Option {
+	return func(o *Options) {
+		o.NamespaceRateLimits = &limits
+	}
+}
+
+// WithNamespaces keeps the controllers out of the namespaces filter does not
+// allow, e.g. Exclude: []string{"kube-system"}.
+func WithNamespaces(filter NamespaceFilter) Option {
+	return func(o *Options) {
+		o.Namespaces = &filter
+	}
+}
+
+// WithCacheNamespaces scopes the manager's cache, and so the workloads it
+// manages, to namespaces. It reduces memory, and the controller only needs
+// namespaced permissions for the workloads.
+func WithCacheNamespaces(namespaces ...string) Option {
+	return func(o *Options) {
+		o.CacheNamespaces = append(o.CacheNamespaces, namespaces...)
+	}
+}
+
+// WithClientRateLimit sets the QPS and burst of the requests of the manager
+// to the API server, e.g. to manage thousands of deployments.
+func WithClientRateLimit(qps float32, burst int) Option {
+	return func(o *Options) {
+		o.ClientRateLimit = &ClientRateLimit{QPS: qps, Burst: burst}
+	}
+}
+
+// WithUserAgent sets the user agent of the requests of the manager, so that
+// audit logs attribute them to the controller.
+func WithUserAgent(userAgent string) Option {
+	return func(o *Options) {
+		o.UserAgent = userAgent
+	}
+}
+
+// WithImpersonation makes the requests of the manager on behalf of the user
+// of impersonate, which the identity of the config must be allowed to
+// impersonate.
+func WithImpersonation(impersonate rest.ImpersonationConfig) Option {
+	return func(o *Options) {
+		o.Impersonate = &impersonate
+	}
+}
+
+// WithStateStore keeps plans in the store newStore builds instead of the
+// workloads' annotations, e.g. ConfigMapStateStore.
+func WithStateStore(newStore NewStateStoreFunc) Option {
+	return func(o *Options) {
+		o.StateStore = newStore
+	}
+}
+
+// WithClock replaces the wall clock of the reconciler, e.g. with a
+// FakeClock in tests.
+func WithClock(clock Clock) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+// WithShadow runs the controllers observe-only: plans are evaluated and the
+// writes they would make are logged and counted in
+// annotationscale_shadow_writes_total, but nothing is written.
+func WithShadow() Option {
+	return func(o *Options) {
+		o.Shadow = true
+	}
+}
+
+// WithExternalReplicasPolicy sets what happens to a plan when its workload
+// is scaled by someone else mid-plan.
+func WithExternalReplicasPolicy(policy ExternalReplicasPolicy) Option {
+	return func(o *Options) {
+		o.ExternalReplicas = policy
+	}
+}
+
+// WithPauseOnRollout holds plans while their Deployment rolls out a new pod
+// template, e.g. after an image update, and resumes them with a new step
+// deadline once the rollout completed.
+func WithPauseOnRollout() Option {
+	return func(o *Options) {
+		o.PauseOnRollout = true
+	}
+}
+
+// WithOwnershipLease makes this manager claim a Lease per workload before
+// driving its plan, so that managers with overlapping selectors take turns
+// instead of patching the same workloads.
+func WithOwnershipLease(ownershipLease OwnershipLease) Option {
+	return func(o *Options) {
+		o.OwnershipLease = &ownershipLease
+	}
+}
+
+// WithForeignControllers replaces DefaultForeignControllers, the workloads
+// of other progressive delivery controllers the reconciler leaves alone. An
+// empty ForeignControllers manages every workload.
+func WithForeignControllers(foreignControllers ForeignControllers) Option {
+	return func(o *Options) {
+		o.ForeignControllers = &foreignControllers
+	}
+}
+
+// WithFrozen starts the manager with all plans frozen, see Freeze.
+func WithFrozen(reason string) Option {
+	return func(o *Options) {
+		if o.Freeze == nil {
+			o.Freeze = NewFreeze()
+		}
+		o.Freeze.Freeze(reason)
+	}
+}
+
+// WithFreezeConfigMap freezes all plans while the FreezeConfigMapName
+// ConfigMap in namespace has FreezeAnnotationKey.
+func WithFreezeConfigMap(namespace string) Option {
+	return func(o *Options) {
+		o.FreezeConfigMapNamespace = namespace
+	}
+}
+
+// WithNamespacePause lets namespace owners suspend all plans in their
+// namespace with NamespacePausedAnnotationKey, e.g. during an incident.
+func WithNamespacePause() Option {
+	return func(o *Options) {
+		o.NamespacePause = true
+	}
+}
 
+// WithFinalizer adds PlanFinalizer to workloads with a plan in flight, see
+// ReconcilerOptions.Finalizer.
+func WithFinalizer() Option {
+	return func(o *Options) {
+		o.Finalizer = true
+	}
+}
+
+// WithNotifier sends the plan starts, pauses, timeouts, errors and
+// completions of every workload to notifier, e.g. a SlackNotifier.
+func WithNotifier(notifier Notifier) Option {
+	return func(o *Options) {
+		o.Notifiers = append(o.Notifiers, notifier)
+	}
+}
+
+// WithCloudEvents sends a CloudEvent for every plan transition to sink, e.g.
+// an event bus or an audit pipeline.
+func WithCloudEvents(sink CloudEventsSink) Option {
+	return func(o *Options) {
+		o.CloudEvents = &sink
+	}
+}
+
+// WithTracing traces every reconcile, its patches and the steps of each plan
+// with tp, e.g. from NewOTLPTracerProvider.
+func WithTracing(tp trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = tp
+	}
+}
+
+// WithLogSampling logs only the first and every Nth of the identical lines
+// the reconcilers log at a verbosity, e.g. {2: 10, 5: 100}.
+func WithLogSampling(sampling LogSampling) Option {
+	return func(o *Options) {
+		o.LogSampling = &sampling
+	}
+}
+
+// WithRequeueBackoff requeues the workloads waiting on a step every
+// b.Interval, backing off up to b.MaxInterval while they do not change.
+func WithRequeueBackoff(b RequeueBackoff) Option {
+	return func(o *Options) {
+		o.Requeue = &b
+	}
+}
+
+// WithRateLimiter tunes the delays between retries of failed reconciles and
+// their overall rate.
+func WithRateLimiter(rateLimiter RateLimiterOptions) Option {
+	return func(o *Options) {
+		o.RateLimiter = &rateLimiter
+	}
+}
+
+// WithDrainTimeout gives the in-flight reconciles timeout to finish their
+// patches when the manager stops, so that a restart does not leave a
+// workload with its plan updated but not its replicas.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.DrainTimeout = timeout
+	}
+}
+
+// WithAvailability selects the replicas steps wait for, e.g. the ready
+// replicas instead of the available ones.
+func WithAvailability(criterion AvailabilityCriterion) Option {
+	return func(o *Options) {
+		o.Availability = criterion
+	}
+}
+
+// WithAvailableReplicas counts the available replicas of the workloads with
+// count, for workloads that report available replicas before they serve.
+func WithAvailableReplicas(count AvailableReplicasFunc) Option {
+	return func(o *Options) {
+		o.AvailableReplicas = count
+	}
+}
+
+// WithWaitForTerminatingPods holds steps, up to their deadline, until the
+// terminating pods of the workload are gone, e.g. so that a scale down step
+// is only done once the removed pods released their resources.
+func WithWaitForTerminatingPods() Option {
+	return func(o *Options) {
+		o.WaitForTerminatingPods = true
+	}
+}
+
+// WithPodReadiness counts only the pods passing the checks of podReadiness
+// toward the available replicas of steps, e.g. so that a fast ramp waits for
+// the sidecars of the new pods.
+func WithPodReadiness(podReadiness PodReadiness) Option {
+	return func(o *Options) {
+		o.PodReadiness = &podReadiness
+	}
+}
+
+// WithLeaderElection enables leader election so that multiple controller
+// replicas never patch the same workloads concurrently.
+func WithLeaderElection(leaderElectionOptions LeaderElectionOptions) Option {
+	return func(o *Options) {
+		o.LeaderElection = &leaderElectionOptions
+	}
+}
+
+// WithMetricsBindAddress serves Prometheus metrics at addr, e.g. ":8080".
+func WithMetricsBindAddress(addr string) Option {
+	return func(o *Options) {
+		o.MetricsBindAddress = addr
+	}
+}
+
+// NewAnnotationScaleManager creates a manager for the workloads matching
+// match. log may use any logr sink, e.g. zapr, klogr or logrusr, and is also
+// the logger of the underlying controller-runtime manager; nil uses the
+// controller-runtime global logger.
+func NewAnnotationScaleManager(log *logr.Logger, match *metav1.LabelSelector, config *rest.Config, syncPeriod time.Duration, opts ...Option) (*AnnotationScaleManager, error) {
+	if log == nil {
+		defaultLog := ctrllog.Log.WithName("annotationscale")
+		log = &defaultLog
+	}
+	options := Options{
+		MetricsBindAddress: "0",
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Freeze == nil {
+		options.Freeze = NewFreeze()
+	}
+
+	labelMap, err := metav1.LabelSelectorAsMap(match)
 	if err != nil {
-		log.Error(err, "could not create manager")
+		log.Error(err, "could not create label map from match")
 		return nil, err
 	}
 
+	mgrOptions := manager.Options{
+		MetricsBindAddress: options.MetricsBindAddress,
+		Logger:             *log,
+	}
+	var selectors cache.SelectorsByObject
 	if len(labelMap) != 0 {
-		mgr, mgrCreateErr = manager.New(config, manager.Options{
-			SyncPeriod:         &syncPeriod,
-			MetricsBindAddress: "0",
-			NewCache: cache.BuilderWithOptions(cache.Options{
-				SelectorsByObject: cache.SelectorsByObject{
-					&appsv1.Deployment{}: {
-						Label: labels.SelectorFromSet(labelMap),
-					},
-					&appsv1.ReplicaSet{}: {
-						Label: labels.SelectorFromSet(labelMap),
-					},
-					&corev1.Pod{}: {
-						Label: labels.SelectorFromSet(labelMap),
-					},
-				},
-			})})
-	} else {
-		mgr, mgrCreateErr = manager.New(config, manager.Options{
-			MetricsBindAddress: "0",
+		mgrOptions.SyncPeriod = &syncPeriod
+		selectors = selectorsByObject(&options, labels.SelectorFromSet(labelMap))
+		mgrOptions.NewCache = cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: selectors,
 		})
 	}
+	if len(options.CacheNamespaces) != 0 {
+		mgrOptions.NewCache = multiNamespaceCache(options.CacheNamespaces, selectors)
+	}
+	if le := options.LeaderElection; le != nil {
+		mgrOptions.LeaderElection = true
+		mgrOptions.LeaderElectionID = le.ID
+		if mgrOptions.LeaderElectionID == "" {
+			mgrOptions.LeaderElectionID = "annotationscale.arcosx.io"
+		}
+		mgrOptions.LeaderElectionNamespace = le.Namespace
+		mgrOptions.LeaderElectionReleaseOnCancel = true
+		if le.LeaseDuration != 0 {
+			mgrOptions.LeaseDuration = &le.LeaseDuration
+		}
+		if le.RenewDeadline != 0 {
+			mgrOptions.RenewDeadline = &le.RenewDeadline
+		}
+		if le.RetryPeriod != 0 {
+			mgrOptions.RetryPeriod = &le.RetryPeriod
+		}
+	}
+	if options.Webhook != nil {
+		mgrOptions.Port = options.Webhook.Port
+		mgrOptions.Host = options.Webhook.Host
+		mgrOptions.CertDir = options.Webhook.CertDir
+	}
+	if options.ScalePlans || options.ScaleGroups {
+		scheme := runtime.NewScheme()
+		if err := clientgoscheme.AddToScheme(scheme); err != nil {
+			return nil, err
+		}
+		if err := v1alpha1.AddToScheme(scheme); err != nil {
+			return nil, err
+		}
+		mgrOptions.Scheme = scheme
+	}
+
+	drainTimeout := options.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = DefaultDrainTimeout
+	}
+	// the reconciles started before the stop get drainTimeout, give the
+	// controllers a little longer to return
+	gracefulShutdownTimeout := drainTimeout + 5*time.Second
+	mgrOptions.GracefulShutdownTimeout = &gracefulShutdownTimeout
+
+	config = clientConfig(*log, config, &options)
+	mgr, mgrCreateErr := manager.New(config, mgrOptions)
 
 	if mgrCreateErr != nil {
 		log.Error(mgrCreateErr, "could not create manager with ")
@@ -70,45 +574,120 @@ func NewAnnotationScaleManager(log *logr.Logger, match *metav1.LabelSelector, co
 	}
 
 	return &AnnotationScaleManager{
-		manager: mgr,
-		config:  config,
-		log:     log,
-		stopCh:  make(chan struct{}),
-		stopped: false,
+		manager:    mgr,
+		mgrOptions: mgrOptions,
+		config:     config,
+		options:    options,
+		log:        log,
 	}, nil
 }
 
+// Freeze stops all plans from advancing until Unfreeze, across runs.
+func (m *AnnotationScaleManager) Freeze(reason string) {
+	m.log.Info("freeze plans", "reason", reason)
+	m.options.Freeze.Freeze(reason)
+}
+
+func (m *AnnotationScaleManager) Unfreeze() {
+	m.log.Info("unfreeze plans")
+	m.options.Freeze.Unfreeze()
+}
+
 func (m *AnnotationScaleManager) Start() error {
-	ctx, cancel := context.WithCancel(context.Background())
+	return m.Run(context.Background())
+}
+
+// Run runs the controllers until ctx is cancelled or Stop is called. Once it
+// returns the manager can be run again, e.g. after a configuration reload.
+func (m *AnnotationScaleManager) Run(ctx context.Context) error {
+	mgr, stopCh, err := m.prepareRun()
+	if err != nil {
+		return err
+	}
+	defer m.finishRun()
+
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	go func() {
 		select {
 		case <-ctx.Done():
-		case <-m.stopCh:
+		case <-stopCh:
 			cancel()
 		}
 	}()
-	err := builder.
-		ControllerManagedBy(m.manager).
-		For(&appsv1.Deployment{}).
-		Owns(&appsv1.ReplicaSet{}).
-		Owns(&corev1.Pod{}).
-		Complete(&DeploymentReconciler{log: m.log})
-	if err != nil {
-		m.log.Error(err, "could not create controller")
+	reconcilerOptions := m.options.ReconcilerOptions
+	reconcilerOptions.Log = m.log
+	reconcilerOptions.DefaultingWebhook = m.options.Webhook != nil
+	if err := AddToManager(mgr, reconcilerOptions); err != nil {
 		return err
 	}
-	if err := m.manager.Start(ctx); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		m.log.Error(err, "could not start manager")
 		return err
 	}
 	return nil
 }
 
+func (m *AnnotationScaleManager) prepareRun() (manager.Manager, chan struct{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.running {
+		return nil, nil, ErrorManagerRunning
+	}
+	if m.used {
+		mgr, err := manager.New(m.config, m.mgrOptions)
+		if err != nil {
+			m.log.Error(err, "could not create manager")
+			return nil, nil, err
+		}
+		m.manager = mgr
+	}
+	m.used = true
+	m.running = true
+	m.stopCh = make(chan struct{})
+	return m.manager, m.stopCh, nil
+}
+
+// currentManager is the controller-runtime manager of the current or next run.
+func (m *AnnotationScaleManager) currentManager() manager.Manager {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.manager
+}
+
+// GetClient returns the client of the manager. Its reads are served by the
+// informer cache and block until the cache synced, so they only succeed while
+// the manager runs. A later run of the manager has a new client.
+func (m *AnnotationScaleManager) GetClient() client.Client {
+	return m.currentManager().GetClient()
+}
+
+// GetCache returns the informer cache of the manager, e.g. to add informers
+// before it starts. A later run of the manager has a new cache.
+func (m *AnnotationScaleManager) GetCache() cache.Cache {
+	return m.currentManager().GetCache()
+}
+
+// GetScheme returns the scheme of the manager, with the ScalePlan and
+// ScaleGroup types when they are enabled.
+func (m *AnnotationScaleManager) GetScheme() *runtime.Scheme {
+	return m.currentManager().GetScheme()
+}
+
+// finishRun re-arms Stop for the next run.
+func (m *AnnotationScaleManager) finishRun() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.running = false
+	m.stopped = false
+}
+
+// Stop stops the current run of the manager. It does nothing while the
+// manager is not running, the next Run starts normally.
 func (m *AnnotationScaleManager) Stop() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	if !m.stopped {
+	if m.running && !m.stopped {
 		m.stopped = true
 		close(m.stopCh)
 	}
@@ -119,3 +698,78 @@ func (m *AnnotationScaleManager) Stopping() bool {
 	defer m.mutex.Unlock()
 	return m.stopped
 }
+
+func selectorsByObject(options *Options, selector labels.Selector) cache.SelectorsByObject {
+	if options.HPAs != nil {
+		return cache.SelectorsByObject{
+			&autoscalingv2.HorizontalPodAutoscaler{}: {
+				Label: selector,
+			},
+		}
+	}
+	if options.CloneSets {
+		return cache.SelectorsByObject{
+			newUnstructured(CloneSetGVK): {
+				Label: selector,
+			},
+			&corev1.Pod{}: {
+				Label: selector,
+			},
+		}
+	}
+	if options.Knative != nil {
+		return cache.SelectorsByObject{
+			newUnstructured(KnativeServiceGVK): {
+				Label: selector,
+			},
+		}
+	}
+	if options.ArgoRollouts {
+		return cache.SelectorsByObject{
+			newUnstructured(RolloutGVK): {
+				Label: selector,
+			},
+			&appsv1.ReplicaSet{}: {
+				Label: selector,
+			},
+			&corev1.Pod{}: {
+				Label: selector,
+			},
+		}
+	}
+	if options.ScaleTarget != nil {
+		return cache.SelectorsByObject{
+			newUnstructured(*options.ScaleTarget): {
+				Label: selector,
+			},
+		}
+	}
+	return cache.SelectorsByObject{
+		&appsv1.Deployment{}: {
+			Label: selector,
+		},
+		&appsv1.ReplicaSet{}: {
+			Label: selector,
+		},
+		&corev1.Pod{}: {
+			Label: selector,
+		},
+	}
+}
+
+// multiNamespaceCache is a cache of namespaces, each restricted by selectors,
+// with a cluster-wide cache for cluster scoped objects.
+func multiNamespaceCache(namespaces []string, selectors cache.SelectorsByObject) cache.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		if selectors != nil {
+			opts.SelectorsByObject = selectors
+		}
+		return cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+	}
+}
+
+func newUnstructured(gvk schema.GroupVersionKind) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
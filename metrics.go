@@ -0,0 +1,117 @@
+package annotationscale
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	stepsCompletedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "annotationscale_steps_completed_total",
+		Help: "Number of plan steps that reached their replica count.",
+	}, []string{"cluster", "namespace", "deployment"})
+	stepDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "annotationscale_step_duration_seconds",
+		Help:    "Time from entering a step until it was available.",
+		Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{"cluster", "namespace", "deployment"})
+	plansActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "annotationscale_plans_active",
+		Help: "1 while a plan is in flight for the deployment, 0 otherwise.",
+	}, []string{"cluster", "namespace", "deployment"})
+	planTimeoutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "annotationscale_plan_timeouts_total",
+		Help: "Number of plans that entered the Timeout state.",
+	}, []string{"cluster", "namespace", "deployment"})
+	reconcileErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "annotationscale_reconcile_errors_total",
+		Help: "Number of reconciles that returned an error.",
+	}, []string{"cluster", "namespace", "deployment"})
+	patchConflictsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "annotationscale_patch_conflicts_total",
+		Help: "Number of workload scale updates retried after a conflict.",
+	}, []string{"cluster", "namespace", "deployment"})
+	namespaceThrottledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "annotationscale_namespace_throttled_total",
+		Help: "Number of reconciles delayed by the namespace rate limit.",
+	}, []string{"cluster", "namespace"})
+	shadowWritesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "annotationscale_shadow_writes_total",
+		Help: "Number of writes skipped in shadow mode.",
+	}, []string{"cluster", "namespace", "verb"})
+	planInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "annotationscale_plan_info",
+		Help: "1 for the ID of the current plan of the deployment, to join with the other metrics.",
+	}, []string{"cluster", "namespace", "deployment", "plan_id"})
+	freezeActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "annotationscale_freeze_active",
+		Help: "1 while plans are frozen, 0 otherwise.",
+	}, []string{"cluster"})
+	clientRateLimiterDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "annotationscale_client_rate_limiter_duration_seconds",
+		Help:    "Time API requests waited for the client-side rate limit.",
+		Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"verb", "host"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		stepsCompletedTotal,
+		stepDurationSeconds,
+		plansActive,
+		planTimeoutsTotal,
+		reconcileErrorsTotal,
+		patchConflictsTotal,
+		namespaceThrottledTotal,
+		shadowWritesTotal,
+		planInfo,
+		freezeActive,
+		clientRateLimiterDurationSeconds,
+	)
+}
+
+// observeTransition records the metrics for a persisted change from before
+// to after. cluster is empty unless run by a MultiClusterManager.
+func observeTransition(cluster string, workload *Workload, before, after *ScaleAnnotation) {
+	namespace, name := workload.Object.GetNamespace(), workload.Object.GetName()
+
+	stepCompleted := false
+	switch before.CurrentStepState {
+	case StepStateUpgrade:
+		stepCompleted = after.CurrentStepState == StepStateReady || after.CurrentStepState == StepStateCompleted
+	case StepStatePaused:
+		stepCompleted = after.CurrentStepState == StepStatePaused && workload.Paused && !after.LastUpdateTime.Equal(before.LastUpdateTime)
+	}
+	if stepCompleted {
+		stepsCompletedTotal.WithLabelValues(cluster, namespace, name).Inc()
+		stepDurationSeconds.WithLabelValues(cluster, namespace, name).Observe(after.LastUpdateTime.Sub(before.LastUpdateTime).Seconds())
+	}
+
+	if after.CurrentStepState == StepStateTimeout && before.CurrentStepState != StepStateTimeout {
+		planTimeoutsTotal.WithLabelValues(cluster, namespace, name).Inc()
+	}
+
+	if before.ID != after.ID && before.ID != "" {
+		planInfo.DeleteLabelValues(cluster, namespace, name, before.ID)
+	}
+	if after.ID != "" {
+		planInfo.WithLabelValues(cluster, namespace, name, after.ID).Set(1)
+	}
+
+	switch after.CurrentStepState {
+	case StepStateUpgrade, StepStatePaused, StepStateReady:
+		plansActive.WithLabelValues(cluster, namespace, name).Set(1)
+	default:
+		plansActive.WithLabelValues(cluster, namespace, name).Set(0)
+	}
+}
+
+func forgetWorkloadMetrics(cluster, namespace, name string) {
+	stepsCompletedTotal.DeleteLabelValues(cluster, namespace, name)
+	stepDurationSeconds.DeleteLabelValues(cluster, namespace, name)
+	plansActive.DeleteLabelValues(cluster, namespace, name)
+	planTimeoutsTotal.DeleteLabelValues(cluster, namespace, name)
+	reconcileErrorsTotal.DeleteLabelValues(cluster, namespace, name)
+	patchConflictsTotal.DeleteLabelValues(cluster, namespace, name)
+	planInfo.DeletePartialMatch(prometheus.Labels{"cluster": cluster, "namespace": namespace, "deployment": name})
+}
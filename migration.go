@@ -0,0 +1,81 @@
+package annotationscale
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ScaleAnnotationSchemaVersion is the layout written by this version.
+//
+//	1: bare keys, max wait stored as max_wait_available_time, no schema_version
+//	2: schema_version key, max wait stored as max_wait_available_second
+//	3: last_update_time and step_available_time in RFC3339 instead of unix seconds
+const ScaleAnnotationSchemaVersion = 3
+
+var ErrorScaleAnnotationSchemaVersion error = errors.New("unsupported schema_version")
+
+// scaleAnnotationMigrations upgrades bare-key annotations from the version
+// used as key to the next one.
+var scaleAnnotationMigrations = map[int]func(annotations map[string]string){
+	1: func(annotations map[string]string) {
+		if maxWaitAvailableTime, ok := annotations["max_wait_available_time"]; ok {
+			annotations["max_wait_available_second"] = maxWaitAvailableTime
+			delete(annotations, "max_wait_available_time")
+		}
+	},
+	2: func(annotations map[string]string) {
+		for _, key := range []string{"last_update_time", "step_available_time"} {
+			if t, err := parseAnnotationTime(annotations[key]); err == nil {
+				annotations[key] = formatAnnotationTime(t)
+			}
+		}
+	},
+}
+
+// migrateScaleAnnotation returns annotations upgraded to the current schema
+// version. The returned map is a copy whenever a migration was applied.
+func migrateScaleAnnotation(annotations map[string]string) (map[string]string, error) {
+	if _, ok := annotations["steps"]; !ok {
+		// not a plan, nothing to migrate
+		return annotations, nil
+	}
+	version := 1
+	if schemaVersion, ok := annotations["schema_version"]; ok {
+		schemaVersionInt, err := strconv.Atoi(schemaVersion)
+		if err != nil {
+			return nil, err
+		}
+		version = schemaVersionInt
+	}
+	if version > ScaleAnnotationSchemaVersion || version < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrorScaleAnnotationSchemaVersion, version)
+	}
+	if version == ScaleAnnotationSchemaVersion {
+		return annotations, nil
+	}
+
+	migrated := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		migrated[key] = value
+	}
+	for ; version < ScaleAnnotationSchemaVersion; version++ {
+		scaleAnnotationMigrations[version](migrated)
+	}
+	migrated["schema_version"] = strconv.Itoa(ScaleAnnotationSchemaVersion)
+	return migrated, nil
+}
+
+// migrateScaleAnnotationJSON checks the version of a plan read from
+// PlanAnnotationKey. The JSON layout has not changed since it was introduced
+// in version 2, so plans without schema_version are taken as version 2.
+func migrateScaleAnnotationJSON(scaleAnnotation *ScaleAnnotation) error {
+	if scaleAnnotation.SchemaVersion == 0 {
+		scaleAnnotation.SchemaVersion = 2
+	}
+	if scaleAnnotation.SchemaVersion > ScaleAnnotationSchemaVersion {
+		return fmt.Errorf("%w: %d", ErrorScaleAnnotationSchemaVersion, scaleAnnotation.SchemaVersion)
+	}
+	scaleAnnotation.SchemaVersion = ScaleAnnotationSchemaVersion
+	return nil
+}
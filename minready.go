@@ -0,0 +1,58 @@
+package annotationscale
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// OriginalMinReadySecondsAnnotationKey keeps the spec.minReadySeconds of a
+// Deployment while a step overrides it with Step.MinReadySeconds.
+const OriginalMinReadySecondsAnnotationKey = "annotationscale.arcosx.io/original-min-ready-seconds"
+
+// syncMinReadySeconds sets spec.minReadySeconds of a Deployment to the
+// Step.MinReadySeconds of the current step, and restores the original value
+// once a step without it is entered or the plan finished. It returns true
+// when it patched the Deployment, through patchWorkload like the replicas.
+func (r *DeploymentReconciler) syncMinReadySeconds(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) (bool, error) {
+	deployment, ok := workload.Object.(*appsv1.Deployment)
+	if !ok {
+		return false, nil
+	}
+	var want *int32
+	index := scaleAnnotation.CurrentStepIndex
+	if index >= 1 && index <= len(scaleAnnotation.Steps) &&
+		scaleAnnotation.CurrentStepState != StepStateCompleted && scaleAnnotation.CurrentStepState != StepStateAborted {
+		want = scaleAnnotation.Steps[index-1].MinReadySeconds
+	}
+	original, overridden := deployment.Annotations[OriginalMinReadySecondsAnnotationKey]
+
+	// the value and the original are applied together, an update never loses
+	// the original
+	annotations := copyAnnotations(deployment.Annotations)
+	switch {
+	case want != nil && *want != deployment.Spec.MinReadySeconds:
+		if !overridden {
+			annotations[OriginalMinReadySecondsAnnotationKey] = strconv.Itoa(int(deployment.Spec.MinReadySeconds))
+		}
+		logger.V(2).Info("override minReadySeconds", "minReadySeconds", *want, "from", deployment.Spec.MinReadySeconds)
+		minReadySeconds := *want
+		workload.MinReadySeconds = &minReadySeconds
+	case want == nil && overridden:
+		minReadySeconds, err := strconv.ParseInt(original, 10, 32)
+		if err != nil {
+			logger.Error(err, "invalid original minReadySeconds, keep the current one", "original", original)
+			minReadySeconds = int64(deployment.Spec.MinReadySeconds)
+		}
+		logger.V(2).Info("restore minReadySeconds", "minReadySeconds", minReadySeconds)
+		delete(annotations, OriginalMinReadySecondsAnnotationKey)
+		restored := int32(minReadySeconds)
+		workload.MinReadySeconds = &restored
+	default:
+		return false, nil
+	}
+	deployment.SetAnnotations(annotations)
+	return true, r.patchWorkload(ctx, logger, workload)
+}
@@ -8,8 +8,45 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// PlanAnnotationKey holds the whole ScaleAnnotation as JSON when the JSON
+// annotation format is used.
+const PlanAnnotationKey = "annotationscale.arcosx.io/plan"
+
+type AnnotationFormat string
+
+const (
+	// AnnotationFormatKeys writes one bare annotation key per field.
+	AnnotationFormatKeys AnnotationFormat = "keys"
+	// AnnotationFormatJSON writes a single JSON blob under PlanAnnotationKey.
+	AnnotationFormatJSON AnnotationFormat = "json"
+)
+
+var legacyAnnotationKeys = []string{
+	"steps",
+	"current_step_index",
+	"current_step_state",
+	"message",
+	"max_wait_available_time",
+	"max_wait_available_second",
+	"max_unavailable_replicas",
+	"last_update_time",
+	"target_replicas",
+	"direction",
+	"step_available_time",
+	"blackout_windows",
+	"service",
+	"completion",
+	"handed_off",
+	"transitions",
+	"plan_id",
+	"original_replicas",
+	"schema_version",
+	StepsEncodingKey,
+}
+
 var (
 	ErrorScaleAnnotationParseSteps            error = errors.New("not include steps")
 	ErrorScaleAnnotationParseCurrentStepIndex error = errors.New("not include current_step_index")
@@ -17,6 +54,7 @@ var (
 )
 
 type ScaleAnnotation struct {
+	SchemaVersion          int       `json:"schema_version,omitempty"`
 	Steps                  []Step    `json:"steps,omitempty"`
 	CurrentStepIndex       int       `json:"current_step_index,omitempty"`
 	CurrentStepState       StepState `json:"current_step_state,omitempty"`
@@ -24,6 +62,30 @@ type ScaleAnnotation struct {
 	MaxWaitAvailableSecond int       `json:"max_wait_available_second,omitempty"`
 	MaxUnavailableReplicas int       `json:"max_unavailable_replicas,omitempty"`
 	LastUpdateTime         time.Time `json:"last_update_time,omitempty"`
+	// TargetReplicas is the replica count percentage steps are relative to.
+	TargetReplicas int32 `json:"target_replicas,omitempty"`
+	// Direction, when Up or Down, requires the steps to only scale that way.
+	Direction Direction `json:"direction,omitempty"`
+	// StepAvailableTime is when the current step became available, set while
+	// the step is held for Step.HoldSeconds.
+	StepAvailableTime time.Time `json:"step_available_time,omitempty"`
+	// BlackoutWindows are times during which the plan does not advance.
+	BlackoutWindows []Window `json:"blackout_windows,omitempty"`
+	// Service, when set, must list the workload's pods as ready endpoints
+	// before a step is done.
+	Service string `json:"service,omitempty"`
+	// Completion is applied once the plan completed, HandedOff is set after.
+	Completion *CompletionPolicy `json:"completion,omitempty"`
+	HandedOff  bool              `json:"handed_off,omitempty"`
+	// ID correlates the logs, Events, metrics and notifications of the plan,
+	// set when the controller adopts it.
+	ID string `json:"plan_id,omitempty"`
+	// Transitions are the last MaxTransitionRecords changes of the step or
+	// state, oldest first.
+	Transitions []TransitionRecord `json:"transitions,omitempty"`
+	// OriginalReplicas are the replicas of the workload before the plan,
+	// recorded when it is applied or adopted.
+	OriginalReplicas *int32 `json:"original_replicas,omitempty"`
 }
 
 func (sa *ScaleAnnotation) String() string {
@@ -31,13 +93,68 @@ func (sa *ScaleAnnotation) String() string {
 		sa.Steps, sa.CurrentStepIndex, sa.CurrentStepState, sa.Message, sa.MaxWaitAvailableSecond, sa.MaxUnavailableReplicas, sa.LastUpdateTime, sa.StepDeadline())
 }
 
+// StepDeadline is when the current step times out. A step's own
+// MaxWaitAvailableSecond takes precedence over the plan's.
 func (sa *ScaleAnnotation) StepDeadline() time.Time {
-	deadline := sa.LastUpdateTime.Add(time.Duration(sa.MaxWaitAvailableSecond) * time.Second)
+	maxWaitAvailableSecond := sa.MaxWaitAvailableSecond
+	if sa.CurrentStepIndex >= 1 && sa.CurrentStepIndex <= len(sa.Steps) {
+		if stepMaxWait := sa.Steps[sa.CurrentStepIndex-1].MaxWaitAvailableSecond; stepMaxWait > 0 {
+			maxWaitAvailableSecond = stepMaxWait
+		}
+	}
+	deadline := sa.LastUpdateTime.Add(time.Duration(maxWaitAvailableSecond) * time.Second)
 	return deadline
 }
 
+// StepExpired reports whether the current step passed its StepDeadline by
+// clock, the wall clock when nil.
+func (sa *ScaleAnnotation) StepExpired(clock Clock) bool {
+	if clock == nil {
+		clock = RealClock{}
+	}
+	return clock.Now().After(sa.StepDeadline())
+}
+
+// StepReplicas is the concrete replica count of the 1-based step index,
+// resolving Step.Percent against TargetReplicas (rounded up).
+func (sa *ScaleAnnotation) StepReplicas(index int) int32 {
+	step := sa.Steps[index-1]
+	if step.Percent > 0 && sa.TargetReplicas > 0 {
+		return int32((int64(sa.TargetReplicas)*int64(step.Percent) + 99) / 100)
+	}
+	return step.Replicas
+}
+
+// startStep records that the 1-based step index was (re)entered at t.
+func (sa *ScaleAnnotation) startStep(index int, t time.Time) {
+	sa.Steps[index-1].StartedAt = &t
+	sa.Steps[index-1].FinishedAt = nil
+	sa.Steps[index-1].AnalyzedAt = nil
+	sa.Steps[index-1].AnalysisFailures = 0
+	sa.Steps[index-1].ProbeSuccesses = 0
+	sa.Steps[index-1].DrainStartedAt = nil
+	sa.Steps[index-1].ApprovedBy = ""
+}
+
+// resetProgress clears what the controller recorded about the run of s, so
+// that it starts afresh in a new plan.
+func (s *Step) resetProgress() {
+	s.StartedAt, s.FinishedAt, s.Skipped = nil, nil, false
+	s.AnalyzedAt, s.AnalysisFailures, s.ProbeSuccesses, s.DrainStartedAt = nil, 0, 0, nil
+	s.ApprovedBy = ""
+}
+
+// finishStep records that the 1-based step index reached its replicas at t,
+// unless it already did.
+func (sa *ScaleAnnotation) finishStep(index int, t time.Time) {
+	if sa.Steps[index-1].FinishedAt == nil {
+		sa.Steps[index-1].FinishedAt = &t
+	}
+}
+
 func NewScaleAnnotation() ScaleAnnotation {
 	var scaleAnnotation ScaleAnnotation
+	scaleAnnotation.SchemaVersion = ScaleAnnotationSchemaVersion
 	scaleAnnotation.Message = ""
 	scaleAnnotation.MaxWaitAvailableSecond = 600
 	scaleAnnotation.MaxUnavailableReplicas = 0
@@ -46,38 +163,162 @@ func NewScaleAnnotation() ScaleAnnotation {
 }
 
 func SetDeploymentScaleAnnotation(deployment *appsv1.Deployment, scaleAnnotation *ScaleAnnotation) error {
-	fixedAnnotation, err := SetScaleAnnotation(deployment.Annotations, scaleAnnotation)
+	return SetObjectScaleAnnotation(deployment, scaleAnnotation)
+}
+
+func SetObjectScaleAnnotation(obj metav1.Object, scaleAnnotation *ScaleAnnotation) error {
+	fixedAnnotation, err := SetScaleAnnotation(obj.GetAnnotations(), scaleAnnotation)
 	if err != nil {
 		return err
 	}
-	deployment.SetAnnotations(fixedAnnotation)
+	obj.SetAnnotations(fixedAnnotation)
 	return nil
 }
 
 func SetScaleAnnotation(annotations map[string]string, scaleAnnotation *ScaleAnnotation) (map[string]string, error) {
-	stepsJSONBytes, err := json.Marshal(scaleAnnotation.Steps)
-	if err != nil {
-		return annotations, err
+	return setScaleAnnotation(annotations, scaleAnnotation, "")
+}
+
+// setScaleAnnotation is SetScaleAnnotation reusing stepsJSON, the marshalled
+// steps, when not empty.
+func setScaleAnnotation(annotations map[string]string, scaleAnnotation *ScaleAnnotation, stepsJSON string) (map[string]string, error) {
+	if stepsJSON == "" {
+		var err error
+		stepsJSON, err = marshalJSONString(scaleAnnotation.Steps)
+		if err != nil {
+			return annotations, err
+		}
 	}
 	if annotations == nil {
 		annotations = make(map[string]string)
 	}
 
-	annotations["steps"] = string(stepsJSONBytes)
+	delete(annotations, PlanAnnotationKey)
+	steps, encoding, err := encodeSteps(stepsJSON)
+	if err != nil {
+		return annotations, err
+	}
+	annotations["steps"] = steps
+	if encoding != "" {
+		annotations[StepsEncodingKey] = encoding
+	} else {
+		delete(annotations, StepsEncodingKey)
+	}
 	annotations["current_step_index"] = strconv.Itoa(int(scaleAnnotation.CurrentStepIndex))
 	annotations["current_step_state"] = string(scaleAnnotation.CurrentStepState)
 	annotations["message"] = scaleAnnotation.Message
-	annotations["max_wait_available_time"] = strconv.Itoa(int(scaleAnnotation.MaxWaitAvailableSecond))
+	delete(annotations, "max_wait_available_time")
+	annotations["schema_version"] = strconv.Itoa(ScaleAnnotationSchemaVersion)
+	annotations["max_wait_available_second"] = strconv.Itoa(int(scaleAnnotation.MaxWaitAvailableSecond))
 	annotations["max_unavailable_replicas"] = strconv.Itoa(scaleAnnotation.MaxUnavailableReplicas)
-	annotations["last_update_time"] = strconv.FormatInt(scaleAnnotation.LastUpdateTime.Unix(), 10)
+	annotations["last_update_time"] = formatAnnotationTime(scaleAnnotation.LastUpdateTime)
+	if scaleAnnotation.TargetReplicas > 0 {
+		annotations["target_replicas"] = strconv.FormatInt(int64(scaleAnnotation.TargetReplicas), 10)
+	} else {
+		delete(annotations, "target_replicas")
+	}
+	if scaleAnnotation.Direction != "" {
+		annotations["direction"] = string(scaleAnnotation.Direction)
+	} else {
+		delete(annotations, "direction")
+	}
+	if len(scaleAnnotation.BlackoutWindows) > 0 {
+		blackoutWindowsJSON, err := marshalJSONString(scaleAnnotation.BlackoutWindows)
+		if err != nil {
+			return annotations, err
+		}
+		annotations["blackout_windows"] = blackoutWindowsJSON
+	} else {
+		delete(annotations, "blackout_windows")
+	}
+	if scaleAnnotation.Service != "" {
+		annotations["service"] = scaleAnnotation.Service
+	} else {
+		delete(annotations, "service")
+	}
+	if scaleAnnotation.Completion != nil {
+		completionJSON, err := marshalJSONString(scaleAnnotation.Completion)
+		if err != nil {
+			return annotations, err
+		}
+		annotations["completion"] = completionJSON
+	} else {
+		delete(annotations, "completion")
+	}
+	if scaleAnnotation.HandedOff {
+		annotations["handed_off"] = "true"
+	} else {
+		delete(annotations, "handed_off")
+	}
+	if scaleAnnotation.ID != "" {
+		annotations["plan_id"] = scaleAnnotation.ID
+	} else {
+		delete(annotations, "plan_id")
+	}
+	if len(scaleAnnotation.Transitions) > 0 {
+		transitionsJSON, err := marshalJSONString(scaleAnnotation.Transitions)
+		if err != nil {
+			return annotations, err
+		}
+		annotations["transitions"] = transitionsJSON
+	} else {
+		delete(annotations, "transitions")
+	}
+	if !scaleAnnotation.StepAvailableTime.IsZero() {
+		annotations["step_available_time"] = formatAnnotationTime(scaleAnnotation.StepAvailableTime)
+	} else {
+		delete(annotations, "step_available_time")
+	}
+	if scaleAnnotation.OriginalReplicas != nil {
+		annotations["original_replicas"] = strconv.FormatInt(int64(*scaleAnnotation.OriginalReplicas), 10)
+	} else {
+		delete(annotations, "original_replicas")
+	}
 
 	return annotations, nil
 }
+
+// SetScaleAnnotationJSON stores scaleAnnotation under PlanAnnotationKey and
+// drops the bare keys written by SetScaleAnnotation.
+func SetScaleAnnotationJSON(annotations map[string]string, scaleAnnotation *ScaleAnnotation) (map[string]string, error) {
+	scaleAnnotation.SchemaVersion = ScaleAnnotationSchemaVersion
+	planJSON, err := marshalJSONString(scaleAnnotation)
+	if err != nil {
+		return annotations, err
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for _, key := range legacyAnnotationKeys {
+		delete(annotations, key)
+	}
+	annotations[PlanAnnotationKey] = planJSON
+	return annotations, nil
+}
+
+// ReadScaleAnnotation reads PlanAnnotationKey when present and falls back to
+// the bare keys otherwise. Older layouts are migrated to the current schema
+// version; annotations itself is never modified.
 func ReadScaleAnnotation(annotations map[string]string) (*ScaleAnnotation, error) {
+	if planJSON, ok := annotations[PlanAnnotationKey]; ok {
+		return readScaleAnnotationJSON(planJSON)
+	}
+	annotations, err := migrateScaleAnnotation(annotations)
+	if err != nil {
+		return nil, err
+	}
 	scaleAnnotation := NewScaleAnnotation()
-	if stepsJSON, ok := annotations["steps"]; ok {
+	if stepsAnnotation, ok := annotations["steps"]; ok {
+		stepsJSON, err := decodeSteps(stepsAnnotation, annotations[StepsEncodingKey])
+		if err != nil {
+			return &scaleAnnotation, err
+		}
 		var steps []Step
-		err := json.Unmarshal([]byte(stepsJSON), &steps)
+		if isStepExpression(string(stepsJSON)) {
+			steps, err = ParseStepExpression(string(stepsJSON))
+		} else {
+			err = json.Unmarshal(stepsJSON, &steps)
+		}
 		if err != nil {
 			return &scaleAnnotation, err
 		}
@@ -102,12 +343,12 @@ func ReadScaleAnnotation(annotations map[string]string) (*ScaleAnnotation, error
 		return nil, ErrorScaleAnnotationParseCurrentStepState
 	}
 
-	if maxWaitAvailableTime, ok := annotations["max_wait_available_time"]; ok {
-		maxWaitAvailableTimeInt, err := strconv.ParseInt(maxWaitAvailableTime, 10, 0)
+	if maxWaitAvailableSecond, ok := annotations["max_wait_available_second"]; ok {
+		maxWaitAvailableSecondInt, err := strconv.ParseInt(maxWaitAvailableSecond, 10, 0)
 		if err != nil {
 			return &scaleAnnotation, err
 		}
-		scaleAnnotation.MaxWaitAvailableSecond = int(maxWaitAvailableTimeInt)
+		scaleAnnotation.MaxWaitAvailableSecond = int(maxWaitAvailableSecondInt)
 	}
 
 	if maxUnavailableReplicas, ok := annotations["max_unavailable_replicas"]; ok {
@@ -119,11 +360,74 @@ func ReadScaleAnnotation(annotations map[string]string) (*ScaleAnnotation, error
 	}
 
 	if lastUpdateTime, ok := annotations["last_update_time"]; ok {
-		lastUpdateTimeInt64, err := strconv.ParseInt(lastUpdateTime, 10, 64)
+		lastUpdateTime, err := parseAnnotationTime(lastUpdateTime)
+		if err != nil {
+			return &scaleAnnotation, err
+		}
+		scaleAnnotation.LastUpdateTime = lastUpdateTime
+	}
+
+	if targetReplicas, ok := annotations["target_replicas"]; ok {
+		targetReplicasInt, err := strconv.ParseInt(targetReplicas, 10, 32)
+		if err != nil {
+			return &scaleAnnotation, err
+		}
+		scaleAnnotation.TargetReplicas = int32(targetReplicasInt)
+	}
+
+	if direction, ok := annotations["direction"]; ok {
+		scaleAnnotation.Direction = Direction(direction)
+	}
+
+	if originalReplicas, ok := annotations["original_replicas"]; ok {
+		originalReplicasInt, err := strconv.ParseInt(originalReplicas, 10, 32)
 		if err != nil {
 			return &scaleAnnotation, err
 		}
-		scaleAnnotation.LastUpdateTime = time.Unix(lastUpdateTimeInt64, 0)
+		replicas := int32(originalReplicasInt)
+		scaleAnnotation.OriginalReplicas = &replicas
+	}
+
+	if stepAvailableTime, ok := annotations["step_available_time"]; ok {
+		stepAvailableTime, err := parseAnnotationTime(stepAvailableTime)
+		if err != nil {
+			return &scaleAnnotation, err
+		}
+		scaleAnnotation.StepAvailableTime = stepAvailableTime
+	}
+
+	if blackoutWindowsJSON, ok := annotations["blackout_windows"]; ok {
+		var blackoutWindows []Window
+		err := json.Unmarshal([]byte(blackoutWindowsJSON), &blackoutWindows)
+		if err != nil {
+			return &scaleAnnotation, err
+		}
+		scaleAnnotation.BlackoutWindows = blackoutWindows
+	}
+
+	if service, ok := annotations["service"]; ok {
+		scaleAnnotation.Service = service
+	}
+
+	scaleAnnotation.ID = annotations["plan_id"]
+
+	if completionJSON, ok := annotations["completion"]; ok {
+		completion := &CompletionPolicy{}
+		err := json.Unmarshal([]byte(completionJSON), completion)
+		if err != nil {
+			return &scaleAnnotation, err
+		}
+		scaleAnnotation.Completion = completion
+	}
+	scaleAnnotation.HandedOff = annotations["handed_off"] == "true"
+
+	if transitionsJSON, ok := annotations["transitions"]; ok {
+		var transitions []TransitionRecord
+		err := json.Unmarshal([]byte(transitionsJSON), &transitions)
+		if err != nil {
+			return &scaleAnnotation, err
+		}
+		scaleAnnotation.Transitions = transitions
 	}
 
 	if message, ok := annotations["message"]; ok {
@@ -133,6 +437,27 @@ func ReadScaleAnnotation(annotations map[string]string) (*ScaleAnnotation, error
 	return &scaleAnnotation, nil
 }
 
+func readScaleAnnotationJSON(planJSON string) (*ScaleAnnotation, error) {
+	scaleAnnotation := NewScaleAnnotation()
+	scaleAnnotation.SchemaVersion = 0
+	if err := json.Unmarshal([]byte(planJSON), &scaleAnnotation); err != nil {
+		return &scaleAnnotation, err
+	}
+	if err := migrateScaleAnnotationJSON(&scaleAnnotation); err != nil {
+		return nil, err
+	}
+	if len(scaleAnnotation.Steps) == 0 {
+		return nil, ErrorScaleAnnotationParseSteps
+	}
+	if scaleAnnotation.CurrentStepIndex == 0 {
+		return nil, ErrorScaleAnnotationParseCurrentStepIndex
+	}
+	if scaleAnnotation.CurrentStepState == "" {
+		return nil, ErrorScaleAnnotationParseCurrentStepState
+	}
+	return &scaleAnnotation, nil
+}
+
 type StepState string
 
 const (
@@ -141,13 +466,80 @@ const (
 	StepStateReady     StepState = "StepReady"
 	StepStateCompleted StepState = "Completed"
 	StepStateTimeout   StepState = "Timeout"
+	StepStateError     StepState = "Error"
+	StepStateAborted   StepState = "Aborted"
+)
+
+// Direction is the way the steps of a plan scale.
+type Direction string
+
+const (
+	DirectionUp   Direction = "Up"
+	DirectionDown Direction = "Down"
+	// DirectionAny, the default, allows steps to scale either way.
+	DirectionAny Direction = "Any"
 )
 
 type Step struct {
 	Replicas int32 `json:"replicas,omitempty"`
 	Pause    bool  `json:"pause,omitempty"`
+	// MaxWaitAvailableSecond overrides ScaleAnnotation.MaxWaitAvailableSecond
+	// for this step when set.
+	MaxWaitAvailableSecond int `json:"max_wait_available_second,omitempty"`
+	// Percent of ScaleAnnotation.TargetReplicas, used instead of Replicas
+	// when both are set.
+	Percent int32 `json:"percent,omitempty"`
+	// HoldSeconds is how long the step must stay available before the plan
+	// moves on.
+	HoldSeconds int `json:"hold_seconds,omitempty"`
+	// Webhook must accept the step before the plan moves on from it.
+	Webhook *StepWebhook `json:"webhook,omitempty"`
+	// Job must succeed before the step is done.
+	Job *StepJob `json:"job,omitempty"`
+	// Analysis is evaluated while the step bakes.
+	Analysis *StepAnalysis `json:"analysis,omitempty"`
+	// Probe must pass before an available step is done.
+	Probe *StepProbe `json:"probe,omitempty"`
+	// Drain drains the pods this step scales away before it is entered.
+	Drain *StepDrain `json:"drain,omitempty"`
+	// MinReadySeconds overrides spec.minReadySeconds of a Deployment during
+	// the step, e.g. so that pods of an early canary step must be stable for
+	// longer to count as available. The original value is restored after.
+	MinReadySeconds *int32 `json:"min_ready_seconds,omitempty"`
+	// Approvers may approve a pause step with ApproveStepAnnotationKey, the
+	// plan then waits for their approval instead of ResumePlan.
+	Approvers []string `json:"approvers,omitempty"`
+	// Skipped is set when the step was left with SkipStep.
+	Skipped bool `json:"skipped,omitempty"`
+	// StartedAt and FinishedAt are recorded by the controller when the step
+	// is entered and when it reaches its replicas.
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// AnalyzedAt and AnalysisFailures track the measurements of Analysis.
+	AnalyzedAt       *time.Time `json:"analyzed_at,omitempty"`
+	AnalysisFailures int        `json:"analysis_failures,omitempty"`
+	// ProbeSuccesses counts the passed probes in a row of Probe.
+	ProbeSuccesses int `json:"probe_successes,omitempty"`
+	// DrainStartedAt is when the pods of Drain were drained.
+	DrainStartedAt *time.Time `json:"drain_started_at,omitempty"`
+	// ApprovedBy is who approved the step.
+	ApprovedBy string `json:"approved_by,omitempty"`
 }
 
 func (s Step) String() string {
-	return fmt.Sprintf("replicas: %d,pause: %v", s.Replicas, s.Pause)
+	return fmt.Sprintf("replicas: %d,pause: %v,max_wait_available_second: %d,percent: %d,hold_seconds: %d,skipped: %v", s.Replicas, s.Pause, s.MaxWaitAvailableSecond, s.Percent, s.HoldSeconds, s.Skipped)
+}
+
+// formatAnnotationTime formats t like metav1.Time, RFC3339 in UTC.
+func formatAnnotationTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseAnnotationTime parses RFC3339 times and the unix seconds written
+// before schema version 3.
+func parseAnnotationTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
@@ -0,0 +1,98 @@
+package annotationscale
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// benchmarkWorkload returns a Deployment running a plan of a few steps in
+// the middle of its second step.
+func benchmarkWorkload(b *testing.B) (*Workload, *ScaleAnnotation) {
+	b.Helper()
+	started := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	plan := &ScaleAnnotation{
+		Steps: []Step{
+			{Replicas: 10, StartedAt: &started, FinishedAt: &started},
+			{Replicas: 20, HoldSeconds: 60, StartedAt: &started},
+			{Replicas: 40, Pause: true, Approvers: []string{"alice", "bob"}},
+			{Replicas: 80, MaxWaitAvailableSecond: 900},
+			{Replicas: 100},
+		},
+		CurrentStepIndex:       2,
+		CurrentStepState:       StepStateUpgrade,
+		MaxWaitAvailableSecond: 600,
+		LastUpdateTime:         started,
+	}
+	annotations, err := SetScaleAnnotation(map[string]string{}, plan)
+	if err != nil {
+		b.Fatal(err)
+	}
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default", Name: "web", UID: "uid", ResourceVersion: "1", Annotations: annotations,
+	}}
+	return newDeploymentWorkload(deployment), plan
+}
+
+func BenchmarkReadScaleAnnotation(b *testing.B) {
+	b.Run("uncached", func(b *testing.B) {
+		workload, _ := benchmarkWorkload(b)
+		annotations := workload.Object.GetAnnotations()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := ReadScaleAnnotation(annotations); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		workload, _ := benchmarkWorkload(b)
+		store := annotationStore{cache: newPlanCache()}
+		if _, err := store.Read(context.Background(), workload); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := store.Read(context.Background(), workload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSetScaleAnnotation(b *testing.B) {
+	b.Run("uncached", func(b *testing.B) {
+		workload, plan := benchmarkWorkload(b)
+		annotations := workload.Object.GetAnnotations()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := SetScaleAnnotation(annotations, plan); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		workload, _ := benchmarkWorkload(b)
+		store := annotationStore{cache: newPlanCache()}
+		plan, err := store.Read(context.Background(), workload)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if store.cache.stepsJSON(workload.Object, plan.Steps) == "" {
+			b.Fatal("steps not cached")
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := store.Write(context.Background(), workload, plan); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package annotationscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Cluster is one of the clusters of a MultiClusterManager.
+type Cluster struct {
+	// Name labels the metrics and status of the cluster, e.g. its
+	// kubeconfig context.
+	Name   string
+	Config *rest.Config
+}
+
+// ClustersFromKubeconfig returns a Cluster for each of contexts in the
+// kubeconfig at path, or for every context when none are given. An empty
+// path uses the default loading rules.
+func ClustersFromKubeconfig(path string, contexts ...string) ([]Cluster, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if path != "" {
+		rules.ExplicitPath = path
+	}
+	raw, err := rules.Load()
+	if err != nil {
+		return nil, err
+	}
+	if len(contexts) == 0 {
+		for name := range raw.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+	}
+	clusters := make([]Cluster, 0, len(contexts))
+	for _, name := range contexts {
+		config, err := clientcmd.NewNonInteractiveClientConfig(*raw, name, &clientcmd.ConfigOverrides{}, rules).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %w", name, err)
+		}
+		clusters = append(clusters, Cluster{Name: name, Config: config})
+	}
+	return clusters, nil
+}
+
+// MultiClusterManager runs an AnnotationScaleManager for each of several
+// clusters from one process, e.g. to ramp up region by region. The metrics
+// of all clusters are served by the first one, labeled by cluster name.
+type MultiClusterManager struct {
+	log      *logr.Logger
+	clusters []Cluster
+	managers []*AnnotationScaleManager
+}
+
+// ClusterPlanStatus is the plan of a Deployment in one of the clusters.
+type ClusterPlanStatus struct {
+	Cluster   string
+	Namespace string
+	Name      string
+	PlanStatus
+}
+
+func NewMultiClusterManager(log *logr.Logger, match *metav1.LabelSelector, clusters []Cluster, syncPeriod time.Duration, opts ...Option) (*MultiClusterManager, error) {
+	if len(clusters) == 0 {
+		return nil, errors.New("no clusters")
+	}
+	if log == nil {
+		defaultLog := ctrllog.Log.WithName("annotationscale")
+		log = &defaultLog
+	}
+	m := &MultiClusterManager{log: log, clusters: clusters}
+	names := make(map[string]bool, len(clusters))
+	for i, cluster := range clusters {
+		if cluster.Name == "" || names[cluster.Name] {
+			return nil, fmt.Errorf("cluster names must be unique and not empty, got %q", cluster.Name)
+		}
+		names[cluster.Name] = true
+
+		clusterLog := log.WithValues("cluster", cluster.Name)
+		clusterOpts := append(append([]Option{}, opts...), func(o *Options) {
+			o.ClusterName = cluster.Name
+			if i > 0 {
+				// the metrics registry is shared by the clusters
+				o.MetricsBindAddress = "0"
+			}
+		})
+		mgr, err := NewAnnotationScaleManager(&clusterLog, match, cluster.Config, syncPeriod, clusterOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", cluster.Name, err)
+		}
+		m.managers = append(m.managers, mgr)
+	}
+	return m, nil
+}
+
+// Run runs the managers of every cluster until ctx is cancelled, Stop is
+// called or one of them fails, which stops the others.
+func (m *MultiClusterManager) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make([]error, len(m.managers))
+	var wg sync.WaitGroup
+	for i, mgr := range m.managers {
+		wg.Add(1)
+		go func(i int, mgr *AnnotationScaleManager) {
+			defer wg.Done()
+			if err := mgr.Run(ctx); err != nil {
+				errs[i] = fmt.Errorf("cluster %s: %w", m.clusters[i].Name, err)
+				m.log.Error(err, "manager failed", "cluster", m.clusters[i].Name)
+			}
+			// a stopped cluster stops the others too
+			cancel()
+		}(i, mgr)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MultiClusterManager) Stop() {
+	for _, mgr := range m.managers {
+		mgr.Stop()
+	}
+}
+
+// Status lists the plans of the Deployments the managers see, by cluster.
+// The managers must be running.
+func (m *MultiClusterManager) Status(ctx context.Context) ([]ClusterPlanStatus, error) {
+	var statuses []ClusterPlanStatus
+	now := time.Now()
+	for i, mgr := range m.managers {
+		deployments := &appsv1.DeploymentList{}
+		if err := mgr.currentManager().GetClient().List(ctx, deployments); err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", m.clusters[i].Name, err)
+		}
+		for _, deployment := range deployments.Items {
+			scaleAnnotation, err := ReadScaleAnnotation(deployment.Annotations)
+			if err != nil {
+				continue
+			}
+			statuses = append(statuses, ClusterPlanStatus{
+				Cluster:    m.clusters[i].Name,
+				Namespace:  deployment.Namespace,
+				Name:       deployment.Name,
+				PlanStatus: *planStatus(scaleAnnotation, now),
+			})
+		}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,85 @@
+package annotationscale
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// NamespaceFilter restricts the namespaces the controllers ever touch, in
+// addition to the manager's label selector.
+type NamespaceFilter struct {
+	// Include lists the only namespaces managed, every namespace when empty.
+	Include []string
+	// Exclude lists namespaces never managed, e.g. kube-system. It wins over
+	// Include and Selector.
+	Exclude []string
+	// Selector restricts the managed namespaces by their labels, it needs
+	// permission to get namespaces.
+	Selector *metav1.LabelSelector
+}
+
+// listed checks namespace against Include and Exclude.
+func (f *NamespaceFilter) listed(namespace string) bool {
+	if f == nil {
+		return true
+	}
+	for _, excluded := range f.Exclude {
+		if excluded == namespace {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, included := range f.Include {
+		if included == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// allows checks namespace against the lists and Selector.
+func (f *NamespaceFilter) allows(ctx context.Context, c client.Reader, namespace string) (bool, error) {
+	if !f.listed(namespace) {
+		return false, nil
+	}
+	if f == nil || f.Selector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(f.Selector)
+	if err != nil {
+		return false, err
+	}
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// NamespacePausedAnnotationKey set to "true" on a namespace suspends all
+// plans in it, see ReconcilerOptions.NamespacePause.
+const NamespacePausedAnnotationKey = "annotationscale.arcosx.io/paused"
+
+// namespacePaused reports whether namespace has NamespacePausedAnnotationKey.
+func namespacePaused(ctx context.Context, c client.Reader, namespace string) (bool, error) {
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return ns.Annotations[NamespacePausedAnnotationKey] == "true", nil
+}
+
+// predicate drops the events of objects in namespaces that are not listed.
+func (f *NamespaceFilter) predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return f.listed(obj.GetNamespace())
+	})
+}
@@ -0,0 +1,188 @@
+package annotationscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// NotificationKind is the plan transition a Notification is sent for.
+type NotificationKind string
+
+const (
+	NotificationPlanStarted   NotificationKind = "PlanStarted"
+	NotificationStepPaused    NotificationKind = "StepPaused"
+	NotificationPlanTimeout   NotificationKind = "PlanTimeout"
+	NotificationPlanError     NotificationKind = "PlanError"
+	NotificationPlanCompleted NotificationKind = "PlanCompleted"
+)
+
+// Notification tells humans about a plan transition, e.g. a pause step
+// waiting for them.
+type Notification struct {
+	Kind      NotificationKind `json:"kind"`
+	PlanID    string           `json:"plan_id,omitempty"`
+	Cluster   string           `json:"cluster,omitempty"`
+	Namespace string           `json:"namespace"`
+	Name      string           `json:"name"`
+	Step      int              `json:"step"`
+	Steps     int              `json:"steps"`
+	Replicas  int32            `json:"replicas"`
+	State     StepState        `json:"state"`
+	Message   string           `json:"message,omitempty"`
+	Time      time.Time        `json:"time"`
+}
+
+func (n Notification) String() string {
+	target := n.Namespace + "/" + n.Name
+	if n.Cluster != "" {
+		target = n.Cluster + ": " + target
+	}
+	var text string
+	switch n.Kind {
+	case NotificationPlanStarted:
+		text = fmt.Sprintf("%s: plan of %d steps started", target, n.Steps)
+	case NotificationStepPaused:
+		text = fmt.Sprintf("%s: paused at step %d of %d with %d replicas", target, n.Step, n.Steps, n.Replicas)
+	case NotificationPlanTimeout:
+		text = fmt.Sprintf("%s: step %d of %d timed out", target, n.Step, n.Steps)
+	case NotificationPlanError:
+		text = fmt.Sprintf("%s: step %d of %d failed", target, n.Step, n.Steps)
+	case NotificationPlanCompleted:
+		text = fmt.Sprintf("%s: plan completed with %d replicas", target, n.Replicas)
+	default:
+		text = fmt.Sprintf("%s: %s at step %d of %d", target, n.Kind, n.Step, n.Steps)
+	}
+	if n.Message != "" {
+		text += ": " + n.Message
+	}
+	if n.PlanID != "" {
+		text += " (plan " + n.PlanID + ")"
+	}
+	return text
+}
+
+// Notifier sends Notifications, e.g. to a chat. Errors are logged, a failed
+// notification does not hold the plan.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// SlackNotifier posts notifications to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	// Channel overrides the channel of the webhook when set.
+	Channel string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, notification Notification) error {
+	message := map[string]string{"text": notification.String()}
+	if s.Channel != "" {
+		message["channel"] = s.Channel
+	}
+	return postJSON(ctx, s.HTTPClient, s.WebhookURL, nil, message)
+}
+
+// WebhookNotifier posts notifications as JSON to URL.
+type WebhookNotifier struct {
+	URL string
+	// Headers are added to each request, e.g. Authorization.
+	Headers map[string]string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	return postJSON(ctx, w.HTTPClient, w.URL, w.Headers, notification)
+}
+
+// notifyTimeout bounds each notification, they are sent from the reconcile.
+const notifyTimeout = 10 * time.Second
+
+func postJSON(ctx context.Context, httpClient *http.Client, url string, headers map[string]string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notifications returns the kinds of Notification due for the change of a
+// plan from before to after.
+func notifications(before stepSnapshot, after *ScaleAnnotation) []NotificationKind {
+	var kinds []NotificationKind
+	current := snapshotStep(after)
+	if before.index == 1 && before.startedAt.IsZero() && (!current.startedAt.IsZero() || current.index > 1) {
+		kinds = append(kinds, NotificationPlanStarted)
+	}
+	if after.CurrentStepState == StepStatePaused && current.finished &&
+		(current.index != before.index || !before.finished || before.state != StepStatePaused) {
+		kinds = append(kinds, NotificationStepPaused)
+	}
+	if after.CurrentStepState != before.state {
+		switch after.CurrentStepState {
+		case StepStateTimeout:
+			kinds = append(kinds, NotificationPlanTimeout)
+		case StepStateError:
+			kinds = append(kinds, NotificationPlanError)
+		case StepStateCompleted:
+			kinds = append(kinds, NotificationPlanCompleted)
+		}
+	}
+	return kinds
+}
+
+// notify sends the Notifications for the change of the plan of workload.
+func (r *DeploymentReconciler) notify(ctx context.Context, workload *Workload, before stepSnapshot, after *ScaleAnnotation) {
+	if len(r.notifiers) == 0 {
+		return
+	}
+	for _, kind := range notifications(before, after) {
+		notification := Notification{
+			Kind:      kind,
+			PlanID:    after.ID,
+			Cluster:   r.cluster,
+			Namespace: workload.Object.GetNamespace(),
+			Name:      workload.Object.GetName(),
+			Step:      after.CurrentStepIndex,
+			Steps:     len(after.Steps),
+			Replicas:  workload.Replicas,
+			State:     after.CurrentStepState,
+			Message:   after.Message,
+			Time:      r.now(),
+		}
+		for _, notifier := range r.notifiers {
+			if err := notifier.Notify(ctx, notification); err != nil {
+				r.log.Error(err, "failed to notify", "notification", kind, "workload", notification.Name)
+			}
+		}
+	}
+}
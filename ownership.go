@@ -0,0 +1,183 @@
+package annotationscale
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// OwnershipLease makes each manager claim a Lease per workload before
+// driving its plan, so that managers with overlapping selectors never patch
+// the same workload. A claim not renewed for Duration is taken over.
+type OwnershipLease struct {
+	// Identity of this manager, the hostname and a random suffix by default.
+	Identity string
+	// Duration of a claim, 1 minute by default. Claims are renewed after
+	// half of it.
+	Duration time.Duration
+}
+
+// ownershipLeasePrefix prefixes the names of the ownership Leases.
+const ownershipLeasePrefix = "annotationscale-"
+
+// ownershipClaims remembers until when the claims of this manager need no
+// renewal, by workload. A nil ownershipClaims claims nothing.
+type ownershipClaims struct {
+	identity string
+	duration time.Duration
+
+	mu      sync.Mutex
+	renewAt map[types.NamespacedName]time.Time
+}
+
+func newOwnershipClaims(lease *OwnershipLease) *ownershipClaims {
+	if lease == nil {
+		return nil
+	}
+	claims := &ownershipClaims{identity: lease.Identity, duration: lease.Duration, renewAt: map[types.NamespacedName]time.Time{}}
+	if claims.identity == "" {
+		hostname, _ := os.Hostname()
+		claims.identity = hostname + "_" + string(uuid.NewUUID())
+	}
+	if claims.duration <= 0 {
+		claims.duration = time.Minute
+	}
+	return claims
+}
+
+func (c *ownershipClaims) held(workload types.NamespacedName, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return now.Before(c.renewAt[workload])
+}
+
+func (c *ownershipClaims) hold(workload types.NamespacedName, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.renewAt[workload] = now.Add(c.duration / 2)
+}
+
+func (c *ownershipClaims) release(workload types.NamespacedName) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.renewAt, workload)
+}
+
+// claimOwnership creates or renews the ownership Lease of workload, taking
+// it over when expired. It returns false while another manager holds it.
+func (r *DeploymentReconciler) claimOwnership(ctx context.Context, logger logr.Logger, workload *Workload) (bool, error) {
+	claims := r.ownership
+	if claims == nil {
+		return true, nil
+	}
+	name := client.ObjectKeyFromObject(workload.Object)
+	now := r.now()
+	if claims.held(name, now) {
+		return true, nil
+	}
+	key := types.NamespacedName{Namespace: workload.Object.GetNamespace(), Name: ownershipLeasePrefix + workload.Object.GetName()}
+	lease := &coordinationv1.Lease{}
+	err := r.Get(ctx, key, lease)
+	if kerrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+		claims.renew(lease, now)
+		if err := controllerutil.SetControllerReference(workload.Object, lease, r.Scheme()); err != nil {
+			logger.Error(err, "failed to set ownership lease owner")
+		}
+		logger.V(2).Info("claim plan", "lease", key.Name, "identity", claims.identity)
+		if err := r.Create(ctx, lease); err != nil {
+			if kerrors.IsAlreadyExists(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		claims.hold(name, now)
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != claims.identity {
+		if !leaseExpired(lease, now) {
+			claims.release(name)
+			logger.V(2).Info("plan owned by another manager", "lease", key.Name, "holder", holder)
+			return false, nil
+		}
+		logger.Info("take over plan", "lease", key.Name, "from", holder, "identity", claims.identity)
+	}
+	claims.renew(lease, now)
+	if err := r.Update(ctx, lease); err != nil {
+		if kerrors.IsConflict(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	claims.hold(name, now)
+	return true, nil
+}
+
+// releaseOwnership deletes the ownership Lease of workload when this manager
+// holds it.
+func (r *DeploymentReconciler) releaseOwnership(ctx context.Context, workload *Workload) error {
+	claims := r.ownership
+	if claims == nil {
+		return nil
+	}
+	claims.release(client.ObjectKeyFromObject(workload.Object))
+	lease := &coordinationv1.Lease{}
+	key := types.NamespacedName{Namespace: workload.Object.GetNamespace(), Name: ownershipLeasePrefix + workload.Object.GetName()}
+	if err := r.Get(ctx, key, lease); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != claims.identity {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, lease))
+}
+
+// renew makes lease held by c from now.
+func (c *ownershipClaims) renew(lease *coordinationv1.Lease, now time.Time) {
+	renewTime := metav1.NewMicroTime(now)
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != c.identity {
+		identity := c.identity
+		lease.Spec.HolderIdentity = &identity
+		lease.Spec.AcquireTime = &renewTime
+		if lease.Spec.LeaseTransitions != nil {
+			transitions := *lease.Spec.LeaseTransitions + 1
+			lease.Spec.LeaseTransitions = &transitions
+		} else {
+			var transitions int32
+			lease.Spec.LeaseTransitions = &transitions
+		}
+	}
+	durationSeconds := int32(c.duration / time.Second)
+	if durationSeconds < 1 {
+		durationSeconds = 1
+	}
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &renewTime
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return !now.Before(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
@@ -0,0 +1,229 @@
+package annotationscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	ErrorPlanFinished     error = errors.New("plan is already finished")
+	ErrorPlanNotResumable error = errors.New("plan is not paused or timed out")
+	ErrorReplicasMismatch error = errors.New("deployment replicas do not match the current step")
+	ErrorNoNextStep       error = errors.New("current step is the last step")
+	ErrorPlanNotFailed    error = errors.New("plan is not timed out or failed")
+	ErrorPlanNotRunning   error = errors.New("plan is not running")
+)
+
+type AbortOptions struct {
+	// Revert scales the Deployment back to the replicas it had before the
+	// plan, or of the first step when the plan did not record them. By
+	// default it stays at the replicas of the current step.
+	Revert bool
+	// Message is recorded in the plan, "aborted" by default.
+	Message string
+}
+
+// ApplyPlan starts scaleAnnotation on the Deployment key from its first step,
+// replacing any plan in flight. Plans ValidatePlan rejects are not applied,
+// approvals left from an earlier plan are cleared.
+func ApplyPlan(ctx context.Context, c client.Client, key types.NamespacedName, scaleAnnotation *ScaleAnnotation) error {
+	workload, err := (&deploymentClient{client: c}).Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	plan := *scaleAnnotation
+	plan.Steps = make([]Step, len(scaleAnnotation.Steps))
+	for i, step := range scaleAnnotation.Steps {
+		step.resetProgress()
+		plan.Steps[i] = step
+	}
+	plan.CurrentStepIndex = 1
+	plan.CurrentStepState = StepStateReady
+	plan.LastUpdateTime = time.Now()
+	plan.StepAvailableTime = time.Time{}
+	plan.ID = ""
+	plan.Transitions = nil
+	replicas := workload.Replicas
+	plan.OriginalReplicas = &replicas
+	plan.recordTransition(StepTransition{}, "plan applied", "")
+	if errs := ValidatePlan(&plan); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	if err := clearApproval(ctx, c, workload.Object); err != nil {
+		return err
+	}
+	if err := storeFor(workload).Write(ctx, workload, &plan); err != nil {
+		return err
+	}
+	return workload.client.Patch(ctx, workload)
+}
+
+// PausePlan makes the current step of the Deployment key a pause step, so
+// the plan stops there until ResumePlan.
+func PausePlan(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	return updatePlan(ctx, c, key, "paused", func(workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+		switch scaleAnnotation.CurrentStepState {
+		case StepStatePaused:
+			return nil
+		case StepStateUpgrade, StepStateReady:
+		default:
+			return fmt.Errorf("%w: %s", ErrorPlanNotRunning, scaleAnnotation.CurrentStepState)
+		}
+		scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Pause = true
+		scaleAnnotation.CurrentStepState = StepStatePaused
+		scaleAnnotation.LastUpdateTime = time.Now()
+		return nil
+	})
+}
+
+// AbortPlan stops the plan of the Deployment key in the Aborted state and
+// unpauses the Deployment. The controller leaves aborted plans alone.
+func AbortPlan(ctx context.Context, c client.Client, key types.NamespacedName, opts AbortOptions) error {
+	return updatePlan(ctx, c, key, "aborted", func(workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+		switch scaleAnnotation.CurrentStepState {
+		case StepStateCompleted, StepStateAborted:
+			return ErrorPlanFinished
+		}
+		workload.Replicas = scaleAnnotation.StepReplicas(scaleAnnotation.CurrentStepIndex)
+		if opts.Revert {
+			if scaleAnnotation.OriginalReplicas != nil {
+				workload.Replicas = *scaleAnnotation.OriginalReplicas
+			} else {
+				workload.Replicas = scaleAnnotation.StepReplicas(1)
+			}
+		}
+		workload.Paused = false
+		scaleAnnotation.CurrentStepState = StepStateAborted
+		scaleAnnotation.Message = opts.Message
+		if scaleAnnotation.Message == "" {
+			scaleAnnotation.Message = "aborted"
+		}
+		scaleAnnotation.LastUpdateTime = time.Now()
+		scaleAnnotation.StepAvailableTime = time.Time{}
+		return nil
+	})
+}
+
+// ResumePlan moves a Paused or Timeout plan of the Deployment key to
+// StepStateReady so the controller continues with the next step. It refuses
+// when the Deployment has been scaled away from the current step.
+func ResumePlan(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	return updatePlan(ctx, c, key, "resumed", func(workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+		switch scaleAnnotation.CurrentStepState {
+		case StepStatePaused, StepStateTimeout:
+		default:
+			return fmt.Errorf("%w: %s", ErrorPlanNotResumable, scaleAnnotation.CurrentStepState)
+		}
+		if approvers := scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Approvers; len(approvers) > 0 && scaleAnnotation.CurrentStepState == StepStatePaused {
+			return fmt.Errorf("%w by one of %v, see ApproveStep", ErrorApprovalRequired, approvers)
+		}
+		if stepReplicas := scaleAnnotation.StepReplicas(scaleAnnotation.CurrentStepIndex); workload.Replicas != stepReplicas {
+			return fmt.Errorf("%w: %d, step %d wants %d", ErrorReplicasMismatch, workload.Replicas, scaleAnnotation.CurrentStepIndex, stepReplicas)
+		}
+		workload.Paused = false
+		scaleAnnotation.CurrentStepState = StepStateReady
+		scaleAnnotation.Message = ""
+		scaleAnnotation.LastUpdateTime = time.Now()
+		scaleAnnotation.StepAvailableTime = time.Time{}
+		return nil
+	})
+}
+
+// SkipStep marks the current step of the Deployment key skipped and lets the
+// controller move on to the next step without waiting for it, e.g. when the
+// verification of a pause step was done out-of-band.
+func SkipStep(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	return updatePlan(ctx, c, key, "step skipped", func(workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+		switch scaleAnnotation.CurrentStepState {
+		case StepStateCompleted, StepStateAborted:
+			return ErrorPlanFinished
+		}
+		if scaleAnnotation.CurrentStepIndex == len(scaleAnnotation.Steps) {
+			return ErrorNoNextStep
+		}
+		// StepReady advances from the current step, which must be in place
+		workload.Replicas = scaleAnnotation.StepReplicas(scaleAnnotation.CurrentStepIndex)
+		workload.Paused = false
+		scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Skipped = true
+		scaleAnnotation.CurrentStepState = StepStateReady
+		scaleAnnotation.Message = fmt.Sprintf("step %d skipped", scaleAnnotation.CurrentStepIndex)
+		scaleAnnotation.LastUpdateTime = time.Now()
+		scaleAnnotation.StepAvailableTime = time.Time{}
+		scaleAnnotation.finishStep(scaleAnnotation.CurrentStepIndex, scaleAnnotation.LastUpdateTime)
+		return nil
+	})
+}
+
+// RetryStep restarts the current step of a Timeout or Error plan of the
+// Deployment key with a fresh deadline.
+func RetryStep(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	return updatePlan(ctx, c, key, "step retried", func(workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+		switch scaleAnnotation.CurrentStepState {
+		case StepStateTimeout, StepStateError:
+		default:
+			return fmt.Errorf("%w: %s", ErrorPlanNotFailed, scaleAnnotation.CurrentStepState)
+		}
+		// the step must be approved again
+		if err := clearApproval(ctx, c, workload.Object); err != nil {
+			return err
+		}
+		workload.Replicas = scaleAnnotation.StepReplicas(scaleAnnotation.CurrentStepIndex)
+		workload.Paused = false
+		// a pause step must stop at its pause point again
+		if scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Pause {
+			scaleAnnotation.CurrentStepState = StepStatePaused
+		} else {
+			scaleAnnotation.CurrentStepState = StepStateUpgrade
+		}
+		scaleAnnotation.Message = ""
+		scaleAnnotation.LastUpdateTime = time.Now()
+		scaleAnnotation.StepAvailableTime = time.Time{}
+		scaleAnnotation.startStep(scaleAnnotation.CurrentStepIndex, scaleAnnotation.LastUpdateTime)
+		return nil
+	})
+}
+
+// updatePlan applies update to the plan of the Deployment key and patches the
+// Deployment, keeping the annotation format the plan was written in. A change
+// of the step or state is recorded with the plan message or reason.
+func updatePlan(ctx context.Context, c client.Client, key types.NamespacedName, reason string, update func(*Workload, *ScaleAnnotation) error) error {
+	workload, err := (&deploymentClient{client: c}).Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	store := storeFor(workload)
+	scaleAnnotation, err := store.Read(ctx, workload)
+	if err != nil {
+		return err
+	}
+	if scaleAnnotation.CurrentStepIndex < 1 || scaleAnnotation.CurrentStepIndex > len(scaleAnnotation.Steps) {
+		return fmt.Errorf("current step index %d out of range", scaleAnnotation.CurrentStepIndex)
+	}
+	from := scaleAnnotation.stepTransition()
+	if err := update(workload, scaleAnnotation); err != nil {
+		return err
+	}
+	if from != scaleAnnotation.stepTransition() {
+		if scaleAnnotation.Message != "" {
+			reason = scaleAnnotation.Message
+		}
+		scaleAnnotation.recordTransition(from, reason, "")
+	}
+	if err := store.Write(ctx, workload, scaleAnnotation); err != nil {
+		return err
+	}
+	return workload.client.Patch(ctx, workload)
+}
+
+// storeFor keeps the annotation format the plan of workload was written in.
+func storeFor(workload *Workload) annotationStore {
+	if _, ok := workload.Object.GetAnnotations()[PlanAnnotationKey]; ok {
+		return annotationStore{format: AnnotationFormatJSON}
+	}
+	return annotationStore{format: AnnotationFormatKeys}
+}
@@ -0,0 +1,125 @@
+package annotationscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// planCache keeps the plans parsed from workload annotations by
+// resourceVersion, so that the many reconciles of unchanged workloads skip
+// parsing. A nil planCache caches nothing.
+type planCache struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]planCacheEntry
+}
+
+type planCacheEntry struct {
+	uid             types.UID
+	resourceVersion string
+	plan            *ScaleAnnotation
+	// stepsJSON is the steps annotation plan was parsed from, empty when
+	// it needs to be rewritten.
+	stepsJSON string
+}
+
+func newPlanCache() *planCache {
+	return &planCache{entries: map[types.NamespacedName]planCacheEntry{}}
+}
+
+// entry returns the entry parsed from the annotations of obj's
+// resourceVersion.
+func (c *planCache) entry(obj client.Object) (planCacheEntry, bool) {
+	if c == nil || obj.GetResourceVersion() == "" {
+		return planCacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[client.ObjectKeyFromObject(obj)]
+	if !ok || entry.uid != obj.GetUID() || entry.resourceVersion != obj.GetResourceVersion() {
+		return planCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// get returns a copy of the cached plan of obj.
+func (c *planCache) get(obj client.Object) (*ScaleAnnotation, bool) {
+	entry, ok := c.entry(obj)
+	if !ok {
+		return nil, false
+	}
+	return copyPlan(entry.plan), true
+}
+
+func (c *planCache) put(obj client.Object, plan *ScaleAnnotation) {
+	if c == nil || obj.GetResourceVersion() == "" {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	stepsJSON := annotations["steps"]
+	// steps of older schema versions are rewritten, encoded ones decoded
+	if annotations["schema_version"] != strconv.Itoa(ScaleAnnotationSchemaVersion) || annotations[StepsEncodingKey] != "" {
+		stepsJSON = ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[client.ObjectKeyFromObject(obj)] = planCacheEntry{
+		uid:             obj.GetUID(),
+		resourceVersion: obj.GetResourceVersion(),
+		plan:            copyPlan(plan),
+		stepsJSON:       stepsJSON,
+	}
+}
+
+func (c *planCache) forget(key types.NamespacedName) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// stepsJSON returns the steps annotation obj was parsed from when steps did
+// not change since, so that they are not marshalled again.
+func (c *planCache) stepsJSON(obj client.Object, steps []Step) string {
+	entry, ok := c.entry(obj)
+	if !ok || !reflect.DeepEqual(entry.plan.Steps, steps) {
+		return ""
+	}
+	return entry.stepsJSON
+}
+
+// copyPlan copies the slices of plan the reconciler modifies in place. Step
+// configurations such as webhooks are shared, they are never modified.
+func copyPlan(plan *ScaleAnnotation) *ScaleAnnotation {
+	copied := *plan
+	copied.Steps = append([]Step(nil), plan.Steps...)
+	copied.BlackoutWindows = append([]Window(nil), plan.BlackoutWindows...)
+	if plan.Completion != nil {
+		completion := *plan.Completion
+		copied.Completion = &completion
+	}
+	return &copied
+}
+
+var jsonBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// marshalJSONString is json.Marshal into a pooled buffer, for the
+// annotations written on every transition.
+func marshalJSONString(v interface{}) (string, error) {
+	buf := jsonBuffers.Get().(*bytes.Buffer)
+	defer jsonBuffers.Put(buf)
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
@@ -0,0 +1,92 @@
+package annotationscale
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"sigs.k8s.io/yaml"
+)
+
+// planRuntimeFields are the fields the controller records while a plan
+// runs, which WritePlanToYAML leaves out.
+var (
+	planRuntimeFields = []string{"schema_version", "current_step_index", "current_step_state", "message", "last_update_time", "step_available_time", "handed_off", "plan_id", "transitions"}
+	stepRuntimeFields = []string{"skipped", "started_at", "finished_at", "analyzed_at", "analysis_failures", "probe_successes", "drain_started_at", "approved_by"}
+)
+
+// LoadPlanFromYAML reads a plan file using the annotation field names. Steps
+// may be a list or a ParseStepExpression expression. The plan is defaulted
+// and validated like a plan annotated on a workload.
+func LoadPlanFromYAML(data []byte) (*ScaleAnnotation, error) {
+	planJSON, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(planJSON, &fields); err != nil {
+		return nil, err
+	}
+	var expression string
+	if err := json.Unmarshal(fields["steps"], &expression); err == nil {
+		steps, err := ParseStepExpression(expression)
+		if err != nil {
+			return nil, err
+		}
+		if fields["steps"], err = json.Marshal(steps); err != nil {
+			return nil, err
+		}
+		if planJSON, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+
+	scaleAnnotation := NewScaleAnnotation()
+	decoder := json.NewDecoder(bytes.NewReader(planJSON))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&scaleAnnotation); err != nil {
+		return nil, err
+	}
+	defaultStep(&scaleAnnotation)
+	// round trip through the annotations for the same parsing as workloads
+	annotations, err := SetScaleAnnotation(nil, &scaleAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := ReadScaleAnnotation(annotations)
+	if err != nil {
+		return nil, err
+	}
+	if errs := ValidatePlan(plan); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+	return plan, nil
+}
+
+// WritePlanToYAML writes the definition of scaleAnnotation, without the
+// progress the controller records, in the format of LoadPlanFromYAML.
+func WritePlanToYAML(scaleAnnotation *ScaleAnnotation) ([]byte, error) {
+	planJSON, err := json.Marshal(scaleAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(planJSON, &fields); err != nil {
+		return nil, err
+	}
+	for _, field := range planRuntimeFields {
+		delete(fields, field)
+	}
+	steps, _ := fields["steps"].([]interface{})
+	for _, step := range steps {
+		if step, ok := step.(map[string]interface{}); ok {
+			for _, field := range stepRuntimeFields {
+				delete(step, field)
+			}
+		}
+	}
+	planJSON, err = json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(planJSON)
+}
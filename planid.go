@@ -0,0 +1,36 @@
+package annotationscale
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// PlanIDEventAnnotationKey carries ScaleAnnotation.ID on the Events recorded
+// for a plan.
+const PlanIDEventAnnotationKey = "annotationscale.arcosx.io/plan-id"
+
+// adoptPlan gives a plan in flight without an ID one and persists it, so
+// that it stays the same across reconciles and controller restarts. A plan
+// that did not start yet records the replicas of the workload before it.
+func (r *DeploymentReconciler) adoptPlan(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) error {
+	if scaleAnnotation.ID == "" && planInFlight(scaleAnnotation) {
+		scaleAnnotation.ID = string(uuid.NewUUID())
+		if scaleAnnotation.OriginalReplicas == nil && planNotStarted(scaleAnnotation) {
+			replicas := workload.Replicas
+			scaleAnnotation.OriginalReplicas = &replicas
+		}
+		logger.Info("adopt plan", "plan", scaleAnnotation.ID)
+		if err := r.savePlan(ctx, logger, workload, scaleAnnotation, store); err != nil {
+			return err
+		}
+	}
+	workload.planID = scaleAnnotation.ID
+	return nil
+}
+
+func planNotStarted(scaleAnnotation *ScaleAnnotation) bool {
+	return scaleAnnotation.CurrentStepIndex == 1 && scaleAnnotation.CurrentStepState == StepStateReady &&
+		len(scaleAnnotation.Steps) > 0 && scaleAnnotation.Steps[0].StartedAt == nil
+}
@@ -0,0 +1,190 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podFailureReasons are container waiting reasons that will not resolve by
+// waiting for the step deadline.
+var podFailureReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// listPods reads the pods of the workload with their spec and status. The
+// cache only holds the metadata of pods, so they are read from the watch
+// cache of the API server rather than from a second informer of every pod.
+func (r *DeploymentReconciler) listPods(ctx context.Context, workload *Workload) ([]corev1.Pod, error) {
+	if workload.Selector == nil || workload.Selector.Empty() {
+		return nil, nil
+	}
+	reader := r.apiReader
+	if reader == nil {
+		reader = r.Client
+	}
+	pods := &corev1.PodList{}
+	err := reader.List(ctx, pods,
+		client.InNamespace(workload.Object.GetNamespace()),
+		client.MatchingLabelsSelector{Selector: workload.Selector},
+		&client.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: "0"}})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// listPodMetadata lists the metadata of the pods of the workload from the
+// cache, for the checks that need no more.
+func (r *DeploymentReconciler) listPodMetadata(ctx context.Context, workload *Workload) ([]metav1.PartialObjectMetadata, error) {
+	if workload.Selector == nil || workload.Selector.Empty() {
+		return nil, nil
+	}
+	pods := &metav1.PartialObjectMetadataList{}
+	pods.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PodList"))
+	err := r.List(ctx, pods,
+		client.InNamespace(workload.Object.GetNamespace()),
+		client.MatchingLabelsSelector{Selector: workload.Selector})
+	if err != nil {
+		return nil, err
+	}
+	// the items are patched as they are
+	for i := range pods.Items {
+		pods.Items[i].SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+	}
+	return pods.Items, nil
+}
+
+// terminatingPods counts the pods of the workload being deleted.
+func (r *DeploymentReconciler) terminatingPods(ctx context.Context, workload *Workload) (int32, error) {
+	pods, err := r.listPodMetadata(ctx, workload)
+	if err != nil {
+		return 0, err
+	}
+	var terminating int32
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			terminating++
+		}
+	}
+	return terminating, nil
+}
+
+// podUnschedulableGrace gives the scheduler (and a cluster autoscaler) time
+// to place a pending pod before the step is failed.
+const podUnschedulableGrace = time.Minute
+
+// podFailure returns why a pod of the current template of the workload
+// cannot become available, or "" when none is failing. Pods of older
+// templates are left to the rollout replacing them.
+func (r *DeploymentReconciler) podFailure(ctx context.Context, logger logr.Logger, workload *Workload) string {
+	pods, err := r.listPods(ctx, workload)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return ""
+	}
+	label, hash, err := r.currentTemplateHash(ctx, workload)
+	if err != nil {
+		logger.Error(err, "failed to find the current template")
+		return ""
+	}
+	now := r.now()
+	for _, pod := range pods {
+		if label != "" && pod.Labels[label] != hash {
+			continue
+		}
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if message := unschedulable(&pod, now); message != "" {
+			return fmt.Sprintf("pod %s is unschedulable: %s", pod.Name, message)
+		}
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if waiting := status.State.Waiting; waiting != nil && podFailureReasons[waiting.Reason] {
+				return fmt.Sprintf("pod %s container %s: %s: %s", pod.Name, status.Name, waiting.Reason, waiting.Message)
+			}
+		}
+	}
+	return ""
+}
+
+// currentTemplateHash returns the label and its value on the pods of the
+// current template of the workload, "" when the kind does not tell them.
+func (r *DeploymentReconciler) currentTemplateHash(ctx context.Context, workload *Workload) (string, string, error) {
+	switch obj := workload.Object.(type) {
+	case *appsv1.Deployment:
+		if workload.Selector == nil || workload.Selector.Empty() {
+			return "", "", nil
+		}
+		replicaSets := &metav1.PartialObjectMetadataList{}
+		replicaSets.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("ReplicaSetList"))
+		err := r.List(ctx, replicaSets,
+			client.InNamespace(obj.Namespace),
+			client.MatchingLabelsSelector{Selector: workload.Selector})
+		if err != nil {
+			return "", "", err
+		}
+		revision := obj.Annotations[deploymentRevisionAnnotationKey]
+		for _, replicaSet := range replicaSets.Items {
+			owner := metav1.GetControllerOf(&replicaSet)
+			if owner != nil && owner.UID == obj.UID && revision != "" && replicaSet.Annotations[deploymentRevisionAnnotationKey] == revision {
+				return appsv1.DefaultDeploymentUniqueLabelKey, replicaSet.Labels[appsv1.DefaultDeploymentUniqueLabelKey], nil
+			}
+		}
+	case *unstructured.Unstructured:
+		switch obj.GroupVersionKind().GroupKind() {
+		case RolloutGVK.GroupKind():
+			if hash, _, _ := unstructured.NestedString(obj.Object, "status", "currentPodHash"); hash != "" {
+				return "rollouts-pod-template-hash", hash, nil
+			}
+		case CloneSetGVK.GroupKind():
+			if revision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision"); revision != "" {
+				return appsv1.ControllerRevisionHashLabelKey, revision, nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// deploymentRevisionAnnotationKey is the revision the deployment controller
+// gives a Deployment and its ReplicaSet of the current template.
+const deploymentRevisionAnnotationKey = "deployment.kubernetes.io/revision"
+
+// unschedulable returns why pod could not be placed for podUnschedulableGrace
+// at now, or "".
+func unschedulable(pod *corev1.Pod, now time.Time) string {
+	if pod.Status.Phase != corev1.PodPending {
+		return ""
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse &&
+			condition.Reason == corev1.PodReasonUnschedulable &&
+			now.Sub(condition.LastTransitionTime.Time) > podUnschedulableGrace {
+			return condition.Message
+		}
+	}
+	return ""
+}
+
+// failStep moves the plan to StepStateError and pauses the workload.
+func (r *DeploymentReconciler) failStep(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore, reason string) error {
+	newLastUpdateTime := r.now()
+	logger.V(2).Info("change step state", "newState", StepStateError, "lastUpdateTime", scaleAnnotation.LastUpdateTime, "reason", reason)
+	scaleAnnotation.CurrentStepState = StepStateError
+	scaleAnnotation.Message = reason
+	scaleAnnotation.LastUpdateTime = newLastUpdateTime
+	workload.Paused = true
+	return r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+}
@@ -0,0 +1,84 @@
+package annotationscale
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// deploymentChanged passes Deployment updates changing replicas, paused, the
+// scale annotations, the status replica counts, the observed generation or
+// the Progressing condition, or starting the deletion.
+var deploymentChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		before, ok := e.ObjectOld.(*appsv1.Deployment)
+		if !ok {
+			return true
+		}
+		after, ok := e.ObjectNew.(*appsv1.Deployment)
+		if !ok {
+			return true
+		}
+		return !equality.Semantic.DeepEqual(before.Spec.Replicas, after.Spec.Replicas) ||
+			before.Spec.Paused != after.Spec.Paused ||
+			before.Status.Replicas != after.Status.Replicas ||
+			before.Status.AvailableReplicas != after.Status.AvailableReplicas ||
+			before.Status.UnavailableReplicas != after.Status.UnavailableReplicas ||
+			before.Status.ReadyReplicas != after.Status.ReadyReplicas ||
+			before.Status.UpdatedReplicas != after.Status.UpdatedReplicas ||
+			before.Status.ObservedGeneration != after.Status.ObservedGeneration ||
+			progressingChanged(before, after) ||
+			scaleAnnotationsChanged(before.Annotations, after.Annotations) ||
+			(before.DeletionTimestamp == nil) != (after.DeletionTimestamp == nil)
+	},
+}
+
+// progressingChanged compares the status and reason of the Progressing
+// conditions, e.g. once the progress deadline is exceeded.
+func progressingChanged(before, after *appsv1.Deployment) bool {
+	progressing := func(deployment *appsv1.Deployment) (corev1.ConditionStatus, string) {
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing {
+				return condition.Status, condition.Reason
+			}
+		}
+		return "", ""
+	}
+	beforeStatus, beforeReason := progressing(before)
+	afterStatus, afterReason := progressing(after)
+	return beforeStatus != afterStatus || beforeReason != afterReason
+}
+
+// ownedChanged passes metadata-only updates of ReplicaSets and pods that
+// change their generation, e.g. the ReplicaSet replicas, or start their
+// deletion. Availability changes reach the reconciler through the Deployment
+// status.
+var ownedChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+			(e.ObjectOld.GetDeletionTimestamp() == nil) != (e.ObjectNew.GetDeletionTimestamp() == nil)
+	},
+}
+
+// scaleAnnotationsChanged compares the annotations the controller reads.
+func scaleAnnotationsChanged(before, after map[string]string) bool {
+	for key, value := range after {
+		if isScaleAnnotation(key) && before[key] != value {
+			return true
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok && isScaleAnnotation(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func isScaleAnnotation(key string) bool {
+	return isPlanAnnotation(key) || strings.HasPrefix(key, "annotationscale.arcosx.io/")
+}
@@ -0,0 +1,170 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// StepProbe is an HTTP check run against the ready pods of the workload, or
+// its Service, before an available step is done. It catches pods that report
+// Ready but fail real requests.
+type StepProbe struct {
+	Path string `json:"path,omitempty"`
+	Port int    `json:"port"`
+	// Scheme is "http" (default) or "https".
+	Scheme string `json:"scheme,omitempty"`
+	// Service probes <service>.<namespace>.svc instead of every pod.
+	Service string `json:"service,omitempty"`
+	// ExpectedStatus accepts only this status code instead of any 2xx.
+	ExpectedStatus int `json:"expected_status,omitempty"`
+	// SuccessThreshold is how many probes in a row must pass, 1 by default.
+	SuccessThreshold int `json:"success_threshold,omitempty"`
+	// PeriodSeconds between probes, 5 by default.
+	PeriodSeconds int `json:"period_seconds,omitempty"`
+	// TimeoutSeconds of each request, 5 by default.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+func (p *StepProbe) period() time.Duration {
+	if p.PeriodSeconds > 0 {
+		return time.Duration(p.PeriodSeconds) * time.Second
+	}
+	return 5 * time.Second
+}
+
+func (p *StepProbe) timeout() time.Duration {
+	if p.TimeoutSeconds > 0 {
+		return time.Duration(p.TimeoutSeconds) * time.Second
+	}
+	return 5 * time.Second
+}
+
+func (p *StepProbe) successThreshold() int {
+	if p.SuccessThreshold > 0 {
+		return p.SuccessThreshold
+	}
+	return 1
+}
+
+// probeStep probes an available step until SuccessThreshold probes passed in
+// a row. A step still failing its probe at the step deadline is failed. It
+// returns true when the reconcile should stop here.
+func (r *DeploymentReconciler) probeStep(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (bool, reconcile.Result, error) {
+	step := &scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1]
+	probe := step.Probe
+	if probe == nil || step.ProbeSuccesses >= probe.successThreshold() {
+		return false, reconcile.Result{}, nil
+	}
+
+	err := r.runProbe(ctx, probe, workload)
+	if err == nil {
+		step.ProbeSuccesses++
+		logger.V(2).Info("probe passed", "successes", step.ProbeSuccesses, "success threshold", probe.successThreshold())
+		if strings.HasPrefix(scaleAnnotation.Message, heldMessagePrefix) {
+			scaleAnnotation.Message = ""
+		}
+		if step.ProbeSuccesses >= probe.successThreshold() {
+			// persisted with the transition out of the step
+			return false, reconcile.Result{}, nil
+		}
+		return true, reconcile.Result{RequeueAfter: probe.period()}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+	}
+
+	reason := fmt.Sprintf("probe failed: %s", err)
+	logger.V(2).Info(reason)
+	if scaleAnnotation.StepExpired(r.clock) {
+		return true, reconcile.Result{}, r.failStep(ctx, logger, workload, scaleAnnotation, store, reason)
+	}
+	step.ProbeSuccesses = 0
+	scaleAnnotation.Message = heldMessagePrefix + reason
+	return true, reconcile.Result{RequeueAfter: probe.period()}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+}
+
+// runProbe probes the Service, or every ready pod of the workload.
+func (r *DeploymentReconciler) runProbe(ctx context.Context, probe *StepProbe, workload *Workload) error {
+	if probe.Service != "" {
+		return r.probeHost(ctx, probe, fmt.Sprintf("%s.%s.svc", probe.Service, workload.Object.GetNamespace()))
+	}
+	pods, err := r.listPods(ctx, workload)
+	if err != nil {
+		return err
+	}
+	probed := 0
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.PodIP == "" || !podReady(&pod) {
+			continue
+		}
+		if err := r.probeHost(ctx, probe, pod.Status.PodIP); err != nil {
+			return fmt.Errorf("pod %s: %w", pod.Name, err)
+		}
+		probed++
+	}
+	if probed == 0 {
+		return fmt.Errorf("no ready pods to probe")
+	}
+	return nil
+}
+
+func (r *DeploymentReconciler) probeHost(ctx context.Context, probe *StepProbe, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, probe.timeout())
+	defer cancel()
+
+	scheme := probe.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	path := probe.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, strconv.Itoa(probe.Port)), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	httpClient := r.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if probe.ExpectedStatus != 0 {
+		if resp.StatusCode != probe.ExpectedStatus {
+			return fmt.Errorf("status %d, want %d", resp.StatusCode, probe.ExpectedStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	return podCondition(pod, corev1.PodReady)
+}
+
+func podCondition(pod *corev1.Pod, conditionType corev1.PodConditionType) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// preflightStep pauses the plan before step index when its new pods would
+// exceed a ResourceQuota or, with a CapacityCheck, the nodes' capacity. It
+// returns true when the plan was paused.
+func (r *DeploymentReconciler) preflightStep(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore, index int) (bool, error) {
+	replicas := scaleAnnotation.StepReplicas(index) - workload.Replicas
+	shortfall, err := r.quotaShortfall(ctx, workload, replicas)
+	if err != nil {
+		logger.Error(err, "failed to check resourcequotas")
+		return false, err
+	}
+	if shortfall == "" && r.capacityCheck != nil {
+		shortfall, err = r.capacityShortfall(ctx, workload, replicas)
+		if err != nil {
+			logger.Error(err, "failed to check cluster capacity")
+			return false, err
+		}
+		if shortfall != "" && r.capacityCheck.WarnOnly {
+			logger.Info("step may not fit the cluster", "step", index, "reason", shortfall)
+			return false, nil
+		}
+	}
+	if shortfall == "" {
+		return false, nil
+	}
+	logger.V(2).Info("step does not fit", "newState", StepStatePaused, "nextStep", index, "reason", shortfall)
+	scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Pause = true
+	scaleAnnotation.CurrentStepState = StepStatePaused
+	scaleAnnotation.Message = fmt.Sprintf("step %d does not fit: %s", index, shortfall)
+	scaleAnnotation.LastUpdateTime = r.now()
+	return true, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+}
+
+// quotaShortfall returns why adding replicas pods of the workload would
+// exceed a ResourceQuota of its namespace, or "" when they fit. Scoped quotas
+// are not checked.
+func (r *DeploymentReconciler) quotaShortfall(ctx context.Context, workload *Workload, replicas int32) (string, error) {
+	quotas := &corev1.ResourceQuotaList{}
+	if err := r.List(ctx, quotas, client.InNamespace(workload.Object.GetNamespace())); err != nil {
+		return "", err
+	}
+	if len(quotas.Items) == 0 {
+		return "", nil
+	}
+	template := podTemplate(workload)
+	if template == nil {
+		return "", nil
+	}
+	need := podResources(&template.Spec, replicas)
+	for _, quota := range quotas.Items {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		var over []string
+		for name, hard := range quota.Status.Hard {
+			quantity, ok := need[name]
+			if !ok {
+				continue
+			}
+			total := quota.Status.Used[name].DeepCopy()
+			total.Add(quantity)
+			if total.Cmp(hard) > 0 {
+				used := quota.Status.Used[name]
+				over = append(over, fmt.Sprintf("%s %s+%s > %s", name, used.String(), quantity.String(), hard.String()))
+			}
+		}
+		if len(over) > 0 {
+			sort.Strings(over)
+			return fmt.Sprintf("resourcequota %s: %s", quota.Name, strings.Join(over, ", ")), nil
+		}
+	}
+	return "", nil
+}
+
+// podResources is what replicas pods of spec count against a quota.
+func podResources(spec *corev1.PodSpec, replicas int32) corev1.ResourceList {
+	requests, limits := corev1.ResourceList{}, corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		addResources(requests, container.Resources.Requests)
+		addResources(limits, container.Resources.Limits)
+	}
+	// init containers run one at a time before the others
+	for _, container := range spec.InitContainers {
+		maxResources(requests, container.Resources.Requests)
+		maxResources(limits, container.Resources.Limits)
+	}
+	addResources(requests, spec.Overhead)
+	addResources(limits, spec.Overhead)
+
+	need := corev1.ResourceList{
+		corev1.ResourcePods:               *resource.NewQuantity(int64(replicas), resource.DecimalSI),
+		corev1.ResourceName("count/pods"): *resource.NewQuantity(int64(replicas), resource.DecimalSI),
+	}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage} {
+		if quantity, ok := requests[name]; ok {
+			total := multiply(quantity, replicas)
+			need[name] = total
+			need[corev1.ResourceName("requests."+string(name))] = total
+		}
+		if quantity, ok := limits[name]; ok {
+			need[corev1.ResourceName("limits."+string(name))] = multiply(quantity, replicas)
+		}
+	}
+	return need
+}
+
+func addResources(total, list corev1.ResourceList) {
+	for name, quantity := range list {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
+
+func maxResources(total, list corev1.ResourceList) {
+	for name, quantity := range list {
+		if current, ok := total[name]; !ok || quantity.Cmp(current) > 0 {
+			total[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+func multiply(quantity resource.Quantity, n int32) resource.Quantity {
+	total := resource.Quantity{Format: quantity.Format}
+	for i := int32(0); i < n; i++ {
+		total.Add(quantity)
+	}
+	return total
+}
+
+// podTemplate returns the pod template of the workload, nil when it has none.
+func podTemplate(workload *Workload) *corev1.PodTemplateSpec {
+	switch obj := workload.Object.(type) {
+	case *appsv1.Deployment:
+		return &obj.Spec.Template
+	case *unstructured.Unstructured:
+		raw, found, err := unstructured.NestedMap(obj.Object, "spec", "template")
+		if err != nil || !found {
+			return nil
+		}
+		template := &corev1.PodTemplateSpec{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, template); err != nil {
+			return nil
+		}
+		return template
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package annotationscale
+
+import (
+	"sync"
+	"time"
+)
+
+const rampDelayedMessage = "delayed: replica ramp rate limit"
+
+// RampLimit bounds the replicas added by steps per minute, smoothing the
+// load of coordinated scale ups. Zero values mean no limit.
+type RampLimit struct {
+	// ReplicasPerMinute is shared by every plan of the manager.
+	ReplicasPerMinute int32
+	// NamespaceReplicasPerMinute is shared by the plans of each namespace.
+	NamespaceReplicasPerMinute int32
+}
+
+type rampEvent struct {
+	at        time.Time
+	namespace string
+	replicas  int32
+}
+
+// rampLimiter keeps the steps scaled up in the last minute.
+type rampLimiter struct {
+	mu     sync.Mutex
+	limit  RampLimit
+	events []rampEvent
+}
+
+func newRampLimiter(limit *RampLimit) *rampLimiter {
+	if limit == nil || (limit.ReplicasPerMinute <= 0 && limit.NamespaceReplicasPerMinute <= 0) {
+		return nil
+	}
+	return &rampLimiter{limit: *limit}
+}
+
+// reserve records replicas added in namespace at now. When that would exceed
+// a limit nothing is recorded and it returns how long to wait instead. A step
+// adding more than a limit on its own waits for a quiet minute.
+func (l *rampLimiter) reserve(namespace string, replicas int32, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	window := now.Add(-time.Minute)
+	kept := l.events[:0]
+	for _, event := range l.events {
+		if event.at.After(window) {
+			kept = append(kept, event)
+		}
+	}
+	l.events = kept
+
+	var wait time.Duration
+	if d := l.wait(l.limit.ReplicasPerMinute, "", replicas, now); d > wait {
+		wait = d
+	}
+	if d := l.wait(l.limit.NamespaceReplicasPerMinute, namespace, replicas, now); d > wait {
+		wait = d
+	}
+	if wait > 0 {
+		return wait
+	}
+	l.events = append(l.events, rampEvent{at: now, namespace: namespace, replicas: replicas})
+	return 0
+}
+
+// wait is how long until replicas fit in limit, counting the events of
+// namespace or of every namespace when it is empty.
+func (l *rampLimiter) wait(limit int32, namespace string, replicas int32, now time.Time) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	var events []rampEvent
+	var used int32
+	for _, event := range l.events {
+		if namespace == "" || event.namespace == namespace {
+			events = append(events, event)
+			used += event.replicas
+		}
+	}
+	if replicas > limit {
+		replicas = limit
+	}
+	// events are in time order, the oldest expire first
+	for _, event := range events {
+		if used+replicas <= limit {
+			break
+		}
+		used -= event.replicas
+		if used+replicas <= limit {
+			return event.at.Add(time.Minute).Sub(now)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package annotationscale
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// RateLimiterOptions tunes the workqueue rate limiter of the controllers:
+// failed requests are retried after BaseDelay, doubled on every failure up
+// to MaxDelay, and all retries share a token bucket of QPS and Burst. Zero
+// fields keep the controller-runtime defaults of 5ms, 1000s, 10 and 100.
+type RateLimiterOptions struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	QPS       float64
+	Burst     int
+}
+
+// rateLimiter returns a new rate limiter, controllers must not share one. A
+// nil RateLimiterOptions returns the controller-runtime default.
+func (o *RateLimiterOptions) rateLimiter() workqueue.RateLimiter {
+	if o == nil {
+		return workqueue.DefaultControllerRateLimiter()
+	}
+	baseDelay, maxDelay, qps, burst := o.BaseDelay, o.MaxDelay, o.QPS, o.Burst
+	if baseDelay <= 0 {
+		baseDelay = 5 * time.Millisecond
+	}
+	if maxDelay <= 0 {
+		maxDelay = 1000 * time.Second
+	}
+	if qps <= 0 {
+		qps = 10
+	}
+	if burst <= 0 {
+		burst = 100
+	}
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+func (o *RateLimiterOptions) controllerOptions() controller.Options {
+	if o == nil {
+		return controller.Options{}
+	}
+	return controller.Options{RateLimiter: o.rateLimiter()}
+}
+
+// NamespaceRateLimit is a token bucket of reconciles.
+type NamespaceRateLimit struct {
+	// QPS is the sustained rate of reconciles per second.
+	QPS float64
+	// Burst defaults to 1.
+	Burst int
+}
+
+// NamespaceRateLimits bounds the reconciles of each namespace, so that one
+// namespace with many workloads cannot monopolize the controller.
+type NamespaceRateLimits struct {
+	// Default applies to every namespace not in Namespaces.
+	Default NamespaceRateLimit
+	// Namespaces overrides Default by namespace.
+	Namespaces map[string]NamespaceRateLimit
+}
+
+// namespaceRateLimiter is the workqueue rate limiter of the controller. It
+// delays retries until the namespace has a token, and Reconcile requeues
+// requests of namespaces that are out of tokens.
+type namespaceRateLimiter struct {
+	workqueue.RateLimiter
+	cluster string
+	limits  NamespaceRateLimits
+	// clock defaults to the wall clock.
+	clock Clock
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newNamespaceRateLimiter(cluster string, limits *NamespaceRateLimits, base workqueue.RateLimiter, clock Clock) *namespaceRateLimiter {
+	if limits == nil {
+		return nil
+	}
+	return &namespaceRateLimiter{
+		RateLimiter: base,
+		cluster:     cluster,
+		limits:      *limits,
+		clock:       clock,
+		limiters:    map[string]*rate.Limiter{},
+	}
+}
+
+func (l *namespaceRateLimiter) now() time.Time {
+	if l.clock == nil {
+		return time.Now()
+	}
+	return l.clock.Now()
+}
+
+func (l *namespaceRateLimiter) limiter(namespace string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, ok := l.limiters[namespace]
+	if !ok {
+		limit, ok := l.limits.Namespaces[namespace]
+		if !ok {
+			limit = l.limits.Default
+		}
+		qps := rate.Limit(limit.QPS)
+		if limit.QPS <= 0 {
+			qps = rate.Inf
+		}
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(qps, burst)
+		l.limiters[namespace] = limiter
+	}
+	return limiter
+}
+
+// delay is how long until namespace has a token, without taking it.
+func (l *namespaceRateLimiter) delay(namespace string, now time.Time) time.Duration {
+	reservation := l.limiter(namespace).ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	reservation.CancelAt(now)
+	return delay
+}
+
+// reserve takes a token of namespace. When there is none it returns how
+// long to wait for one instead.
+func (l *namespaceRateLimiter) reserve(namespace string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	now := l.now()
+	reservation := l.limiter(namespace).ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		namespaceThrottledTotal.WithLabelValues(l.cluster, namespace).Inc()
+	}
+	return delay
+}
+
+func (l *namespaceRateLimiter) When(item interface{}) time.Duration {
+	delay := l.RateLimiter.When(item)
+	if req, ok := item.(reconcile.Request); ok {
+		if namespaceDelay := l.delay(req.Namespace, l.now()); namespaceDelay > delay {
+			delay = namespaceDelay
+		}
+	}
+	return delay
+}
@@ -3,45 +3,167 @@ package annotationscale
 import (
 	"context"
 	"errors"
-	"fmt"
+	"net/http"
 	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DeploymentReconciler struct {
 	client.Client
-	log *logr.Logger
+	log       *logr.Logger
+	cluster   string
+	workloads workloadClient
+	// apiReader reads objects the cache may not hold, e.g. pods on all nodes.
+	apiReader client.Reader
+
+	annotationFormat AnnotationFormat
+	blackoutWindows  []Window
+	historyLimit     int
+	hooks            Hooks
+	httpClient       *http.Client
+
+	prometheusAddress   string
+	resourceGateOptions *ResourceGate
+	keda                bool
+	capacityCheck       *CapacityCheck
+	podDeletionCost     PodDeletionCostFunc
+	planBudget          *planBudget
+	rampLimiter         *rampLimiter
+	namespaceLimiter    *namespaceRateLimiter
+	namespaces          *NamespaceFilter
+	stateStore          StateStore
+	clock               Clock
+	shadow              bool
+	planCache           *planCache
+	requeue             *requeueBackoff
+	drain               *reconcileDrain
+	availability        AvailabilityCriterion
+	availableReplicas   AvailableReplicasFunc
+	waitTerminating     bool
+	podReadiness        *PodReadiness
+	externalReplicas    ExternalReplicasPolicy
+	pauseOnRollout      bool
+	ownership           *ownershipClaims
+	foreignControllers  *ForeignControllers
+	freeze              *Freeze
+	freezeConfigMap     *freezeConfigMap
+	namespacePause      bool
+	finalizer           bool
+	notifiers           []Notifier
+	cloudEvents         *CloudEventsSink
+	tracerProvider      trace.TracerProvider
+	// recorder records Events on workloads.
+	recorder record.EventRecorder
 }
 
 // This function will be called when there is a change to a Deployment or a ReplicaSet or a Pod with an OwnerReference
-// to a Deployment.
-func (r *DeploymentReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+// to a Deployment. In scale subresource mode it is called for changes to the configured kind instead.
+func (r *DeploymentReconciler) Reconcile(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
 	r.log.V(2).Info("Reconcile", "request", req)
-	deployment := &appsv1.Deployment{}
-	err := r.Get(ctx, req.NamespacedName, deployment)
+	ctx, cancel := r.drain.detach(ctx)
+	defer cancel()
+	ctx, span := r.tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("annotationscale.workload", req.Name),
+	))
+	defer func() { endSpan(span, err) }()
+	if delay := r.namespaceLimiter.reserve(req.Namespace); delay > 0 {
+		r.log.V(5).Info("namespace rate limited", "namespace", req.Namespace, "delay", delay.String())
+		return reconcile.Result{RequeueAfter: delay}, nil
+	}
+	if allowed, err := r.namespaces.allows(ctx, r.Client, req.Namespace); !allowed {
+		r.log.V(5).Info("namespace not managed", "namespace", req.Namespace)
+		return reconcile.Result{}, err
+	}
+	workload, err := r.workloadClient().Get(ctx, req.NamespacedName)
 	if err != nil {
 		if kerrors.IsNotFound(err) {
-			r.log.Info("deployment resource not found. Ignoring since object must be deleted")
+			r.log.Info("workload resource not found. Ignoring since object must be deleted")
+			forgetWorkloadMetrics(r.cluster, req.Namespace, req.Name)
+			r.planBudget.release(req.NamespacedName)
+			r.planCache.forget(req.NamespacedName)
+			r.ownership.release(req.NamespacedName)
+			r.requeue.forget(req.NamespacedName)
 			return reconcile.Result{}, nil
 		}
-		r.log.Error(err, fmt.Sprintf("failed to get deployment %s", req.Name))
+		r.log.Error(err, "failed to get workload", "workload", req.Name, "namespace", req.Namespace)
 		return reconcile.Result{}, err
 	}
+	store := r.stateStore
+	if store == nil {
+		store = annotationStore{format: r.annotationFormat, cache: r.planCache}
+	}
+	if workload.Object.GetDeletionTimestamp() != nil {
+		if controllerutil.ContainsFinalizer(workload.Object, PlanFinalizer) {
+			return r.teardown(ctx, workload, store)
+		}
+		return reconcile.Result{}, nil
+	}
+	if r.refuseForeign(workload) {
+		return reconcile.Result{}, nil
+	}
+	if r.namespacePause {
+		paused, err := namespacePaused(ctx, r.Client, req.Namespace)
+		if err != nil {
+			r.log.Error(err, "failed to get namespace", "namespace", req.Namespace)
+			return reconcile.Result{}, err
+		}
+		if paused {
+			if !hasPlanAnnotations(workload.Object) {
+				return reconcile.Result{}, nil
+			}
+			r.log.V(2).Info("namespace paused, suspend plan", "namespace", req.Namespace, "workload", req.Name)
+			return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+	}
 
-	scaleAnnotation, err := ReadScaleAnnotation(deployment.Annotations)
+	scheduleResult, applied, err := r.reconcileSchedules(ctx, r.workloadLogger(workload), workload, store)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if applied {
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, nil
+	}
+	applied, err = r.reconcileFollow(ctx, r.workloadLogger(workload), workload, store)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if applied {
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, nil
+	}
+	result, err = r.reconcileAnnotations(ctx, workload, store)
+	return earliestRequeue(result, scheduleResult), err
+}
+
+func (r *DeploymentReconciler) reconcileAnnotations(ctx context.Context, workload *Workload, store StateStore) (reconcile.Result, error) {
+	scaleAnnotation, err := store.Read(ctx, workload)
 
 	if err != nil {
 		if errors.Is(err, ErrorScaleAnnotationParseSteps) ||
 			errors.Is(err, ErrorScaleAnnotationParseCurrentStepIndex) ||
 			errors.Is(err, ErrorScaleAnnotationParseCurrentStepState) {
 			r.log.V(2).Info("failed to parse scale annotation", "error", err)
+			r.planBudget.release(client.ObjectKeyFromObject(workload.Object))
+			if err := r.syncFinalizer(ctx, *r.log, workload, nil); err != nil {
+				r.log.Error(err, "failed to remove finalizer")
+				return reconcile.Result{}, err
+			}
+			// the plan was removed, hand the workload back to KEDA
+			return reconcile.Result{}, r.syncScaledObjects(ctx, *r.log, workload, nil)
+		} else if errors.Is(err, ErrorScaleAnnotationSchemaVersion) {
+			// written by a newer controller, leave it alone
+			r.log.Info("skip scale annotation", "error", err)
 			return reconcile.Result{}, nil
 		} else {
 			r.log.V(5).Error(err, "failed to parse scale annotation")
@@ -49,337 +171,391 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req reconcile.Requ
 		}
 	}
 
-	logger := r.log.WithName(deployment.Name)
+	logger := r.workloadLogger(workload)
+	if err := r.adoptPlan(ctx, logger, workload, scaleAnnotation, store); err != nil {
+		logger.Error(err, "failed to adopt plan")
+		return reconcile.Result{}, err
+	}
+	if scaleAnnotation.ID != "" {
+		logger = logger.WithValues("plan", scaleAnnotation.ID)
+	}
+	if err := r.recordHistory(ctx, logger, workload, scaleAnnotation); err != nil {
+		logger.Error(err, "failed to record plan history")
+		return reconcile.Result{}, err
+	}
+	if err := r.syncFinalizer(ctx, logger, workload, scaleAnnotation); err != nil {
+		logger.Error(err, "failed to update finalizer")
+		return reconcile.Result{}, err
+	}
+	result, err := r.reconcilePlan(ctx, logger, workload, scaleAnnotation, store)
+	if err != nil {
+		return result, err
+	}
+	result = r.requeue.backoff(workload.Object, scaleAnnotation, result, r.now())
+	if err := r.syncScaledObjects(ctx, logger, workload, scaleAnnotation); err != nil {
+		logger.Error(err, "failed to sync scaledobjects")
+		return reconcile.Result{}, err
+	}
+	return result, nil
+}
+
+// reconcilePlan drives the workload one transition forward. Plan changes are
+// staged through store and persisted with the workload patch.
+func (r *DeploymentReconciler) reconcilePlan(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (result reconcile.Result, err error) {
+	before := *scaleAnnotation
+	beforeStep := snapshotStep(scaleAnnotation)
+	audit := newAuditStore(store, scaleAnnotation)
+	store = audit
+	defer func() {
+		r.planBudget.observe(client.ObjectKeyFromObject(workload.Object), scaleAnnotation)
+		if err != nil {
+			reconcileErrorsTotal.WithLabelValues(r.cluster, workload.Object.GetNamespace(), workload.Object.GetName()).Inc()
+			return
+		}
+		observeTransition(r.cluster, workload, &before, scaleAnnotation)
+		r.runHooks(ctx, workload, beforeStep, scaleAnnotation)
+		r.notify(ctx, workload, beforeStep, scaleAnnotation)
+		r.emitCloudEvent(ctx, workload, beforeStep, scaleAnnotation)
+		r.tracePlan(ctx, workload, beforeStep, scaleAnnotation)
+	}()
 
 	logger.V(2).Info(
 		"detail",
-		"spec.paused", deployment.Spec.Paused,
-		"spec.replicas", *deployment.Spec.Replicas,
-		"status.replicas", deployment.Status.Replicas,
-		"status.available-replicas", deployment.Status.AvailableReplicas,
-		"status.unavailable-replicas", deployment.Status.UnavailableReplicas,
-		"status.ready-replicas", deployment.Status.ReadyReplicas,
-		"status.updated-replicas", deployment.Status.UpdatedReplicas,
+		"spec.paused", workload.Paused,
+		"spec.replicas", workload.Replicas,
+		"status.replicas", workload.Status.Replicas,
+		"status.available-replicas", workload.Status.AvailableReplicas,
+		"status.unavailable-replicas", workload.Status.UnavailableReplicas,
+		"status.ready-replicas", workload.Status.ReadyReplicas,
+		"status.updated-replicas", workload.Status.UpdatedReplicas,
 	)
 
-	logger.V(2).Info(scaleAnnotation.String())
-
-	switch scaleAnnotation.CurrentStepState {
-	case StepStateUpgrade:
-		if *deployment.Spec.Replicas != scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Replicas {
-			r.fixDeploymentReplicas(ctx, logger, deployment, scaleAnnotation)
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
-		}
+	logger = logger.WithValues("step", scaleAnnotation.CurrentStepIndex, "state", scaleAnnotation.CurrentStepState)
+	logger.V(2).Info("plan",
+		"steps", len(scaleAnnotation.Steps),
+		"message", scaleAnnotation.Message,
+		"lastUpdateTime", scaleAnnotation.LastUpdateTime,
+		"deadline", scaleAnnotation.StepDeadline(),
+	)
 
-		// Spec.Paused in StepUpgrade Status must be false
-		if deployment.Spec.Paused {
-			deployment.Spec.Paused = false
-			logger.V(2).Info("current is paused, will set spec.paused false")
-			err = r.patchDeployment(ctx, logger, deployment)
-			if err != nil {
-				logger.Error(err, "failed to patch deployment")
-				return reconcile.Result{RequeueAfter: 5 * time.Second}, err
-			}
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
+	if scaleAnnotation.CurrentStepState != StepStateAborted && !scaleAnnotation.HandedOff {
+		owned, err := r.claimOwnership(ctx, logger, workload)
+		if err != nil {
+			logger.Error(err, "failed to claim the plan")
+			return reconcile.Result{}, err
 		}
-
-		if deployment.Status.Replicas != *deployment.Spec.Replicas {
-			logger.V(5).Info(fmt.Sprintf("waiting for rollout to finish: %d out of %d new replicas have been updated",
-				deployment.Status.Replicas, *deployment.Spec.Replicas))
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, fmt.Errorf("waiting for rollout to finish: %d out of %d new replicas have been updated",
-				deployment.Status.Replicas, *deployment.Spec.Replicas)
+		if !owned {
+			return reconcile.Result{RequeueAfter: r.ownership.duration}, nil
 		}
+	}
 
-		if deployment.Status.Replicas == deployment.Status.AvailableReplicas {
-			if scaleAnnotation.CurrentStepIndex == len(scaleAnnotation.Steps) {
-				// if deployment.Status.Replicas == scaleAnnotation.Steps[len(scaleAnnotation.Steps)-1].Replicas {
-				newLastUpdateTime := time.Now()
-				logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-					scaleAnnotation.CurrentStepState, StepStateCompleted, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-				scaleAnnotation.CurrentStepState = StepStateCompleted
-				scaleAnnotation.LastUpdateTime = newLastUpdateTime
-			} else {
-				newLastUpdateTime := time.Now()
-				logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-					scaleAnnotation.CurrentStepState, StepStateReady, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-				scaleAnnotation.CurrentStepState = StepStateReady
-				scaleAnnotation.LastUpdateTime = newLastUpdateTime
-			}
-
-		} else {
-			now := time.Now()
-			stepDeadline := scaleAnnotation.StepDeadline()
-			if now.Before(stepDeadline) {
-				logger.V(2).Info(fmt.Sprintf("upgrading now....status.Replicas(%d) status.AvailableReplicas(%d) ", deployment.Status.Replicas, deployment.Status.AvailableReplicas))
-				return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
-			} else {
-				logger.V(2).Info("touch step deadline!", "from", stepDeadline.String(), "duration seconds", now.Sub(stepDeadline).Seconds())
-				if deployment.Status.UnavailableReplicas > int32(scaleAnnotation.MaxUnavailableReplicas) {
-					logger.V(2).Info("touch step deadline!",
-						fmt.Sprintf("the unavailable replicas %d is [more than] maxUnavailableReplicas %d ",
-							deployment.Status.UnavailableReplicas,
-							scaleAnnotation.MaxUnavailableReplicas))
-					newLastUpdateTime := time.Now()
-					logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-						scaleAnnotation.CurrentStepState, StepStateTimeout, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-					scaleAnnotation.CurrentStepState = StepStateTimeout
-					scaleAnnotation.LastUpdateTime = newLastUpdateTime
-				} else {
-					// when timeout, but the unavailable replicas is less than maxUnavailableReplicas, we think it is completed
-					logger.V(2).Info("touch step deadline!",
-						fmt.Sprintf("the unavailable replicas %d is [less than] maxUnavailableReplicas %d ",
-							deployment.Status.UnavailableReplicas,
-							scaleAnnotation.MaxUnavailableReplicas))
-
-					if scaleAnnotation.CurrentStepIndex == len(scaleAnnotation.Steps) {
-						newLastUpdateTime := time.Now()
-						logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-							scaleAnnotation.CurrentStepState, StepStateCompleted, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-						scaleAnnotation.CurrentStepState = StepStateCompleted
-						scaleAnnotation.LastUpdateTime = newLastUpdateTime
-					} else {
-						newLastUpdateTime := time.Now()
-						logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-							scaleAnnotation.CurrentStepState, StepStateReady, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-						scaleAnnotation.CurrentStepState = StepStateReady
-						scaleAnnotation.LastUpdateTime = newLastUpdateTime
-					}
-				}
+	if changed, err := r.approveStep(ctx, logger, workload, scaleAnnotation, store); changed || err != nil {
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, err
+	}
 
-			}
+	if r.pauseOnRollout {
+		if held, err := r.holdForRollout(ctx, logger, workload, scaleAnnotation, store); held || err != nil {
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, err
 		}
+	}
 
-		err = SetDeploymentScaleAnnotation(deployment, scaleAnnotation)
+	if changed, err := r.syncMinReadySeconds(ctx, logger, workload, scaleAnnotation); changed || err != nil {
 		if err != nil {
-			logger.Error(err, "failed set scale annotation")
-			return reconcile.Result{}, err
+			logger.Error(err, "failed to patch minReadySeconds")
 		}
-
-		err = r.patchDeployment(ctx, logger, deployment)
-
-		if err != nil {
-			logger.Error(err, "patchAnnotations failed")
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, err
+	}
+	if r.waitTerminating {
+		if workload.Status.TerminatingReplicas, err = r.terminatingPods(ctx, workload); err != nil {
+			logger.Error(err, "failed to list pods")
 			return reconcile.Result{}, err
 		}
+	}
+	if err := r.applyAvailability(ctx, workload); err != nil {
+		logger.Error(err, "failed to count the available replicas")
+		return reconcile.Result{}, err
+	}
+	if err := r.clearDrains(ctx, logger, workload, scaleAnnotation); err != nil {
+		logger.Error(err, "failed to clear draining pods")
+	}
 
-	case StepStatePaused:
-		if *deployment.Spec.Replicas != scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Replicas {
-			r.fixDeploymentReplicas(ctx, logger, deployment, scaleAnnotation)
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
-		}
-
-		if deployment.Status.Replicas != *deployment.Spec.Replicas {
-			logger.V(2).Info(fmt.Sprintf("waiting for rollout to finish: %d out of %d new replicas have been updated",
-				deployment.Status.Replicas, *deployment.Spec.Replicas))
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, fmt.Errorf("waiting for rollout to finish: %d out of %d new replicas have been updated",
-				deployment.Status.Replicas, *deployment.Spec.Replicas)
-		}
+	now := r.now()
+	t := NextTransition(scaleAnnotation, workload, now)
+	logger.V(4).Info("next transition", "transition", t.String())
+	audit.reason = t.Reason
 
-		if deployment.Status.Replicas == deployment.Status.AvailableReplicas {
-			if deployment.Spec.Paused {
-				logger.V(2).Info("is paused, do not need set")
-				return reconcile.Result{}, nil
+	switch t.Kind {
+	case TransitionNone:
+		if scaleAnnotation.CurrentStepState == StepStateCompleted && !scaleAnnotation.HandedOff {
+			handedOff, err := r.handOff(ctx, logger, workload, scaleAnnotation)
+			if err != nil {
+				logger.Error(err, "failed to hand off")
+				return reconcile.Result{}, err
 			}
-			newLastUpdateTime := time.Now()
-			logger.V(2).Info(fmt.Sprintf("is paused and set spec.paused true, change last update time: %s --> %s",
-				scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-			deployment.Spec.Paused = true
-			scaleAnnotation.LastUpdateTime = time.Now()
-		} else {
-			now := time.Now()
-			stepDeadline := scaleAnnotation.StepDeadline()
-			if now.Before(stepDeadline) {
-				logger.V(2).Info(fmt.Sprintf("upgrading to pause point now....status.Replicas(%d) status.AvailableReplicas(%d) ",
-					deployment.Status.Replicas,
-					deployment.Status.AvailableReplicas))
-				return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
-			} else {
-				logger.V(2).Info("touch step deadline!", "from", stepDeadline.String(), "duration seconds", now.Sub(stepDeadline).Seconds())
-				if deployment.Status.UnavailableReplicas > int32(scaleAnnotation.MaxUnavailableReplicas) {
-					logger.V(2).Info("touch step deadline!",
-						fmt.Sprintf("the unavailable replicas %d is [more than] maxUnavailableReplicas %d ",
-							deployment.Status.UnavailableReplicas,
-							scaleAnnotation.MaxUnavailableReplicas))
-					newLastUpdateTime := time.Now()
-					logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-						scaleAnnotation.CurrentStepState, StepStateTimeout, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-					scaleAnnotation.CurrentStepState = StepStateTimeout
-					scaleAnnotation.LastUpdateTime = newLastUpdateTime
-				} else {
-					// when timeout, but the unavailable replicas is less than maxUnavailableReplicas, we think it is completed
-					logger.V(2).Info("touch step deadline!",
-						fmt.Sprintf("the unavailable replicas %d is [less than] maxUnavailableReplicas %d ",
-							deployment.Status.UnavailableReplicas,
-							scaleAnnotation.MaxUnavailableReplicas))
-					if deployment.Spec.Paused {
-						logger.V(2).Info("is paused, do not need set")
-						return reconcile.Result{}, nil
-					}
-					newLastUpdateTime := time.Now()
-					logger.V(2).Info(fmt.Sprintf("is paused and set spec.paused true,,change last update time: %s --> %s",
-						scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-					deployment.Spec.Paused = true
-					scaleAnnotation.LastUpdateTime = newLastUpdateTime
-				}
+			if handedOff {
+				scaleAnnotation.HandedOff = true
+				return reconcile.Result{}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
 			}
 		}
+		logger.V(2).Info("nothing to do", "reason", t.Reason, "message", scaleAnnotation.Message)
+		return reconcile.Result{}, nil
 
-		err = SetDeploymentScaleAnnotation(deployment, scaleAnnotation)
-		if err != nil {
-			logger.Error(err, "failed set scale annotation")
-			return reconcile.Result{}, err
+	case TransitionFixReplicas:
+		if replicasChangedExternally(scaleAnnotation) {
+			return r.handleExternalReplicas(ctx, logger, workload, scaleAnnotation, store)
 		}
+		r.fixWorkloadReplicas(ctx, logger, workload, scaleAnnotation, store)
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, nil
 
-		err = r.patchDeployment(ctx, logger, deployment)
+	case TransitionUnpause:
+		logger.V(2).Info("is paused and set spec.paused false", "state", scaleAnnotation.CurrentStepState)
+		workload.Paused = false
+		if err := r.patchWorkload(ctx, logger, workload); err != nil {
+			logger.Error(err, "failed to patch")
+			return reconcile.Result{RequeueAfter: r.requeue.base()}, err
+		}
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, nil
 
-		if err != nil {
+	case TransitionWaitRollout:
+		logger.V(5).Info("waiting for rollout", "reason", t.Reason)
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, errors.New(t.Reason)
+
+	case TransitionRestartHold:
+		logger.V(2).Info("step became unavailable while holding, restart hold")
+		scaleAnnotation.StepAvailableTime = time.Time{}
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+
+	case TransitionPauseWorkload:
+		logger.V(2).Info("scale stopped", "state", scaleAnnotation.CurrentStepState, "message", scaleAnnotation.Message)
+		workload.Paused = true
+		if err := r.patchWorkload(ctx, logger, workload); err != nil {
 			logger.Error(err, "failed to patch")
 			return reconcile.Result{}, err
 		}
+		return reconcile.Result{}, nil
+	}
 
-	case StepStateReady:
-		if *deployment.Spec.Replicas != scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Replicas {
-			r.fixDeploymentReplicas(ctx, logger, deployment, scaleAnnotation)
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
+	switch {
+	case t.Available:
+		if !r.endpointsReady(ctx, logger, workload, scaleAnnotation) {
+			return reconcile.Result{RequeueAfter: r.requeue.base()}, nil
 		}
-
-		// Spec.Paused in StepReady Status must be false
-		if deployment.Spec.Paused {
-			logger.V(2).Info("is paused and set spec.paused false")
-			deployment.Spec.Paused = false
-			err = r.patchDeployment(ctx, logger, deployment)
-			if err != nil {
-				logger.Error(err, "failed to patch")
-				return reconcile.Result{RequeueAfter: 5 * time.Second}, err
-			}
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
+		if stop, result, err := r.probeStep(ctx, logger, workload, scaleAnnotation, store); stop {
+			return result, err
 		}
-
-		// handle out of index
-		if scaleAnnotation.CurrentStepIndex == len(scaleAnnotation.Steps) {
-			newLastUpdateTime := time.Now()
-			logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-				scaleAnnotation.CurrentStepState, StepStateCompleted, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-			scaleAnnotation.CurrentStepState = StepStateCompleted
-			scaleAnnotation.LastUpdateTime = newLastUpdateTime
-			err = SetDeploymentScaleAnnotation(deployment, scaleAnnotation)
-			if err != nil {
-				logger.Error(err, "failed set scale annotation")
-				return reconcile.Result{}, err
+		if scaleAnnotation.CurrentStepState == StepStateUpgrade {
+			if stop, result, err := r.analyzeStep(ctx, logger, workload, scaleAnnotation, store); stop {
+				return result, err
 			}
-			err = r.patchDeployment(ctx, logger, deployment)
-			if err != nil {
-				logger.Error(err, "failed to patch")
-				return reconcile.Result{}, err
+			if hold, result, err := r.holdStep(ctx, logger, workload, scaleAnnotation, store); hold {
+				return result, err
 			}
-			return reconcile.Result{}, nil
+		}
+		if hold, result, err := r.runStepJob(ctx, logger, workload, scaleAnnotation, store); hold {
+			return result, err
 		}
 
-		nextStepIndex := scaleAnnotation.CurrentStepIndex + 1
-		nextStep := scaleAnnotation.Steps[nextStepIndex-1]
-
-		logger.V(2).Info("change:",
-			"replicas", fmt.Sprintf("%d --> %d", *deployment.Spec.Replicas, nextStep.Replicas),
-			"step index", fmt.Sprintf("%d --> %d", scaleAnnotation.CurrentStepIndex, nextStepIndex),
-			"step", fmt.Sprintf("%s --> %s", scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1], nextStep),
-		)
-
-		deployment.Spec.Replicas = &nextStep.Replicas
-		scaleAnnotation.CurrentStepIndex = nextStepIndex
+	case t.Kind == TransitionWaitAvailable, t.Kind == TransitionTimeout, t.Kind == TransitionFinishStep:
+		if failure := r.podFailure(ctx, logger, workload); failure != "" {
+			return reconcile.Result{}, r.failStep(ctx, logger, workload, scaleAnnotation, store, failure)
+		}
+		if t.Kind == TransitionWaitAvailable {
+			logger.V(2).Info("waiting for step to be available", "reason", t.Reason, "deadline", scaleAnnotation.StepDeadline())
+			return reconcile.Result{RequeueAfter: r.requeue.base()}, nil
+		}
+		logger.V(2).Info("touch step deadline!", "reason", t.Reason, "deadline", scaleAnnotation.StepDeadline())
 
-		newLastUpdateTime := time.Now()
-		if nextStep.Pause {
-			logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-				scaleAnnotation.CurrentStepState, StepStatePaused, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-			scaleAnnotation.CurrentStepState = StepStatePaused
-		} else {
-			logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s,change last update time: %s --> %s",
-				scaleAnnotation.CurrentStepState, StepStateUpgrade, scaleAnnotation.LastUpdateTime, newLastUpdateTime))
-			scaleAnnotation.CurrentStepState = StepStateUpgrade
+	case t.Kind == TransitionComplete, t.Kind == TransitionAdvance:
+		if hold, result, err := r.gateStep(ctx, logger, workload, scaleAnnotation, store); hold {
+			return result, err
 		}
-		scaleAnnotation.LastUpdateTime = newLastUpdateTime
+	}
 
-		err = SetDeploymentScaleAnnotation(deployment, scaleAnnotation)
+	if t.Kind == TransitionAdvance {
+		window, err := activeWindow(now, scaleAnnotation.BlackoutWindows, r.blackoutWindows)
 		if err != nil {
-			logger.Error(err, "failed set scale annotation")
+			logger.Error(err, "invalid blackout window")
 			return reconcile.Result{}, err
 		}
+		if window != nil {
+			logger.V(2).Info("in blackout window, do not advance", "window", window.String())
+			return reconcile.Result{RequeueAfter: time.Minute}, nil
+		}
+		if reason := r.frozen(ctx, logger); reason != "" {
+			logger.V(2).Info("plans are frozen, do not advance", "reason", reason)
+			if scaleAnnotation.Message != frozenMessage {
+				r.event(workload, corev1.EventTypeWarning, "PlanFrozen", "plans are frozen: "+reason)
+				scaleAnnotation.Message = frozenMessage
+				return reconcile.Result{RequeueAfter: 10 * time.Second}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+			}
+			return reconcile.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+		// persisted with the transition out of the step
+		if scaleAnnotation.Message == frozenMessage {
+			scaleAnnotation.Message = ""
+		}
 
-		err = r.patchDeployment(ctx, logger, deployment)
-		if err != nil {
-			logger.Error(err, "failed to patch")
-			return reconcile.Result{}, err
+		if !r.planBudget.acquire(client.ObjectKeyFromObject(workload.Object)) {
+			logger.V(2).Info("plan budget spent, do not advance", "budget", r.planBudget.String())
+			if scaleAnnotation.Message != queuedMessage {
+				scaleAnnotation.Message = queuedMessage
+				return reconcile.Result{RequeueAfter: 30 * time.Second}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+			}
+			return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+		// persisted with the transition out of the step
+		if scaleAnnotation.Message == queuedMessage {
+			scaleAnnotation.Message = ""
 		}
-		return reconcile.Result{}, nil
 
-	case StepStateCompleted:
-		if *deployment.Spec.Replicas != scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Replicas {
-			r.fixDeploymentReplicas(ctx, logger, deployment, scaleAnnotation)
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
+		if t.Replicas > workload.Replicas {
+			if paused, err := r.preflightStep(ctx, logger, workload, scaleAnnotation, store, t.StepIndex); paused || err != nil {
+				return reconcile.Result{}, err
+			}
+			if wait := r.rampLimiter.reserve(workload.Object.GetNamespace(), t.Replicas-workload.Replicas, now); wait > 0 {
+				logger.V(2).Info("ramp rate limit reached, delay step", "wait", wait.String())
+				if scaleAnnotation.Message != rampDelayedMessage {
+					scaleAnnotation.Message = rampDelayedMessage
+					return reconcile.Result{RequeueAfter: wait}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+				}
+				return reconcile.Result{RequeueAfter: wait}, nil
+			}
+			// persisted with the transition out of the step
+			if scaleAnnotation.Message == rampDelayedMessage {
+				scaleAnnotation.Message = ""
+			}
+		} else if t.Replicas < workload.Replicas {
+			if err := r.setPodDeletionCosts(ctx, logger, workload); err != nil {
+				logger.Error(err, "failed to set pod deletion costs")
+				return reconcile.Result{}, err
+			}
+			if hold, result, err := r.drainStep(ctx, logger, workload, scaleAnnotation, store, t.StepIndex); hold {
+				return result, err
+			}
 		}
+	}
 
-		logger.V(2).Info("scale success")
-		return reconcile.Result{}, nil
+	applyTransition(logger, workload, scaleAnnotation, t, r.now())
+	return reconcile.Result{}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+}
 
-	case StepStateTimeout:
-		if *deployment.Spec.Replicas != scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Replicas {
-			r.fixDeploymentReplicas(ctx, logger, deployment, scaleAnnotation)
-			return reconcile.Result{RequeueAfter: 5 * time.Second}, nil
-		}
-		logger.V(2).Info("scale timeout")
-		deployment.Spec.Paused = true
-		err = r.patchDeployment(ctx, logger, deployment)
-		if err != nil {
-			logger.Error(err, "failed to patch")
-			return reconcile.Result{}, err
-		}
-		return reconcile.Result{}, nil
+// applyTransition stages t on workload and scaleAnnotation.
+func applyTransition(logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, t Transition, now time.Time) {
+	logger.V(2).Info("change",
+		"transition", t.Kind,
+		"newState", t.State,
+		"newStep", t.StepIndex,
+		"replicas", workload.Replicas,
+		"newReplicas", t.Replicas,
+		"spec.paused", workload.Paused,
+		"newSpec.paused", t.Paused,
+		"lastUpdateTime", scaleAnnotation.LastUpdateTime,
+	)
+	if t.Kind != TransitionTimeout {
+		scaleAnnotation.finishStep(scaleAnnotation.CurrentStepIndex, now)
 	}
+	if t.StepIndex != scaleAnnotation.CurrentStepIndex {
+		scaleAnnotation.CurrentStepIndex = t.StepIndex
+		scaleAnnotation.startStep(t.StepIndex, now)
+	}
+	workload.Replicas = t.Replicas
+	workload.Paused = t.Paused
+	scaleAnnotation.CurrentStepState = t.State
+	scaleAnnotation.LastUpdateTime = now
+}
 
-	return reconcile.Result{}, nil
+// workloadLogger is the logger of the reconciles of workload.
+func (r *DeploymentReconciler) workloadLogger(workload *Workload) logr.Logger {
+	return r.log.WithValues("workload", workload.Object.GetName(), "namespace", workload.Object.GetNamespace())
 }
 
 func (r *DeploymentReconciler) InjectClient(c client.Client) error {
-	r.Client = c
+	r.Client = shadowed(c, r.shadow, r.log, r.cluster)
 	return nil
 }
 
-func (r *DeploymentReconciler) patchDeployment(ctx context.Context, logger logr.Logger, deployment *appsv1.Deployment) error {
-	logger.V(4).Info("patch now", "deployment", deployment)
-	latest := &appsv1.Deployment{}
-	err := r.Get(ctx, client.ObjectKeyFromObject(deployment), latest)
-	if err != nil {
-		return err
+func (r *DeploymentReconciler) workloadClient() workloadClient {
+	if r.workloads == nil {
+		r.workloads = r.shadowedWorkloads(&deploymentClient{client: r.Client})
 	}
-	patch := client.MergeFrom(latest.DeepCopy())
+	return r.workloads
+}
 
-	latest.SetAnnotations(deployment.Annotations)
-	latest.Spec.Replicas = deployment.Spec.Replicas
-	latest.Spec.Paused = deployment.Spec.Paused
+// patchWorkload writes workload with its client. The server-side applies of
+// the workload clients are forced and cannot conflict; the scale client
+// retries the conflicts of its scale updates itself.
+func (r *DeploymentReconciler) patchWorkload(ctx context.Context, logger logr.Logger, workload *Workload) (err error) {
+	logger.V(4).Info("patch now", "workload", workload.Object)
+	ctx, span := r.tracer().Start(ctx, "Patch", trace.WithAttributes(
+		attribute.Int("annotationscale.replicas", int(workload.Replicas)),
+		attribute.Bool("annotationscale.paused", workload.Paused),
+	))
+	defer func() { endSpan(span, err) }()
+	return workload.client.Patch(ctx, workload)
+}
+
+// holdStep keeps an available step in StepUpgrade until it has been stable
+// for Step.HoldSeconds. It returns true while the step is held.
+func (r *DeploymentReconciler) holdStep(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (bool, reconcile.Result, error) {
+	holdSeconds := scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].HoldSeconds
+	if holdSeconds <= 0 {
+		return false, reconcile.Result{}, nil
+	}
+	now := r.now()
+	if scaleAnnotation.StepAvailableTime.IsZero() {
+		logger.V(2).Info("step available, start hold", "hold seconds", holdSeconds)
+		scaleAnnotation.StepAvailableTime = now
+		return true, reconcile.Result{RequeueAfter: r.requeue.base()}, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+	}
+	holdUntil := scaleAnnotation.StepAvailableTime.Add(time.Duration(holdSeconds) * time.Second)
+	if now.Before(holdUntil) {
+		logger.V(5).Info("holding step", "until", holdUntil.String())
+		requeueAfter := holdUntil.Sub(now)
+		if requeueAfter > r.requeue.base() {
+			requeueAfter = r.requeue.base()
+		}
+		return true, reconcile.Result{RequeueAfter: requeueAfter}, nil
+	}
+	logger.V(2).Info("hold finished", "available since", scaleAnnotation.StepAvailableTime.String())
+	scaleAnnotation.StepAvailableTime = time.Time{}
+	return false, reconcile.Result{}, nil
+}
 
-	return r.Client.Patch(ctx, latest, patch, &client.PatchOptions{})
+// savePlan stages scaleAnnotation in store and patches the workload.
+func (r *DeploymentReconciler) savePlan(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) error {
+	if err := store.Write(ctx, workload, scaleAnnotation); err != nil {
+		logger.Error(err, "failed set scale annotation")
+		return err
+	}
+	if err := r.patchWorkload(ctx, logger, workload); err != nil {
+		logger.Error(err, "failed to patch")
+		return err
+	}
+	return nil
 }
 
-func (r *DeploymentReconciler) fixDeploymentReplicas(ctx context.Context, logger logr.Logger, deployment *appsv1.Deployment, scaleAnnotation *ScaleAnnotation) error {
-	logger.V(2).Info(fmt.Sprintf("replicas fix in state: %s , %d --> %d", scaleAnnotation.CurrentStepState, &deployment.Spec.Replicas, scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Replicas))
+func (r *DeploymentReconciler) fixWorkloadReplicas(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) error {
+	logger.V(2).Info("replicas fix", "replicas", workload.Replicas, "newReplicas", scaleAnnotation.StepReplicas(scaleAnnotation.CurrentStepIndex))
 
-	*deployment.Spec.Replicas = scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Replicas
+	workload.Replicas = scaleAnnotation.StepReplicas(scaleAnnotation.CurrentStepIndex)
 
 	if scaleAnnotation.Steps[scaleAnnotation.CurrentStepIndex-1].Pause {
-		logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s", scaleAnnotation.CurrentStepState, StepStatePaused))
+		logger.V(2).Info("change step state", "newState", StepStatePaused)
 		scaleAnnotation.CurrentStepState = StepStatePaused
 	} else {
-		logger.V(2).Info(fmt.Sprintf("change step state: %s --> %s", scaleAnnotation.CurrentStepState, StepStateUpgrade))
+		logger.V(2).Info("change step state", "newState", StepStateUpgrade)
 		scaleAnnotation.CurrentStepState = StepStateUpgrade
 	}
 
-	scaleAnnotation.LastUpdateTime = time.Now()
-	err := SetDeploymentScaleAnnotation(deployment, scaleAnnotation)
+	scaleAnnotation.LastUpdateTime = r.now()
+	scaleAnnotation.StepAvailableTime = time.Time{}
+	scaleAnnotation.startStep(scaleAnnotation.CurrentStepIndex, scaleAnnotation.LastUpdateTime)
+	err := store.Write(ctx, workload, scaleAnnotation)
 	if err != nil {
 		logger.Error(err, "failed set scale annotation")
 		return err
 	}
-	err = r.patchDeployment(ctx, logger, deployment)
+	err = r.patchWorkload(ctx, logger, workload)
 	if err != nil {
 		logger.V(1).Error(err, "patch failed")
 		return err
@@ -0,0 +1,173 @@
+package annotationscale
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var testKey = types.NamespacedName{Namespace: "default", Name: "web"}
+
+// newTestReconciler returns a DeploymentReconciler on clock with a fake
+// client holding a Deployment of replicas running plan.
+func newTestReconciler(t *testing.T, clock Clock, replicas int32, plan *ScaleAnnotation) *DeploymentReconciler {
+	t.Helper()
+	annotations, err := SetScaleAnnotation(map[string]string{}, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testKey.Namespace, Name: testKey.Name, Annotations: annotations},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{Replicas: replicas, AvailableReplicas: replicas, ReadyReplicas: replicas, UpdatedReplicas: replicas},
+	}
+	log := logr.Discard()
+	return &DeploymentReconciler{
+		Client:    applyClient{fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(deployment).Build()},
+		log:       &log,
+		clock:     clock,
+		planCache: newPlanCache(),
+	}
+}
+
+// applyClient removes the plan annotations a server-side apply leaves out,
+// like the API server does for the fields of the field manager. The fake
+// client merges applies instead.
+type applyClient struct {
+	client.Client
+}
+
+func (c applyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch != client.Apply {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	current := &appsv1.Deployment{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return err
+	}
+	for key := range current.Annotations {
+		if _, ok := obj.GetAnnotations()[key]; !ok && isPlanAnnotation(key) {
+			delete(current.Annotations, key)
+		}
+	}
+	if err := c.Update(ctx, current); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+// setAvailable reports available of replicas pods of the Deployment.
+func setAvailable(t *testing.T, r *DeploymentReconciler, replicas, available int32) {
+	t.Helper()
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(context.Background(), testKey, deployment); err != nil {
+		t.Fatal(err)
+	}
+	deployment.Status = appsv1.DeploymentStatus{
+		Replicas:            replicas,
+		AvailableReplicas:   available,
+		ReadyReplicas:       available,
+		UpdatedReplicas:     replicas,
+		UnavailableReplicas: replicas - available,
+	}
+	if err := r.Status().Update(context.Background(), deployment); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reconcilePlan reconciles the Deployment and returns its plan and replicas.
+func reconcilePlan(t *testing.T, r *DeploymentReconciler) (*ScaleAnnotation, int32) {
+	t.Helper()
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: testKey}); err != nil {
+		t.Fatal(err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(context.Background(), testKey, deployment); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := ReadScaleAnnotation(deployment.Annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan, *deployment.Spec.Replicas
+}
+
+func expectStep(t *testing.T, plan *ScaleAnnotation, replicas int32, index int, state StepState, wantReplicas int32) {
+	t.Helper()
+	if plan.CurrentStepIndex != index || plan.CurrentStepState != state || replicas != wantReplicas {
+		t.Fatalf("step %d %s with %d replicas, want step %d %s with %d replicas (%s)",
+			plan.CurrentStepIndex, plan.CurrentStepState, replicas, index, state, wantReplicas, plan.Message)
+	}
+}
+
+func TestReconcileStepDeadline(t *testing.T) {
+	clock := NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	r := newTestReconciler(t, clock, 2, &ScaleAnnotation{
+		Steps:                  []Step{{Replicas: 2}, {Replicas: 4}, {Replicas: 6}},
+		CurrentStepIndex:       1,
+		CurrentStepState:       StepStateReady,
+		MaxWaitAvailableSecond: 60,
+		LastUpdateTime:         clock.Now(),
+	})
+
+	plan, replicas := reconcilePlan(t, r)
+	expectStep(t, plan, replicas, 2, StepStateUpgrade, 4)
+	if !plan.LastUpdateTime.Equal(clock.Now()) {
+		t.Fatalf("step started at %s, want the clock %s", plan.LastUpdateTime, clock.Now())
+	}
+
+	setAvailable(t, r, 4, 3)
+	clock.Step(59 * time.Second)
+	plan, replicas = reconcilePlan(t, r)
+	expectStep(t, plan, replicas, 2, StepStateUpgrade, 4)
+
+	clock.Step(2 * time.Second)
+	plan, replicas = reconcilePlan(t, r)
+	expectStep(t, plan, replicas, 2, StepStateTimeout, 4)
+}
+
+func TestReconcileHoldSeconds(t *testing.T) {
+	clock := NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	r := newTestReconciler(t, clock, 4, &ScaleAnnotation{
+		Steps:                  []Step{{Replicas: 2}, {Replicas: 4, HoldSeconds: 30}},
+		CurrentStepIndex:       2,
+		CurrentStepState:       StepStateUpgrade,
+		MaxWaitAvailableSecond: 600,
+		LastUpdateTime:         clock.Now(),
+	})
+
+	plan, replicas := reconcilePlan(t, r)
+	expectStep(t, plan, replicas, 2, StepStateUpgrade, 4)
+	if !plan.StepAvailableTime.Equal(clock.Now()) {
+		t.Fatalf("hold started at %s, want the clock %s", plan.StepAvailableTime, clock.Now())
+	}
+
+	clock.Step(29 * time.Second)
+	plan, replicas = reconcilePlan(t, r)
+	expectStep(t, plan, replicas, 2, StepStateUpgrade, 4)
+
+	// the hold restarts once the step becomes unavailable
+	setAvailable(t, r, 4, 3)
+	plan, replicas = reconcilePlan(t, r)
+	expectStep(t, plan, replicas, 2, StepStateUpgrade, 4)
+	setAvailable(t, r, 4, 4)
+	clock.Step(2 * time.Second)
+	plan, replicas = reconcilePlan(t, r)
+	expectStep(t, plan, replicas, 2, StepStateUpgrade, 4)
+	if !plan.StepAvailableTime.Equal(clock.Now()) {
+		t.Fatalf("hold restarted at %s, want the clock %s", plan.StepAvailableTime, clock.Now())
+	}
+
+	clock.Step(31 * time.Second)
+	plan, replicas = reconcilePlan(t, r)
+	expectStep(t, plan, replicas, 2, StepStateCompleted, 4)
+}
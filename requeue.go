@@ -0,0 +1,118 @@
+package annotationscale
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const defaultRequeueInterval = 5 * time.Second
+
+// RequeueBackoff configures how often the workloads, ScaleGroups and
+// ScalePlans waiting on a step are reconciled again.
+type RequeueBackoff struct {
+	// Interval is the requeue of a workload making progress, 5s by default.
+	Interval time.Duration
+	// MaxInterval caps the interval, doubled on every requeue of a workload
+	// that did not change since the last one. Zero disables the backoff.
+	MaxInterval time.Duration
+}
+
+// requeueBackoff tracks the requeues of the objects not making progress.
+// A nil requeueBackoff requeues after defaultRequeueInterval.
+type requeueBackoff struct {
+	interval time.Duration
+	max      time.Duration
+
+	mu      sync.Mutex
+	entries map[types.NamespacedName]backoffEntry
+}
+
+type backoffEntry struct {
+	// resourceVersion of the object at the last requeue, it changes with
+	// any status or plan progress.
+	resourceVersion string
+	delay           time.Duration
+}
+
+func newRequeueBackoff(opts *RequeueBackoff) *requeueBackoff {
+	if opts == nil {
+		return nil
+	}
+	b := &requeueBackoff{interval: opts.Interval, max: opts.MaxInterval, entries: map[types.NamespacedName]backoffEntry{}}
+	if b.interval <= 0 {
+		b.interval = defaultRequeueInterval
+	}
+	return b
+}
+
+func (b *requeueBackoff) base() time.Duration {
+	if b == nil {
+		return defaultRequeueInterval
+	}
+	return b.interval
+}
+
+// backoff stretches a requeue after the base interval when obj did not
+// change since the last one, up to the next deadline of scaleAnnotation when
+// there is one.
+func (b *requeueBackoff) backoff(obj client.Object, scaleAnnotation *ScaleAnnotation, result reconcile.Result, now time.Time) reconcile.Result {
+	if b == nil || b.max <= b.interval {
+		return result
+	}
+	key := client.ObjectKeyFromObject(obj)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if result.RequeueAfter != b.interval {
+		delete(b.entries, key)
+		return result
+	}
+	resourceVersion := obj.GetResourceVersion()
+	entry, ok := b.entries[key]
+	if !ok || entry.resourceVersion != resourceVersion {
+		entry = backoffEntry{resourceVersion: resourceVersion, delay: b.interval}
+	} else if entry.delay *= 2; entry.delay > b.max {
+		entry.delay = b.max
+	}
+	b.entries[key] = entry
+	delay := entry.delay
+	if scaleAnnotation != nil {
+		if next := nextPlanDeadline(scaleAnnotation, now); !next.IsZero() && next.Sub(now) < delay {
+			delay = next.Sub(now)
+		}
+	}
+	if delay < b.interval {
+		delay = b.interval
+	}
+	result.RequeueAfter = delay
+	return result
+}
+
+func (b *requeueBackoff) forget(key types.NamespacedName) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+}
+
+// nextPlanDeadline is the earliest time after now the plan acts on its own:
+// the step deadline or the end of a hold. It is zero when there is none.
+func nextPlanDeadline(scaleAnnotation *ScaleAnnotation, now time.Time) time.Time {
+	var next time.Time
+	deadlines := []time.Time{scaleAnnotation.StepDeadline()}
+	if index := scaleAnnotation.CurrentStepIndex; !scaleAnnotation.StepAvailableTime.IsZero() && index >= 1 && index <= len(scaleAnnotation.Steps) {
+		hold := time.Duration(scaleAnnotation.Steps[index-1].HoldSeconds) * time.Second
+		deadlines = append(deadlines, scaleAnnotation.StepAvailableTime.Add(hold))
+	}
+	for _, deadline := range deadlines {
+		if deadline.After(now) && (next.IsZero() || deadline.Before(next)) {
+			next = deadline
+		}
+	}
+	return next
+}
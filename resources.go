@@ -0,0 +1,122 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResourceGate holds a ready step while the average utilization of the
+// workload's pods, usage from metrics.k8s.io over requests, exceeds a limit.
+// Zero percentages are not checked.
+type ResourceGate struct {
+	CPUUtilizationPercent    int
+	MemoryUtilizationPercent int
+}
+
+var podMetricsListGVK = schema.GroupVersionKind{Group: "metrics.k8s.io", Version: "v1beta1", Kind: "PodMetricsList"}
+
+func (r *DeploymentReconciler) resourceGate(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation) string {
+	gate := r.resourceGateOptions
+	if gate == nil || workload.Selector == nil {
+		return ""
+	}
+	pods, err := r.listPods(ctx, workload)
+	if err != nil {
+		logger.Error(err, "failed to list pods")
+		return ""
+	}
+	requests := make(map[string]corev1.ResourceList, len(pods))
+	for _, pod := range pods {
+		podRequests := corev1.ResourceList{}
+		for _, container := range pod.Spec.Containers {
+			for name, quantity := range container.Resources.Requests {
+				total := podRequests[name]
+				total.Add(quantity)
+				podRequests[name] = total
+			}
+		}
+		requests[pod.Name] = podRequests
+	}
+
+	podMetrics := &unstructured.UnstructuredList{}
+	podMetrics.SetGroupVersionKind(podMetricsListGVK)
+	err = r.List(ctx, podMetrics, client.InNamespace(workload.Object.GetNamespace()),
+		client.MatchingLabelsSelector{Selector: workload.Selector})
+	if err != nil {
+		// without metrics-server the gate cannot hold anything
+		logger.V(2).Info("failed to list pod metrics", "error", err.Error())
+		return ""
+	}
+	usage := make(map[string]corev1.ResourceList, len(podMetrics.Items))
+	for _, item := range podMetrics.Items {
+		containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+		podUsage := corev1.ResourceList{}
+		for _, container := range containers {
+			fields, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			containerUsage, _, _ := unstructured.NestedStringMap(fields, "usage")
+			for name, value := range containerUsage {
+				quantity, err := resource.ParseQuantity(value)
+				if err != nil {
+					continue
+				}
+				total := podUsage[corev1.ResourceName(name)]
+				total.Add(quantity)
+				podUsage[corev1.ResourceName(name)] = total
+			}
+		}
+		usage[item.GetName()] = podUsage
+	}
+
+	for _, check := range []struct {
+		name    corev1.ResourceName
+		percent int
+	}{
+		{corev1.ResourceCPU, gate.CPUUtilizationPercent},
+		{corev1.ResourceMemory, gate.MemoryUtilizationPercent},
+	} {
+		if check.percent <= 0 {
+			continue
+		}
+		utilization, ok := averageUtilization(check.name, requests, usage)
+		if !ok {
+			continue
+		}
+		logger.V(5).Info("pod utilization", "resource", check.name, "percent", utilization)
+		if utilization > int64(check.percent) {
+			return fmt.Sprintf("%s utilization %d%% exceeds %d%%", check.name, utilization, check.percent)
+		}
+	}
+	return ""
+}
+
+// averageUtilization is the usage over the requests of the pods that have
+// both, in percent.
+func averageUtilization(name corev1.ResourceName, requests, usage map[string]corev1.ResourceList) (int64, bool) {
+	var totalRequests, totalUsage int64
+	for pod, podUsage := range usage {
+		request, ok := requests[pod][name]
+		if !ok || request.IsZero() {
+			continue
+		}
+		used, ok := podUsage[name]
+		if !ok {
+			continue
+		}
+		totalRequests += request.MilliValue()
+		totalUsage += used.MilliValue()
+	}
+	if totalRequests == 0 {
+		return 0, false
+	}
+	return totalUsage * 100 / totalRequests, true
+}
@@ -0,0 +1,67 @@
+package annotationscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var ErrorPlanNotCompleted error = errors.New("plan is not completed")
+
+// GenerateReversePlan returns a plan taking the steps of plan in reverse
+// order, e.g. the scale down back from a scale up plan. Pause points and the
+// other step settings stay on the same replicas, Direction is flipped and the
+// completion policy dropped.
+func GenerateReversePlan(plan *ScaleAnnotation) (*ScaleAnnotation, error) {
+	if len(plan.Steps) == 0 {
+		return nil, ErrorScaleAnnotationParseSteps
+	}
+	reverse := *plan
+	reverse.Steps = make([]Step, len(plan.Steps))
+	for i, step := range plan.Steps {
+		step.resetProgress()
+		reverse.Steps[len(plan.Steps)-1-i] = step
+	}
+	switch plan.Direction {
+	case DirectionUp:
+		reverse.Direction = DirectionDown
+	case DirectionDown:
+		reverse.Direction = DirectionUp
+	}
+	reverse.Completion = nil
+	reverse.HandedOff = false
+	reverse.ID = ""
+	reverse.OriginalReplicas = nil
+	reverse.Transitions = nil
+	reverse.CurrentStepIndex = 1
+	reverse.CurrentStepState = StepStateReady
+	reverse.Message = ""
+	reverse.LastUpdateTime = time.Now()
+	reverse.StepAvailableTime = time.Time{}
+	return &reverse, nil
+}
+
+// ApplyReverse starts the GenerateReversePlan of the completed plan of the
+// Deployment key.
+func ApplyReverse(ctx context.Context, c client.Client, key types.NamespacedName) error {
+	workload, err := (&deploymentClient{client: c}).Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	scaleAnnotation, err := storeFor(workload).Read(ctx, workload)
+	if err != nil {
+		return err
+	}
+	if scaleAnnotation.CurrentStepState != StepStateCompleted {
+		return fmt.Errorf("%w: %s", ErrorPlanNotCompleted, scaleAnnotation.CurrentStepState)
+	}
+	reverse, err := GenerateReversePlan(scaleAnnotation)
+	if err != nil {
+		return err
+	}
+	return ApplyPlan(ctx, c, key, reverse)
+}
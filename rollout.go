@@ -0,0 +1,44 @@
+package annotationscale
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// rolloutHoldMessage marks plans held by holdForRollout.
+const rolloutHoldMessage = "held while a new rollout is in progress"
+
+// holdForRollout holds a running plan while its workload rolls out a new pod
+// template. Once the rollout completed the plan resumes with the deadline of
+// its current step restarted. It returns true while the plan is held.
+func (r *DeploymentReconciler) holdForRollout(ctx context.Context, logger logr.Logger, workload *Workload, scaleAnnotation *ScaleAnnotation, store StateStore) (bool, error) {
+	switch scaleAnnotation.CurrentStepState {
+	case StepStateUpgrade, StepStatePaused, StepStateReady:
+	default:
+		return false, nil
+	}
+	held := scaleAnnotation.Message == rolloutHoldMessage
+	switch {
+	case workload.Status.RolloutInProgress && !held:
+		logger.Info("hold plan, a new rollout started", "updated-replicas", workload.Status.UpdatedReplicas, "replicas", workload.Status.Replicas)
+		r.event(workload, corev1.EventTypeNormal, "PlanHeld", rolloutHoldMessage)
+		scaleAnnotation.Message = rolloutHoldMessage
+		return true, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+
+	case workload.Status.RolloutInProgress:
+		logger.V(2).Info(rolloutHoldMessage, "updated-replicas", workload.Status.UpdatedReplicas, "replicas", workload.Status.Replicas)
+		return true, nil
+
+	case held:
+		logger.Info("resume plan, the rollout completed")
+		r.event(workload, corev1.EventTypeNormal, "PlanResumed", "the rollout completed")
+		scaleAnnotation.Message = ""
+		scaleAnnotation.LastUpdateTime = r.now()
+		scaleAnnotation.StepAvailableTime = time.Time{}
+		return true, r.savePlan(ctx, logger, workload, scaleAnnotation, store)
+	}
+	return false, nil
+}
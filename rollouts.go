@@ -0,0 +1,83 @@
+package annotationscale
+
+import (
+	"context"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RolloutGVK is the Argo Rollouts Rollout driven with WithArgoRollouts.
+var RolloutGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+
+// rolloutClient drives Argo Rollouts. Replicas and paused are applied on the
+// Rollout itself, Argo Rollouts spreads them over its stable and canary
+// ReplicaSets.
+type rolloutClient struct {
+	client client.Client
+}
+
+func (c *rolloutClient) Get(ctx context.Context, key types.NamespacedName) (*Workload, error) {
+	obj := newUnstructured(RolloutGVK)
+	if err := c.client.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	workload := newRolloutWorkload(obj)
+	workload.client = c
+	return workload, nil
+}
+
+func newRolloutWorkload(obj *unstructured.Unstructured) *Workload {
+	var replicas int32 = 1
+	if specReplicas, ok := nestedInt32(obj, "spec", "replicas"); ok {
+		replicas = specReplicas
+	}
+	paused, _, _ := unstructured.NestedBool(obj.Object, "spec", "paused")
+	status := WorkloadStatus{}
+	status.Replicas, _ = nestedInt32(obj, "status", "replicas")
+	status.AvailableReplicas, _ = nestedInt32(obj, "status", "availableReplicas")
+	status.ReadyReplicas, _ = nestedInt32(obj, "status", "readyReplicas")
+	status.UpdatedReplicas, _ = nestedInt32(obj, "status", "updatedReplicas")
+	if status.Replicas > status.AvailableReplicas {
+		status.UnavailableReplicas = status.Replicas - status.AvailableReplicas
+	}
+	// the pods of the current template are not the stable ones until the
+	// canary or blue-green update finished; observedGeneration is a string
+	observedGeneration, _, _ := unstructured.NestedString(obj.Object, "status", "observedGeneration")
+	currentPodHash, _, _ := unstructured.NestedString(obj.Object, "status", "currentPodHash")
+	stableRS, _, _ := unstructured.NestedString(obj.Object, "status", "stableRS")
+	observed := observedGeneration == strconv.FormatInt(obj.GetGeneration(), 10)
+	status.RolloutInProgress = observed && stableRS != "" && currentPodHash != stableRS
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, _ := c.(map[string]interface{})
+		if condition["type"] == "Progressing" {
+			status.ProgressDeadlineExceeded = observed && condition["status"] == "False" && condition["reason"] == progressDeadlineExceededReason
+		}
+	}
+
+	return &Workload{
+		Object:        obj,
+		Selector:      nestedSelector(obj, "spec", "selector"),
+		Replicas:      replicas,
+		Paused:        paused,
+		SupportsPause: true,
+		Status:        status,
+	}
+}
+
+// Patch applies replicas, paused and the plan annotations with server-side
+// apply, like for Deployments.
+func (c *rolloutClient) Patch(ctx context.Context, workload *Workload) error {
+	apply := applyObject(RolloutGVK, workload)
+	if err := unstructured.SetNestedField(apply.Object, int64(workload.Replicas), "spec", "replicas"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(apply.Object, workload.Paused, "spec", "paused"); err != nil {
+		return err
+	}
+	return c.client.Patch(ctx, apply, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
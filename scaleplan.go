@@ -0,0 +1,372 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/arcosx/annotationscale/api/v1alpha1"
+)
+
+const ScalePlanConditionCompleted = "Completed"
+
+// ScalePlanReconciler drives the target of a ScalePlan with the same state
+// machine as annotation mode, keeping the plan state in the ScalePlan status.
+type ScalePlanReconciler struct {
+	client.Client
+	log        *logr.Logger
+	reconciler *DeploymentReconciler
+	// requeue backs off plans waiting on their targets, apart from the
+	// workloads of the same names.
+	requeue *requeueBackoff
+
+	newScaleClient func(gvk schema.GroupVersionKind) (*scaleClient, error)
+	scaleClients   map[schema.GroupVersionKind]*scaleClient
+	mutex          sync.Mutex
+	// controller watches the kinds of the targets as plans refer to them.
+	controller controller.Controller
+}
+
+func (r *ScalePlanReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	r.log.V(2).Info("Reconcile", "scaleplan", req)
+	if allowed, err := r.reconciler.namespaces.allows(ctx, r.Client, req.Namespace); !allowed {
+		r.log.V(5).Info("namespace not managed", "namespace", req.Namespace)
+		return reconcile.Result{}, err
+	}
+	plan := &v1alpha1.ScalePlan{}
+	err := r.Get(ctx, req.NamespacedName, plan)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			r.log.Info("scaleplan resource not found. Ignoring since object must be deleted")
+			r.requeue.forget(req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		r.log.Error(err, "failed to get scaleplan", "scaleplan", req.Name, "namespace", req.Namespace)
+		return reconcile.Result{}, err
+	}
+	logger := r.log.WithValues("scaleplan", plan.Name, "namespace", plan.Namespace)
+	before := plan.Status.DeepCopy()
+
+	if plan.Status.ObservedGeneration != plan.Generation {
+		logger.V(2).Info("spec changed, restart plan", "generation", plan.Generation)
+		restartScalePlan(plan)
+	}
+
+	workloads, err := r.workloadClientFor(plan.Spec.TargetRef)
+	if err != nil {
+		logger.Error(err, "unsupported targetRef", "targetRef", plan.Spec.TargetRef)
+		return reconcile.Result{}, err
+	}
+	workload, err := workloads.Get(ctx, types.NamespacedName{Namespace: plan.Namespace, Name: plan.Spec.TargetRef.Name})
+	if err != nil {
+		logger.Error(err, "failed to get target", "targetRef", plan.Spec.TargetRef)
+		return reconcile.Result{RequeueAfter: r.requeue.base()}, client.IgnoreNotFound(err)
+	}
+
+	if plan.Status.PlanID == "" {
+		plan.Status.PlanID = string(uuid.NewUUID())
+	}
+	logger = logger.WithValues("plan", plan.Status.PlanID)
+	workload.planID = plan.Status.PlanID
+
+	store := &scalePlanStore{plan: plan}
+	scaleAnnotation, err := store.Read(ctx, workload)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	result, err := r.reconciler.reconcilePlan(ctx, logger, workload, scaleAnnotation, store)
+	if err == nil {
+		result = r.requeue.backoff(plan, scaleAnnotation, result, r.reconciler.now())
+		if err = r.reconciler.syncScaledObjects(ctx, logger, workload, scaleAnnotation); err != nil {
+			logger.Error(err, "failed to sync scaledobjects")
+		}
+	}
+
+	// a failed workload patch leaves the status at the previous transition
+	if err == nil && !equality.Semantic.DeepEqual(before, &plan.Status) {
+		if updateErr := r.Status().Update(ctx, plan); updateErr != nil {
+			logger.Error(updateErr, "failed to update scaleplan status")
+			return reconcile.Result{}, updateErr
+		}
+	}
+	return result, err
+}
+
+func (r *ScalePlanReconciler) InjectClient(c client.Client) error {
+	r.Client = shadowed(c, r.reconciler.shadow, r.log, r.reconciler.cluster)
+	return nil
+}
+
+// targetGVK is the kind ref refers to, Deployments by default.
+func targetGVK(ref v1alpha1.TargetReference) (schema.GroupVersionKind, error) {
+	gvk := deploymentGVK
+	if ref.APIVersion != "" {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return schema.GroupVersionKind{}, err
+		}
+		gvk = gv.WithKind(gvk.Kind)
+	}
+	if ref.Kind != "" {
+		gvk.Kind = ref.Kind
+	}
+	return gvk, nil
+}
+
+var deploymentGVK = appsv1.SchemeGroupVersion.WithKind("Deployment")
+
+func (r *ScalePlanReconciler) workloadClientFor(ref v1alpha1.TargetReference) (workloadClient, error) {
+	gvk, err := targetGVK(ref)
+	if err != nil {
+		return nil, err
+	}
+	if gvk == deploymentGVK {
+		return &deploymentClient{client: r.Client}, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if c, ok := r.scaleClients[gvk]; ok {
+		return r.reconciler.shadowedWorkloads(c), nil
+	}
+	if r.newScaleClient == nil {
+		return nil, fmt.Errorf("target kind %s is not supported", gvk)
+	}
+	c, err := r.newScaleClient(gvk)
+	if err != nil {
+		return nil, err
+	}
+	c.cluster = r.reconciler.cluster
+	if r.controller != nil {
+		err := r.controller.Watch(&source.Kind{Type: newUnstructured(gvk)}, handler.EnqueueRequestsFromMapFunc(r.plansFor(gvk)),
+			r.reconciler.namespaces.predicate())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.scaleClients == nil {
+		r.scaleClients = make(map[schema.GroupVersionKind]*scaleClient)
+	}
+	r.scaleClients[gvk] = c
+	return r.reconciler.shadowedWorkloads(c), nil
+}
+
+// plansFor maps an event of an object of kind gvk to the ScalePlans
+// targeting it, whatever version of the kind they refer to.
+func (r *ScalePlanReconciler) plansFor(gvk schema.GroupVersionKind) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		plans := &v1alpha1.ScalePlanList{}
+		if err := r.List(context.Background(), plans, client.InNamespace(obj.GetNamespace())); err != nil {
+			r.log.Error(err, "failed to list scaleplans")
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, plan := range plans.Items {
+			if plan.Spec.TargetRef.Name != obj.GetName() {
+				continue
+			}
+			if target, err := targetGVK(plan.Spec.TargetRef); err != nil || target.GroupKind() != gvk.GroupKind() {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&plan)})
+		}
+		return requests
+	}
+}
+
+// restartScalePlan resets the status of plan to its first step.
+func restartScalePlan(plan *v1alpha1.ScalePlan) {
+	plan.Status.ObservedGeneration = plan.Generation
+	plan.Status.CurrentStepIndex = 1
+	plan.Status.CurrentStepState = string(StepStateReady)
+	plan.Status.Message = ""
+	plan.Status.LastUpdateTime = metav1.Now()
+	plan.Status.Steps = nil
+	plan.Status.HandedOff = false
+	plan.Status.Transitions = nil
+	plan.Status.PlanID = ""
+}
+
+type scalePlanStore struct {
+	plan *v1alpha1.ScalePlan
+}
+
+func (s *scalePlanStore) Read(ctx context.Context, workload *Workload) (*ScaleAnnotation, error) {
+	scaleAnnotation := NewScaleAnnotation()
+	for i, step := range s.plan.Spec.Steps {
+		scaleAnnotation.Steps = append(scaleAnnotation.Steps, Step{
+			Replicas:               step.Replicas,
+			Pause:                  step.Pause,
+			MaxWaitAvailableSecond: step.MaxWaitAvailableSeconds,
+			Percent:                step.Percent,
+			HoldSeconds:            step.HoldSeconds,
+		})
+		if webhook := step.Webhook; webhook != nil {
+			scaleAnnotation.Steps[i].Webhook = &StepWebhook{
+				URL:            webhook.URL,
+				Method:         webhook.Method,
+				TimeoutSeconds: webhook.TimeoutSeconds,
+				ExpectedStatus: webhook.ExpectedStatus,
+			}
+		}
+		if step.Job != nil {
+			scaleAnnotation.Steps[i].Job = &StepJob{Template: *step.Job.Template.DeepCopy()}
+		}
+		if analysis := step.Analysis; analysis != nil {
+			threshold, err := strconv.ParseFloat(analysis.Threshold, 64)
+			if err != nil {
+				return nil, fmt.Errorf("step %d analysis threshold: %w", i+1, err)
+			}
+			scaleAnnotation.Steps[i].Analysis = &StepAnalysis{
+				Query:           analysis.Query,
+				Threshold:       threshold,
+				Operator:        analysis.Operator,
+				IntervalSeconds: analysis.IntervalSeconds,
+				FailureLimit:    analysis.FailureLimit,
+				Rollback:        analysis.Rollback,
+			}
+		}
+		if probe := step.Probe; probe != nil {
+			scaleAnnotation.Steps[i].Probe = &StepProbe{
+				Path:             probe.Path,
+				Port:             probe.Port,
+				Scheme:           probe.Scheme,
+				Service:          probe.Service,
+				ExpectedStatus:   probe.ExpectedStatus,
+				SuccessThreshold: probe.SuccessThreshold,
+				PeriodSeconds:    probe.PeriodSeconds,
+				TimeoutSeconds:   probe.TimeoutSeconds,
+			}
+		}
+		if drain := step.Drain; drain != nil {
+			scaleAnnotation.Steps[i].Drain = &StepDrain{
+				Path:           drain.Path,
+				Port:           drain.Port,
+				TimeoutSeconds: drain.TimeoutSeconds,
+			}
+		}
+		if i < len(s.plan.Status.Steps) {
+			stepStatus := s.plan.Status.Steps[i]
+			scaleAnnotation.Steps[i].StartedAt = timeOrNil(stepStatus.StartedAt)
+			scaleAnnotation.Steps[i].FinishedAt = timeOrNil(stepStatus.FinishedAt)
+			scaleAnnotation.Steps[i].AnalyzedAt = timeOrNil(stepStatus.AnalyzedAt)
+			scaleAnnotation.Steps[i].AnalysisFailures = stepStatus.AnalysisFailures
+			scaleAnnotation.Steps[i].ProbeSuccesses = stepStatus.ProbeSuccesses
+			scaleAnnotation.Steps[i].DrainStartedAt = timeOrNil(stepStatus.DrainStartedAt)
+		}
+	}
+	scaleAnnotation.CurrentStepIndex = s.plan.Status.CurrentStepIndex
+	scaleAnnotation.CurrentStepState = StepState(s.plan.Status.CurrentStepState)
+	scaleAnnotation.Message = s.plan.Status.Message
+	scaleAnnotation.MaxUnavailableReplicas = s.plan.Spec.MaxUnavailableReplicas
+	scaleAnnotation.TargetReplicas = s.plan.Spec.TargetReplicas
+	scaleAnnotation.Direction = Direction(s.plan.Spec.Direction)
+	scaleAnnotation.Service = s.plan.Spec.Service
+	if completion := s.plan.Spec.Completion; completion != nil {
+		scaleAnnotation.Completion = &CompletionPolicy{}
+		if hpa := completion.HPA; hpa != nil {
+			scaleAnnotation.Completion.HPA = &HPAHandoff{
+				Name:                        hpa.Name,
+				MinReplicas:                 hpa.MinReplicas,
+				MaxReplicas:                 hpa.MaxReplicas,
+				TargetCPUUtilizationPercent: hpa.TargetCPUUtilizationPercentage,
+			}
+		}
+	}
+	scaleAnnotation.HandedOff = s.plan.Status.HandedOff
+	if s.plan.Spec.MaxWaitAvailableSeconds != 0 {
+		scaleAnnotation.MaxWaitAvailableSecond = s.plan.Spec.MaxWaitAvailableSeconds
+	}
+	scaleAnnotation.LastUpdateTime = s.plan.Status.LastUpdateTime.Time
+	scaleAnnotation.StepAvailableTime = s.plan.Status.StepAvailableTime.Time
+	scaleAnnotation.ID = s.plan.Status.PlanID
+	for _, record := range s.plan.Status.Transitions {
+		scaleAnnotation.Transitions = append(scaleAnnotation.Transitions, TransitionRecord{
+			From:   StepTransition{Step: record.FromStep, State: StepState(record.FromState)},
+			To:     StepTransition{Step: record.ToStep, State: StepState(record.ToState)},
+			Reason: record.Reason,
+			Time:   record.Time.Time,
+			Actor:  record.Actor,
+		})
+	}
+	if scaleAnnotation.CurrentStepIndex < 1 || scaleAnnotation.CurrentStepIndex > len(scaleAnnotation.Steps) {
+		return nil, fmt.Errorf("current step index %d out of range", scaleAnnotation.CurrentStepIndex)
+	}
+	return &scaleAnnotation, nil
+}
+
+func (s *scalePlanStore) Write(ctx context.Context, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	status := &s.plan.Status
+	status.CurrentStepIndex = scaleAnnotation.CurrentStepIndex
+	status.CurrentStepState = string(scaleAnnotation.CurrentStepState)
+	status.Message = scaleAnnotation.Message
+	status.LastUpdateTime = metav1.NewTime(scaleAnnotation.LastUpdateTime)
+	status.StepAvailableTime = metav1.NewTime(scaleAnnotation.StepAvailableTime)
+	status.HandedOff = scaleAnnotation.HandedOff
+	status.Steps = make([]v1alpha1.StepStatus, len(scaleAnnotation.Steps))
+	for i, step := range scaleAnnotation.Steps {
+		status.Steps[i].StartedAt = metaTimeOrNil(step.StartedAt)
+		status.Steps[i].FinishedAt = metaTimeOrNil(step.FinishedAt)
+		status.Steps[i].AnalyzedAt = metaTimeOrNil(step.AnalyzedAt)
+		status.Steps[i].AnalysisFailures = step.AnalysisFailures
+		status.Steps[i].ProbeSuccesses = step.ProbeSuccesses
+		status.Steps[i].DrainStartedAt = metaTimeOrNil(step.DrainStartedAt)
+	}
+	status.Transitions = make([]v1alpha1.TransitionRecord, len(scaleAnnotation.Transitions))
+	for i, record := range scaleAnnotation.Transitions {
+		status.Transitions[i] = v1alpha1.TransitionRecord{
+			FromStep:  record.From.Step,
+			FromState: string(record.From.State),
+			ToStep:    record.To.Step,
+			ToState:   string(record.To.State),
+			Reason:    record.Reason,
+			Time:      metav1.NewTime(record.Time),
+			Actor:     record.Actor,
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               ScalePlanConditionCompleted,
+		Status:             metav1.ConditionFalse,
+		Reason:             string(scaleAnnotation.CurrentStepState),
+		Message:            fmt.Sprintf("step %d of %d", scaleAnnotation.CurrentStepIndex, len(scaleAnnotation.Steps)),
+		ObservedGeneration: s.plan.Generation,
+	}
+	if scaleAnnotation.CurrentStepState == StepStateCompleted {
+		condition.Status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+	return nil
+}
+
+func timeOrNil(t *metav1.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	return &t.Time
+}
+
+func metaTimeOrNil(t *time.Time) *metav1.Time {
+	if t == nil {
+		return nil
+	}
+	mt := metav1.NewTime(*t)
+	return &mt
+}
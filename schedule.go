@@ -0,0 +1,168 @@
+package annotationscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// SchedulesAnnotationKey holds a JSON list of ScheduledPlan.
+	SchedulesAnnotationKey = "annotationscale.arcosx.io/schedules"
+	// ScheduleLastRunAnnotationKey holds the JSON map of schedule name to the
+	// unix time the schedule last applied its plan.
+	ScheduleLastRunAnnotationKey = "annotationscale.arcosx.io/schedule-last-run"
+)
+
+// ScheduledPlan re-applies a plan whenever Schedule fires, e.g. scale up
+// every weekday morning. A plan applied by a schedule replaces any plan in
+// flight.
+type ScheduledPlan struct {
+	Name string `json:"name"`
+	// Schedule is a standard 5-field cron expression.
+	Schedule string `json:"schedule"`
+	// Timezone is an IANA name the schedule is evaluated in, UTC by default.
+	Timezone               string `json:"timezone,omitempty"`
+	Steps                  []Step `json:"steps"`
+	MaxWaitAvailableSecond int    `json:"max_wait_available_second,omitempty"`
+	MaxUnavailableReplicas int    `json:"max_unavailable_replicas,omitempty"`
+	TargetReplicas         int32  `json:"target_replicas,omitempty"`
+}
+
+// Next returns the first time after t the schedule fires.
+func (sp *ScheduledPlan) Next(t time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(sp.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	location := time.UTC
+	if sp.Timezone != "" {
+		location, err = time.LoadLocation(sp.Timezone)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return schedule.Next(t.In(location)), nil
+}
+
+// ScaleAnnotation returns the plan to apply when the schedule fires at now.
+func (sp *ScheduledPlan) ScaleAnnotation(now time.Time) ScaleAnnotation {
+	scaleAnnotation := NewScaleAnnotation()
+	scaleAnnotation.Steps = sp.Steps
+	scaleAnnotation.CurrentStepIndex = 1
+	scaleAnnotation.CurrentStepState = StepStateReady
+	scaleAnnotation.Message = fmt.Sprintf("applied by schedule %s", sp.Name)
+	if sp.MaxWaitAvailableSecond > 0 {
+		scaleAnnotation.MaxWaitAvailableSecond = sp.MaxWaitAvailableSecond
+	}
+	scaleAnnotation.MaxUnavailableReplicas = sp.MaxUnavailableReplicas
+	scaleAnnotation.TargetReplicas = sp.TargetReplicas
+	scaleAnnotation.LastUpdateTime = now
+	scaleAnnotation.recordTransition(StepTransition{}, scaleAnnotation.Message, controllerActor)
+	return scaleAnnotation
+}
+
+func readSchedules(annotations map[string]string) ([]ScheduledPlan, map[string]int64, error) {
+	schedulesJSON, ok := annotations[SchedulesAnnotationKey]
+	if !ok {
+		return nil, nil, nil
+	}
+	var schedules []ScheduledPlan
+	if err := json.Unmarshal([]byte(schedulesJSON), &schedules); err != nil {
+		return nil, nil, err
+	}
+	lastRun := make(map[string]int64)
+	if lastRunJSON, ok := annotations[ScheduleLastRunAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(lastRunJSON), &lastRun); err != nil {
+			return nil, nil, err
+		}
+	}
+	return schedules, lastRun, nil
+}
+
+// reconcileSchedules applies the plan of the first due schedule. A schedule
+// seen for the first time only starts counting from now, missed runs while
+// the controller was down are applied once.
+func (r *DeploymentReconciler) reconcileSchedules(ctx context.Context, logger logr.Logger, workload *Workload, store StateStore) (reconcile.Result, bool, error) {
+	schedules, lastRun, err := readSchedules(workload.Object.GetAnnotations())
+	if err != nil {
+		logger.Error(err, "failed to parse schedules")
+		return reconcile.Result{}, false, nil
+	}
+	if len(schedules) == 0 {
+		return reconcile.Result{}, false, nil
+	}
+
+	now := r.now()
+	var due *ScheduledPlan
+	var nextRun time.Time
+	changed := false
+	for i := range schedules {
+		schedule := &schedules[i]
+		last, ok := lastRun[schedule.Name]
+		if !ok {
+			lastRun[schedule.Name] = now.Unix()
+			changed = true
+			last = now.Unix()
+		}
+		next, err := schedule.Next(time.Unix(last, 0))
+		if err != nil {
+			logger.Error(err, "invalid schedule", "schedule", schedule.Name)
+			continue
+		}
+		if !next.After(now) && due == nil {
+			due = schedule
+			lastRun[schedule.Name] = now.Unix()
+			changed = true
+			next, _ = schedule.Next(now)
+		}
+		if nextRun.IsZero() || next.Before(nextRun) {
+			nextRun = next
+		}
+	}
+
+	result := reconcile.Result{}
+	if !nextRun.IsZero() {
+		result.RequeueAfter = nextRun.Sub(now)
+	}
+	if !changed {
+		return result, false, nil
+	}
+
+	lastRunJSONBytes, err := json.Marshal(lastRun)
+	if err != nil {
+		return result, false, err
+	}
+	annotations := workload.Object.GetAnnotations()
+	annotations[ScheduleLastRunAnnotationKey] = string(lastRunJSONBytes)
+	workload.Object.SetAnnotations(annotations)
+	if due != nil {
+		logger.V(2).Info("apply scheduled plan", "schedule", due.Name, "next run", nextRun.String())
+		scaleAnnotation := due.ScaleAnnotation(now)
+		if err := store.Write(ctx, workload, &scaleAnnotation); err != nil {
+			return result, false, err
+		}
+	}
+	if err := r.patchWorkload(ctx, logger, workload); err != nil {
+		logger.Error(err, "failed to patch")
+		return result, false, err
+	}
+	return result, due != nil, nil
+}
+
+// earliestRequeue combines two results, requeueing at the earliest time
+// either of them asks for.
+func earliestRequeue(a, b reconcile.Result) reconcile.Result {
+	if a.Requeue || b.Requeue {
+		a.Requeue = true
+	}
+	if a.RequeueAfter == 0 || (b.RequeueAfter != 0 && b.RequeueAfter < a.RequeueAfter) {
+		a.RequeueAfter = b.RequeueAfter
+	}
+	return a
+}
@@ -0,0 +1,347 @@
+package annotationscale
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/scale"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/arcosx/annotationscale/api/v1alpha1"
+)
+
+// ReconcilerOptions configures the controllers added by AddToManager.
+type ReconcilerOptions struct {
+	// Log defaults to the manager's logger.
+	Log *logr.Logger
+	// LogSampling drops repeated identical log lines, nil logs every line.
+	LogSampling *LogSampling
+	// Requeue configures the requeue of workloads waiting on a step, nil
+	// requeues them every 5 seconds.
+	Requeue *RequeueBackoff
+	// DrainTimeout is how long in-flight reconciles may finish their patches
+	// once the manager stops, DefaultDrainTimeout by default. The manager
+	// must give its runnables as long to stop.
+	DrainTimeout time.Duration
+	// Availability selects the replicas steps wait for, AvailabilityAvailable
+	// by default. AvailableReplicas counts them instead when set.
+	Availability      AvailabilityCriterion
+	AvailableReplicas AvailableReplicasFunc
+	// WaitForTerminatingPods also waits, until the step deadline, for the
+	// pods of the workload being deleted to be gone.
+	WaitForTerminatingPods bool
+	// PodReadiness, when set, counts only the pods passing its checks toward
+	// the available replicas of steps.
+	PodReadiness *PodReadiness
+	// ScaleTarget makes the manager drive the given kind through its scale
+	// subresource instead of appsv1.Deployment.
+	ScaleTarget *schema.GroupVersionKind
+	// ArgoRollouts makes the manager drive argoproj.io Rollouts instead of
+	// appsv1.Deployment.
+	ArgoRollouts bool
+	// Knative makes the manager drive the min-scale of Knative Services
+	// instead of appsv1.Deployment.
+	Knative *KnativeOptions
+	// CloneSets makes the manager drive OpenKruise CloneSets instead of
+	// appsv1.Deployment.
+	CloneSets bool
+	// HPAs makes the manager drive the replica bounds of
+	// HorizontalPodAutoscalers instead of appsv1.Deployment.
+	HPAs *HPAOptions
+	// ScalePlans additionally reconciles ScalePlan objects, see config/crd.
+	ScalePlans bool
+	// ScaleGroups additionally reconciles ScaleGroup objects.
+	ScaleGroups bool
+	// AnnotationFormat selects how plans are written back, bare keys by default.
+	AnnotationFormat AnnotationFormat
+	// BlackoutWindows apply to every plan in addition to the plan's own.
+	BlackoutWindows []Window
+	// DefaultingWebhook registers the plan defaulting webhook on the
+	// manager's webhook server at DefaultingWebhookPath.
+	DefaultingWebhook bool
+	// HistoryLimit is the number of finished plans kept in
+	// HistoryAnnotationKey, DefaultHistoryLimit when 0. Negative disables history.
+	HistoryLimit int
+	// Hooks are called on plan transitions.
+	Hooks Hooks
+	// Notifiers are sent the plan starts, pauses, timeouts, errors and
+	// completions.
+	Notifiers []Notifier
+	// CloudEvents receives a CloudEvent for every plan transition.
+	CloudEvents *CloudEventsSink
+	// TracerProvider traces reconciles and plans, the global one by default.
+	TracerProvider trace.TracerProvider
+	// PrometheusAddress is queried by step analyses, e.g.
+	// "http://prometheus.monitoring:9090".
+	PrometheusAddress string
+	// ResourceGate holds steps while the workload's pods are too busy,
+	// it needs metrics-server.
+	ResourceGate *ResourceGate
+	// KEDA pauses the ScaledObjects targeting a workload while its plan is
+	// in flight, see KEDAPausedReplicasAnnotationKey.
+	KEDA bool
+	// CapacityCheck pauses plans whose next step would not fit on the nodes.
+	CapacityCheck *CapacityCheck
+	// PodDeletionCost is applied to the pods before a step scales down.
+	PodDeletionCost PodDeletionCostFunc
+	// MaxConcurrentPlans limits how many plans run at once, the others wait
+	// in StepReady at their first step. 0 means no limit.
+	MaxConcurrentPlans int
+	// RampLimit delays steps adding more replicas per minute than allowed.
+	RampLimit *RampLimit
+	// NamespaceRateLimits bounds the reconciles of each namespace.
+	NamespaceRateLimits *NamespaceRateLimits
+	// RateLimiter tunes the retries of the controllers, nil keeps the
+	// controller-runtime defaults.
+	RateLimiter *RateLimiterOptions
+	// Namespaces restricts the namespaces the controllers touch.
+	Namespaces *NamespaceFilter
+	// ClusterName labels the metrics of the controllers, for processes
+	// managing several clusters.
+	ClusterName string
+	// StateStore keeps the plans, in the workloads' annotations by default.
+	StateStore NewStateStoreFunc
+	// Clock defaults to the wall clock, tests pass a FakeClock.
+	Clock Clock
+	// Shadow makes the controllers compute their decisions and log and
+	// count the writes they would make without making them.
+	Shadow bool
+	// ExternalReplicas is what happens to a plan when its workload is scaled
+	// by someone else mid-plan, ExternalReplicasRevert by default.
+	ExternalReplicas ExternalReplicasPolicy
+	// PauseOnRollout holds plans while their Deployment rolls out a new pod
+	// template, availability then counts pods being replaced.
+	PauseOnRollout bool
+	// OwnershipLease makes managers with overlapping selectors claim each
+	// plan before driving it.
+	OwnershipLease *OwnershipLease
+	// ForeignControllers recognizes the workloads of other progressive
+	// delivery controllers, DefaultForeignControllers when nil.
+	ForeignControllers *ForeignControllers
+	// Freeze stops all plans from advancing while frozen.
+	Freeze *Freeze
+	// FreezeConfigMapNamespace, when set, freezes all plans while the
+	// FreezeConfigMapName ConfigMap in it has FreezeAnnotationKey.
+	FreezeConfigMapNamespace string
+	// NamespacePause suspends the plans of namespaces annotated with
+	// NamespacePausedAnnotationKey, it needs permission to get namespaces.
+	NamespacePause bool
+	// Finalizer adds PlanFinalizer to workloads with a plan in flight, so
+	// that a deleted workload's plan is recorded as interrupted and its
+	// resources are released first.
+	Finalizer bool
+}
+
+// AddToManager sets up the annotationscale controllers on an existing
+// manager, so embedders can share their manager and cache instead of
+// running an AnnotationScaleManager.
+func AddToManager(mgr manager.Manager, opts ReconcilerOptions) error {
+	log := opts.Log
+	if log == nil {
+		mgrLog := mgr.GetLogger().WithName("annotationscale")
+		log = &mgrLog
+	}
+	if opts.LogSampling != nil {
+		sampled := newSampledLogger(*log, opts.LogSampling)
+		log = &sampled
+	}
+
+	reconciler := &DeploymentReconciler{
+		log:              log,
+		cluster:          opts.ClusterName,
+		annotationFormat: opts.AnnotationFormat,
+		blackoutWindows:  opts.BlackoutWindows,
+		historyLimit:     opts.HistoryLimit,
+		hooks:            opts.Hooks,
+		notifiers:        opts.Notifiers,
+		cloudEvents:      opts.CloudEvents,
+		tracerProvider:   opts.TracerProvider,
+
+		prometheusAddress:   opts.PrometheusAddress,
+		resourceGateOptions: opts.ResourceGate,
+		keda:                opts.KEDA,
+		capacityCheck:       opts.CapacityCheck,
+		podDeletionCost:     opts.PodDeletionCost,
+		planBudget:          newPlanBudget(opts.MaxConcurrentPlans),
+		rampLimiter:         newRampLimiter(opts.RampLimit),
+		namespaceLimiter:    newNamespaceRateLimiter(opts.ClusterName, opts.NamespaceRateLimits, opts.RateLimiter.rateLimiter(), opts.Clock),
+		namespaces:          opts.Namespaces,
+		apiReader:           mgr.GetAPIReader(),
+		clock:               opts.Clock,
+		shadow:              opts.Shadow,
+		planCache:           newPlanCache(),
+		requeue:             newRequeueBackoff(opts.Requeue),
+		drain:               newReconcileDrain(opts.DrainTimeout),
+		availability:        opts.Availability,
+		availableReplicas:   opts.AvailableReplicas,
+		waitTerminating:     opts.WaitForTerminatingPods,
+		podReadiness:        opts.PodReadiness,
+		externalReplicas:    opts.ExternalReplicas,
+		pauseOnRollout:      opts.PauseOnRollout,
+		ownership:           newOwnershipClaims(opts.OwnershipLease),
+		foreignControllers:  opts.ForeignControllers,
+		freeze:              opts.Freeze,
+		freezeConfigMap:     newFreezeConfigMap(opts.FreezeConfigMapNamespace),
+		namespacePause:      opts.NamespacePause,
+		finalizer:           opts.Finalizer,
+	}
+	if reconciler.foreignControllers == nil {
+		reconciler.foreignControllers = &DefaultForeignControllers
+	}
+	reconciler.recorder = mgr.GetEventRecorderFor("annotationscale")
+	controllerOptions := opts.RateLimiter.controllerOptions()
+	if reconciler.namespaceLimiter != nil {
+		controllerOptions.RateLimiter = reconciler.namespaceLimiter
+	}
+	if opts.StateStore != nil {
+		reconciler.stateStore = opts.StateStore(shadowed(mgr.GetClient(), opts.Shadow, log, opts.ClusterName))
+	}
+
+	kinds := 0
+	for _, set := range []bool{opts.ScaleTarget != nil, opts.ArgoRollouts, opts.Knative != nil, opts.CloneSets, opts.HPAs != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return errors.New("ScaleTarget, ArgoRollouts, Knative, CloneSets and HPAs cannot be combined")
+	}
+	var err error
+	controllerBuilder := builder.ControllerManagedBy(mgr)
+	if opts.ScaleTarget != nil {
+		scales, err := newScaleClient(mgr, *opts.ScaleTarget)
+		if err != nil {
+			log.Error(err, "could not create scale client")
+			return err
+		}
+		reconciler.workloads = reconciler.shadowedWorkloads(scales)
+		controllerBuilder = controllerBuilder.For(newUnstructured(*opts.ScaleTarget))
+	} else if opts.ArgoRollouts {
+		reconciler.workloads = reconciler.shadowedWorkloads(&rolloutClient{client: mgr.GetClient()})
+		controllerBuilder = controllerBuilder.
+			For(newUnstructured(RolloutGVK)).
+			Owns(&appsv1.ReplicaSet{}, builder.OnlyMetadata, builder.WithPredicates(ownedChanged))
+	} else if opts.Knative != nil {
+		reconciler.workloads = reconciler.shadowedWorkloads(&knativeClient{client: mgr.GetClient(), pinMaxScale: opts.Knative.PinMaxScale})
+		controllerBuilder = controllerBuilder.
+			For(newUnstructured(KnativeServiceGVK)).
+			Watches(&source.Kind{Type: newUnstructured(knativeRevisionGVK)}, handler.EnqueueRequestsFromMapFunc(serviceForRevision))
+	} else if opts.CloneSets {
+		reconciler.workloads = reconciler.shadowedWorkloads(&cloneSetClient{client: mgr.GetClient()})
+		controllerBuilder = controllerBuilder.
+			For(newUnstructured(CloneSetGVK)).
+			Owns(&corev1.Pod{}, builder.OnlyMetadata, builder.WithPredicates(ownedChanged))
+	} else if opts.HPAs != nil {
+		reconciler.workloads = reconciler.shadowedWorkloads(&hpaClient{client: mgr.GetClient(), pinMaxReplicas: opts.HPAs.PinMaxReplicas})
+		controllerBuilder = controllerBuilder.For(&autoscalingv2.HorizontalPodAutoscaler{})
+	} else {
+		controllerBuilder = controllerBuilder.
+			For(&appsv1.Deployment{}, builder.WithPredicates(deploymentChanged)).
+			Owns(&appsv1.ReplicaSet{}, builder.OnlyMetadata, builder.WithPredicates(ownedChanged)).
+			Owns(&corev1.Pod{}, builder.OnlyMetadata, builder.WithPredicates(ownedChanged)).
+			Watches(&source.Kind{Type: &appsv1.Deployment{}}, handler.EnqueueRequestsFromMapFunc(reconciler.followersOf), builder.WithPredicates(deploymentChanged))
+	}
+	switch reconciler.stateStore.(type) {
+	case configMapStore:
+		controllerBuilder = controllerBuilder.Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(workloadForConfigMap))
+	case scalePlanStateStore:
+		if opts.ScalePlans {
+			return errors.New("ScalePlanStateStore cannot be combined with ScalePlans")
+		}
+		if err := v1alpha1.AddToScheme(mgr.GetScheme()); err != nil {
+			return err
+		}
+		controllerBuilder = controllerBuilder.Watches(&source.Kind{Type: &v1alpha1.ScalePlan{}}, handler.EnqueueRequestsFromMapFunc(workloadForScalePlan))
+	}
+	err = controllerBuilder.
+		WithOptions(controllerOptions).
+		WithEventFilter(opts.Namespaces.predicate()).
+		Complete(reconciler)
+	if err != nil {
+		log.Error(err, "could not create controller")
+		return err
+	}
+
+	if opts.ScalePlans {
+		if err := v1alpha1.AddToScheme(mgr.GetScheme()); err != nil {
+			return err
+		}
+		planReconciler := &ScalePlanReconciler{
+			log:        log,
+			reconciler: reconciler,
+			requeue:    newRequeueBackoff(opts.Requeue),
+			newScaleClient: func(gvk schema.GroupVersionKind) (*scaleClient, error) {
+				return newScaleClient(mgr, gvk)
+			},
+		}
+		// the kinds other than Deployments are watched once a plan targets them
+		planReconciler.controller, err = builder.
+			ControllerManagedBy(mgr).
+			For(&v1alpha1.ScalePlan{}).
+			Watches(&source.Kind{Type: &appsv1.Deployment{}}, handler.EnqueueRequestsFromMapFunc(planReconciler.plansFor(deploymentGVK))).
+			WithOptions(opts.RateLimiter.controllerOptions()).
+			WithEventFilter(opts.Namespaces.predicate()).
+			Build(planReconciler)
+		if err != nil {
+			log.Error(err, "could not create scaleplan controller")
+			return err
+		}
+	}
+
+	if opts.ScaleGroups {
+		if err := v1alpha1.AddToScheme(mgr.GetScheme()); err != nil {
+			return err
+		}
+		groupReconciler := &GroupReconciler{log: log, namespaces: opts.Namespaces, shadow: opts.Shadow, clock: opts.Clock, requeue: newRequeueBackoff(opts.Requeue)}
+		err = builder.
+			ControllerManagedBy(mgr).
+			For(&v1alpha1.ScaleGroup{}).
+			Watches(&source.Kind{Type: &appsv1.Deployment{}}, handler.EnqueueRequestsFromMapFunc(groupReconciler.groupsForDeployment)).
+			WithOptions(opts.RateLimiter.controllerOptions()).
+			WithEventFilter(opts.Namespaces.predicate()).
+			Complete(groupReconciler)
+		if err != nil {
+			log.Error(err, "could not create scalegroup controller")
+			return err
+		}
+	}
+
+	if opts.DefaultingWebhook {
+		mgr.GetWebhookServer().Register(DefaultingWebhookPath, &webhook.Admission{Handler: &planDefaulter{log: log, clock: opts.Clock}})
+	}
+	return nil
+}
+
+func newScaleClient(mgr manager.Manager, gvk schema.GroupVersionKind) (*scaleClient, error) {
+	mapping, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	scales, err := scale.NewForConfig(mgr.GetConfig(), mgr.GetRESTMapper(), dynamic.LegacyAPIPathResolverFunc,
+		scale.NewDiscoveryScaleKindResolver(discoveryClient))
+	if err != nil {
+		return nil, err
+	}
+	return &scaleClient{
+		client:   mgr.GetClient(),
+		scales:   scales,
+		gvk:      gvk,
+		resource: mapping.Resource.GroupResource(),
+	}, nil
+}
@@ -0,0 +1,125 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// In shadow mode the reconciler computes every decision and logs and counts
+// the writes it would make instead of making them, so that plans can be
+// validated before the controller is granted write access.
+
+// ShadowEventAnnotationKey is set to "true" on the Events recorded in shadow
+// mode, for decisions that were not carried out.
+const ShadowEventAnnotationKey = "annotationscale.arcosx.io/shadow"
+
+// shadowClient drops the writes of the reconciler's client.
+type shadowClient struct {
+	client.Client
+	log     logr.Logger
+	cluster string
+}
+
+// shadowed wraps c in a shadowClient when shadow is set.
+func shadowed(c client.Client, shadow bool, log *logr.Logger, cluster string) client.Client {
+	if !shadow {
+		return c
+	}
+	return &shadowClient{Client: c, log: log.WithName("shadow"), cluster: cluster}
+}
+
+func (c *shadowClient) skip(verb string, obj client.Object) {
+	kind := fmt.Sprintf("%T", obj)
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	c.log.Info("skipped write", "verb", verb, "kind", kind, "namespace", obj.GetNamespace(), "name", obj.GetName())
+	shadowWritesTotal.WithLabelValues(c.cluster, obj.GetNamespace(), verb).Inc()
+}
+
+func (c *shadowClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.skip("create", obj)
+	return nil
+}
+
+func (c *shadowClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.skip("update", obj)
+	return nil
+}
+
+func (c *shadowClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.skip("patch", obj)
+	return nil
+}
+
+func (c *shadowClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.skip("delete", obj)
+	return nil
+}
+
+func (c *shadowClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	c.skip("deletecollection", obj)
+	return nil
+}
+
+func (c *shadowClient) Status() client.SubResourceWriter {
+	return shadowStatusWriter{c}
+}
+
+type shadowStatusWriter struct {
+	c *shadowClient
+}
+
+func (w shadowStatusWriter) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	w.c.skip("create status", obj)
+	return nil
+}
+
+func (w shadowStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	w.c.skip("update status", obj)
+	return nil
+}
+
+func (w shadowStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	w.c.skip("patch status", obj)
+	return nil
+}
+
+// shadowWorkloads reads workloads and logs the patches it would apply.
+type shadowWorkloads struct {
+	workloads workloadClient
+	log       logr.Logger
+	cluster   string
+}
+
+// shadowedWorkloads wraps workloads in shadow mode.
+func (r *DeploymentReconciler) shadowedWorkloads(workloads workloadClient) workloadClient {
+	if !r.shadow {
+		return workloads
+	}
+	return &shadowWorkloads{workloads: workloads, log: r.log.WithName("shadow"), cluster: r.cluster}
+}
+
+func (s *shadowWorkloads) Get(ctx context.Context, key types.NamespacedName) (*Workload, error) {
+	workload, err := s.workloads.Get(ctx, key)
+	if workload != nil {
+		workload.client = s
+	}
+	return workload, err
+}
+
+func (s *shadowWorkloads) Patch(ctx context.Context, workload *Workload) error {
+	s.log.Info("skipped workload patch",
+		"namespace", workload.Object.GetNamespace(),
+		"name", workload.Object.GetName(),
+		"spec.replicas", workload.Replicas,
+		"spec.paused", workload.Paused,
+	)
+	shadowWritesTotal.WithLabelValues(s.cluster, workload.Object.GetNamespace(), "patch workload").Inc()
+	return nil
+}
@@ -0,0 +1,58 @@
+package annotationscale
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultDrainTimeout is how long in-flight reconciles may finish after the
+// manager stopped, the graceful shutdown timeout of controller-runtime.
+const DefaultDrainTimeout = 30 * time.Second
+
+// reconcileDrain lets in-flight reconciles finish their patches when the
+// manager stops, instead of failing on the cancelled context between the
+// plan and the replicas. A nil reconcileDrain does not detach them.
+type reconcileDrain struct {
+	timeout time.Duration
+}
+
+func newReconcileDrain(timeout time.Duration) *reconcileDrain {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	return &reconcileDrain{timeout: timeout}
+}
+
+// detach returns a context with the values of ctx that is only cancelled
+// d.timeout after ctx is, or by the returned cancel once the reconcile is
+// done.
+func (d *reconcileDrain) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d == nil {
+		return ctx, func() {}
+	}
+	detached, cancel := context.WithCancel(valuesContext{ctx})
+	go func() {
+		select {
+		case <-detached.Done():
+			return
+		case <-ctx.Done():
+		}
+		timer := time.NewTimer(d.timeout)
+		defer timer.Stop()
+		select {
+		case <-detached.Done():
+		case <-timer.C:
+			cancel()
+		}
+	}()
+	return detached, cancel
+}
+
+// valuesContext has the values of its context but is never cancelled.
+type valuesContext struct {
+	context.Context
+}
+
+func (valuesContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valuesContext) Done() <-chan struct{}       { return nil }
+func (valuesContext) Err() error                  { return nil }
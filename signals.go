@@ -0,0 +1,57 @@
+package annotationscale
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Exit codes of RunWithSignals.
+const (
+	// ExitCodeOK is returned when the manager stopped after a signal or Stop.
+	ExitCodeOK = 0
+	// ExitCodeError is returned when the manager failed.
+	ExitCodeError = 1
+	// ExitCodeInterrupted is returned on a second signal, without waiting
+	// for the in-flight reconciles to drain.
+	ExitCodeInterrupted = 130
+)
+
+// RunWithSignals runs the manager until SIGTERM or SIGINT, then stops it
+// gracefully, draining in-flight reconciles; a second signal returns at once.
+// It returns the exit code for the process, e.g. os.Exit(m.RunWithSignals()).
+func (m *AnnotationScaleManager) RunWithSignals() int {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return exitCode(err)
+	case sig := <-signals:
+		m.log.Info("received signal, stopping", "signal", sig.String())
+		cancel()
+	}
+	select {
+	case err := <-done:
+		return exitCode(err)
+	case sig := <-signals:
+		m.log.Info("received second signal, exiting", "signal", sig.String())
+		return ExitCodeInterrupted
+	}
+}
+
+func exitCode(err error) int {
+	if err != nil {
+		return ExitCodeError
+	}
+	return ExitCodeOK
+}
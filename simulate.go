@@ -0,0 +1,183 @@
+package annotationscale
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// SimulateOptions configures SimulatePlan.
+type SimulateOptions struct {
+	// Start is when the plan is applied, time.Now() by default.
+	Start time.Time
+	// RolloutTime is how long new replicas take to become available in the
+	// earliest case. In the latest case they become available at the step
+	// deadline.
+	RolloutTime time.Duration
+	// BlackoutWindows apply in addition to the plan's own.
+	BlackoutWindows []Window
+}
+
+// SimulatedStep is when a step of a simulated plan reaches its replicas.
+type SimulatedStep struct {
+	Step     int
+	Replicas int32
+	// Pause steps wait for ResumePlan, the simulation resumes them at once.
+	Pause    bool
+	Earliest time.Time
+	Latest   time.Time
+}
+
+// simulationLimit bounds the transitions of a simulation.
+const simulationLimit = 100000
+
+// SimulatePlan runs the state machine of plan against a FakeClock for a
+// workload at currentReplicas, and returns when each step would finish. Gates
+// such as probes, analyses, webhooks and jobs are assumed to pass at once,
+// holds and blackout windows are waited for.
+func SimulatePlan(plan *ScaleAnnotation, currentReplicas int32, opts SimulateOptions) ([]SimulatedStep, error) {
+	if len(plan.Steps) == 0 {
+		return nil, ErrorScaleAnnotationParseSteps
+	}
+	if opts.Start.IsZero() {
+		opts.Start = time.Now()
+	}
+	earliest, err := simulate(plan, currentReplicas, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := simulate(plan, currentReplicas, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	timeline := make([]SimulatedStep, len(plan.Steps))
+	for i := range plan.Steps {
+		timeline[i] = SimulatedStep{
+			Step:     i + 1,
+			Replicas: plan.StepReplicas(i + 1),
+			Pause:    plan.Steps[i].Pause,
+			Earliest: earliest[i],
+			Latest:   latest[i],
+		}
+	}
+	return timeline, nil
+}
+
+// simulate returns when each step finishes, with replicas available after
+// opts.RolloutTime or, when late, at the step deadline.
+func simulate(plan *ScaleAnnotation, currentReplicas int32, opts SimulateOptions, late bool) ([]time.Time, error) {
+	clock := NewFakeClock(opts.Start)
+	sa := *plan
+	sa.Steps = make([]Step, len(plan.Steps))
+	for i, step := range plan.Steps {
+		step.resetProgress()
+		sa.Steps[i] = step
+	}
+	sa.CurrentStepIndex = 1
+	sa.CurrentStepState = StepStateReady
+	sa.LastUpdateTime = opts.Start
+	sa.StepAvailableTime = time.Time{}
+	sa.HandedOff = false
+
+	workload := &Workload{
+		Replicas:      currentReplicas,
+		SupportsPause: true,
+		Status:        WorkloadStatus{Replicas: currentReplicas, AvailableReplicas: currentReplicas},
+	}
+	availableAt := opts.Start
+	rollout := func() {
+		availableAt = clock.Now().Add(opts.RolloutTime)
+		if late {
+			availableAt = sa.StepDeadline()
+		}
+		// pods of the previous step stay available
+		if workload.Status.AvailableReplicas > workload.Replicas {
+			workload.Status.AvailableReplicas = workload.Replicas
+		}
+		workload.Status.Replicas = workload.Replicas
+	}
+	observe := func() {
+		if !clock.Now().Before(availableAt) {
+			workload.Status.AvailableReplicas = workload.Status.Replicas
+		}
+		workload.Status.UnavailableReplicas = workload.Status.Replicas - workload.Status.AvailableReplicas
+	}
+
+	finished := make([]time.Time, len(sa.Steps))
+	if currentReplicas == sa.StepReplicas(1) {
+		finished[0] = opts.Start
+	}
+	for i := 0; i < simulationLimit; i++ {
+		observe()
+		now := clock.Now()
+		t := NextTransition(&sa, workload, now)
+		switch t.Kind {
+		case TransitionNone:
+			if sa.CurrentStepState == StepStatePaused {
+				// ResumePlan
+				workload.Paused = false
+				sa.CurrentStepState = StepStateReady
+				sa.LastUpdateTime = now
+				continue
+			}
+			if sa.CurrentStepState == StepStateCompleted {
+				return finished, nil
+			}
+			return nil, fmt.Errorf("simulation stopped at step %d: %s", sa.CurrentStepIndex, t.Reason)
+
+		case TransitionFixReplicas:
+			workload.Replicas = t.Replicas
+			sa.CurrentStepState = t.State
+			sa.LastUpdateTime = now
+			sa.startStep(sa.CurrentStepIndex, now)
+			rollout()
+
+		case TransitionUnpause:
+			workload.Paused = false
+
+		case TransitionWaitRollout:
+			workload.Status.Replicas = workload.Replicas
+
+		case TransitionRestartHold:
+			sa.StepAvailableTime = time.Time{}
+
+		case TransitionWaitAvailable:
+			wait := availableAt
+			if deadline := sa.StepDeadline(); deadline.Before(wait) {
+				wait = deadline
+			}
+			clock.Set(wait)
+
+		case TransitionTimeout, TransitionPauseWorkload:
+			return nil, fmt.Errorf("simulation stopped at step %d: %s", sa.CurrentStepIndex, t.Reason)
+
+		case TransitionFinishStep, TransitionComplete, TransitionAdvance:
+			if t.Kind == TransitionAdvance {
+				window, err := activeWindow(now, sa.BlackoutWindows, opts.BlackoutWindows)
+				if err != nil {
+					return nil, err
+				}
+				if window != nil {
+					clock.Step(time.Minute)
+					continue
+				}
+			}
+			if t.Available && sa.CurrentStepState == StepStateUpgrade {
+				if hold := sa.Steps[sa.CurrentStepIndex-1].HoldSeconds; hold > 0 {
+					clock.Step(time.Duration(hold) * time.Second)
+					now = clock.Now()
+				}
+			}
+			if t.Kind == TransitionFinishStep {
+				finished[sa.CurrentStepIndex-1] = now
+			}
+			applyTransition(logr.Discard(), workload, &sa, t, now)
+			if t.Kind == TransitionAdvance {
+				rollout()
+			}
+		}
+	}
+	return nil, errors.New("simulation did not finish")
+}
@@ -0,0 +1,106 @@
+package annotationscale
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// PlanStatus summarises a plan for dashboards and CLIs.
+type PlanStatus struct {
+	// ID is empty until the controller adopted the plan.
+	ID         string
+	State      StepState
+	Message    string
+	Step       int
+	TotalSteps int
+	// StepsDone counts the steps that reached their replicas, including the
+	// current one once it is ready.
+	StepsDone       int
+	PercentComplete int
+	// TimeInStep is the time since the last transition of the current step.
+	TimeInStep time.Duration
+	// ETA estimates the time until the plan completes from the durations of
+	// the previous steps, zero when finished or unknown.
+	ETA time.Duration
+}
+
+// GetPlanStatus reads the plan of deployment.
+func GetPlanStatus(deployment *appsv1.Deployment) (*PlanStatus, error) {
+	scaleAnnotation, err := ReadScaleAnnotation(deployment.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	return planStatus(scaleAnnotation, time.Now()), nil
+}
+
+func planStatus(scaleAnnotation *ScaleAnnotation, now time.Time) *PlanStatus {
+	status := &PlanStatus{
+		ID:         scaleAnnotation.ID,
+		State:      scaleAnnotation.CurrentStepState,
+		Message:    scaleAnnotation.Message,
+		Step:       scaleAnnotation.CurrentStepIndex,
+		TotalSteps: len(scaleAnnotation.Steps),
+		StepsDone:  scaleAnnotation.CurrentStepIndex - 1,
+	}
+	switch scaleAnnotation.CurrentStepState {
+	case StepStateReady, StepStateCompleted:
+		status.StepsDone++
+	}
+	if status.StepsDone < 0 {
+		status.StepsDone = 0
+	}
+	if status.TotalSteps > 0 {
+		status.PercentComplete = status.StepsDone * 100 / status.TotalSteps
+	}
+	if !scaleAnnotation.LastUpdateTime.IsZero() {
+		status.TimeInStep = now.Sub(scaleAnnotation.LastUpdateTime)
+	}
+
+	switch scaleAnnotation.CurrentStepState {
+	case StepStateCompleted, StepStateAborted:
+		return status
+	}
+	if average, ok := averageStepDuration(scaleAnnotation); ok {
+		remaining := time.Duration(status.TotalSteps-status.StepsDone) * average
+		// the current step is already partly done
+		if status.StepsDone < status.TotalSteps && status.TimeInStep < average {
+			remaining -= status.TimeInStep
+		}
+		status.ETA = remaining
+	}
+	return status
+}
+
+// averageStepDuration is the mean duration of the steps with both StartedAt
+// and FinishedAt recorded. Without any, e.g. for plans started by an older
+// controller, it is the mean time between the transitions into the next step.
+func averageStepDuration(scaleAnnotation *ScaleAnnotation) (time.Duration, bool) {
+	var total time.Duration
+	var n int
+	for _, step := range scaleAnnotation.Steps {
+		if step.StartedAt == nil || step.FinishedAt == nil || step.Skipped {
+			continue
+		}
+		total += step.FinishedAt.Sub(*step.StartedAt)
+		n++
+	}
+	if n == 0 {
+		var entered time.Time
+		for _, record := range scaleAnnotation.Transitions {
+			switch {
+			case record.To.Step == record.From.Step:
+				continue
+			case record.To.Step > record.From.Step && record.From.Step >= 1 && !entered.IsZero():
+				total += record.Time.Sub(entered)
+				n++
+			}
+			// a plan moved back, e.g. restarted, starts the step afresh
+			entered = record.Time
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return total / time.Duration(n), true
+}
@@ -0,0 +1,83 @@
+package annotationscale
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseStepExpression parses steps written as comma separated replica
+// counts, e.g. "1,2,5,10..50/10,100p". "a..b/s" counts from a to b by s
+// (1 by default), always ending at b, and a "p" suffix makes the steps
+// pause steps.
+func ParseStepExpression(expression string) ([]Step, error) {
+	var steps []Step
+	for _, term := range strings.Split(expression, ",") {
+		term = strings.TrimSpace(term)
+		pause := strings.HasSuffix(term, "p")
+		term = strings.TrimSuffix(term, "p")
+		from, to, stride, err := parseStepTerm(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid step expression %q: %w", expression, err)
+		}
+		if to < from {
+			stride = -stride
+		}
+		for replicas := from; ; replicas += stride {
+			if (stride > 0 && replicas > to) || (stride < 0 && replicas < to) {
+				replicas = to
+			}
+			steps = append(steps, Step{Replicas: replicas, Pause: pause})
+			if replicas == to {
+				break
+			}
+		}
+	}
+	return steps, nil
+}
+
+// parseStepTerm parses "n" or "a..b" or "a..b/s".
+func parseStepTerm(term string) (from, to, stride int32, err error) {
+	stride = 1
+	rangeTerm, strideTerm, hasStride := strings.Cut(term, "/")
+	if hasStride {
+		if stride, err = parseReplicas(strideTerm); err != nil {
+			return 0, 0, 0, err
+		}
+		if stride == 0 {
+			return 0, 0, 0, fmt.Errorf("stride of %q must be positive", term)
+		}
+	}
+	fromTerm, toTerm, isRange := strings.Cut(rangeTerm, "..")
+	if hasStride && !isRange {
+		return 0, 0, 0, fmt.Errorf("stride without range in %q", term)
+	}
+	if from, err = parseReplicas(fromTerm); err != nil {
+		return 0, 0, 0, err
+	}
+	to = from
+	if isRange {
+		if to, err = parseReplicas(toTerm); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return from, to, stride, nil
+}
+
+func parseReplicas(value string) (int32, error) {
+	replicas, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if replicas < 0 {
+		return 0, fmt.Errorf("replicas %d must not be negative", replicas)
+	}
+	return int32(replicas), nil
+}
+
+// isStepExpression tells a steps annotation written as an expression from
+// JSON.
+func isStepExpression(steps string) bool {
+	steps = strings.TrimSpace(steps)
+	return steps != "" && steps[0] != '['
+}
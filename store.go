@@ -0,0 +1,181 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/arcosx/annotationscale/api/v1alpha1"
+)
+
+// StateStore reads and writes the plan of a workload. Write either
+// persists the plan or stages it on the workload, which is patched right
+// after. Read returns ErrorScaleAnnotationParseSteps when the workload has
+// no plan.
+type StateStore interface {
+	Read(ctx context.Context, workload *Workload) (*ScaleAnnotation, error)
+	Write(ctx context.Context, workload *Workload, scaleAnnotation *ScaleAnnotation) error
+}
+
+// NewStateStoreFunc builds a StateStore from the manager's client.
+type NewStateStoreFunc func(c client.Client) StateStore
+
+type annotationStore struct {
+	format AnnotationFormat
+	// cache skips parsing the annotations of unchanged workloads, nil
+	// outside of the reconciler.
+	cache *planCache
+}
+
+func (s annotationStore) Read(ctx context.Context, workload *Workload) (*ScaleAnnotation, error) {
+	if scaleAnnotation, ok := s.cache.get(workload.Object); ok {
+		return scaleAnnotation, nil
+	}
+	scaleAnnotation, err := ReadScaleAnnotation(workload.Object.GetAnnotations())
+	if err != nil {
+		return scaleAnnotation, err
+	}
+	s.cache.put(workload.Object, scaleAnnotation)
+	return scaleAnnotation, nil
+}
+
+func (s annotationStore) Write(ctx context.Context, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	if s.format != AnnotationFormatJSON {
+		stepsJSON := s.cache.stepsJSON(workload.Object, scaleAnnotation.Steps)
+		fixedAnnotation, err := setScaleAnnotation(workload.Object.GetAnnotations(), scaleAnnotation, stepsJSON)
+		if err != nil {
+			return err
+		}
+		workload.Object.SetAnnotations(fixedAnnotation)
+		return nil
+	}
+	fixedAnnotation, err := SetScaleAnnotationJSON(workload.Object.GetAnnotations(), scaleAnnotation)
+	if err != nil {
+		return err
+	}
+	workload.Object.SetAnnotations(fixedAnnotation)
+	return nil
+}
+
+// PlanConfigMapSuffix names the companion ConfigMap of a workload used by
+// ConfigMapStateStore, e.g. "web-scale-plan" for the Deployment "web".
+const PlanConfigMapSuffix = "-scale-plan"
+
+// ConfigMapStateStore keeps plans in the data of a companion ConfigMap,
+// under the same keys as the annotations. ConfigMaps hold up to 1MiB and
+// survive tools stripping unknown annotations.
+func ConfigMapStateStore(c client.Client) StateStore {
+	return configMapStore{client: c}
+}
+
+type configMapStore struct {
+	client client.Client
+}
+
+func planConfigMapKey(workload *Workload) types.NamespacedName {
+	return types.NamespacedName{Namespace: workload.Object.GetNamespace(), Name: workload.Object.GetName() + PlanConfigMapSuffix}
+}
+
+func (s configMapStore) Read(ctx context.Context, workload *Workload) (*ScaleAnnotation, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := s.client.Get(ctx, planConfigMapKey(workload), configMap); err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, ErrorScaleAnnotationParseSteps
+		}
+		return nil, err
+	}
+	return ReadScaleAnnotation(configMap.Data)
+}
+
+func (s configMapStore) Write(ctx context.Context, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	key := planConfigMapKey(workload)
+	configMap := &corev1.ConfigMap{}
+	err := s.client.Get(ctx, key, configMap)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return err
+	}
+	data, err := SetScaleAnnotation(configMap.Data, scaleAnnotation)
+	if err != nil {
+		return err
+	}
+	configMap.Data = data
+	if configMap.ResourceVersion == "" {
+		configMap.ObjectMeta = metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}
+		return s.client.Create(ctx, configMap)
+	}
+	return s.client.Update(ctx, configMap)
+}
+
+// workloadForConfigMap maps a companion ConfigMap to its workload.
+func workloadForConfigMap(obj client.Object) []reconcile.Request {
+	name := strings.TrimSuffix(obj.GetName(), PlanConfigMapSuffix)
+	if name == obj.GetName() || name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
+// ScalePlanStateStore keeps plans in the ScalePlan targeting the workload,
+// driven by the workload's controller instead of the ScalePlan controller.
+// It cannot be combined with ScalePlans.
+func ScalePlanStateStore(c client.Client) StateStore {
+	return scalePlanStateStore{client: c}
+}
+
+type scalePlanStateStore struct {
+	client client.Client
+}
+
+func (s scalePlanStateStore) plan(ctx context.Context, workload *Workload) (*v1alpha1.ScalePlan, error) {
+	plans := &v1alpha1.ScalePlanList{}
+	if err := s.client.List(ctx, plans, client.InNamespace(workload.Object.GetNamespace())); err != nil {
+		return nil, err
+	}
+	kind := workloadKind(workload)
+	for i := range plans.Items {
+		ref := plans.Items[i].Spec.TargetRef
+		if ref.Name == workload.Object.GetName() && (ref.Kind == "" || ref.Kind == kind) {
+			return &plans.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no scaleplan targets %s", ErrorScaleAnnotationParseSteps, workload.Object.GetName())
+}
+
+func (s scalePlanStateStore) Read(ctx context.Context, workload *Workload) (*ScaleAnnotation, error) {
+	plan, err := s.plan(ctx, workload)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Status.ObservedGeneration != plan.Generation {
+		restartScalePlan(plan)
+	}
+	return (&scalePlanStore{plan: plan}).Read(ctx, workload)
+}
+
+func (s scalePlanStateStore) Write(ctx context.Context, workload *Workload, scaleAnnotation *ScaleAnnotation) error {
+	plan, err := s.plan(ctx, workload)
+	if err != nil {
+		return err
+	}
+	plan.Status.ObservedGeneration = plan.Generation
+	if err := (&scalePlanStore{plan: plan}).Write(ctx, workload, scaleAnnotation); err != nil {
+		return err
+	}
+	return s.client.Status().Update(ctx, plan)
+}
+
+// workloadForScalePlan maps a ScalePlan to its target.
+func workloadForScalePlan(obj client.Object) []reconcile.Request {
+	plan, ok := obj.(*v1alpha1.ScalePlan)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: plan.Namespace, Name: plan.Spec.TargetRef.Name}}}
+}
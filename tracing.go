@@ -0,0 +1,189 @@
+package annotationscale
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/arcosx/annotationscale"
+
+// NewOTLPTracerProvider returns a TracerProvider exporting spans over OTLP
+// gRPC, configured by opts or the OTEL_EXPORTER_OTLP_* environment variables.
+// It generates the IDs of plan traces, see NewPlanIDGenerator. Shut it down
+// to flush the spans.
+func NewOTLPTracerProvider(ctx context.Context, opts ...otlptracegrpc.Option) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithIDGenerator(NewPlanIDGenerator()),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "annotationscale"))),
+	), nil
+}
+
+// NewPlanIDGenerator returns the IDGenerator for TracerProviders passed to
+// WithTracing. It gives the root span of a plan trace the IDs its step spans
+// were parented to; other providers export the step spans without it.
+func NewPlanIDGenerator() sdktrace.IDGenerator {
+	return planIDGenerator{}
+}
+
+type planIDGenerator struct{}
+
+type planSpanKey struct{}
+
+func (planIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if sc, ok := ctx.Value(planSpanKey{}).(trace.SpanContext); ok {
+		return sc.TraceID(), sc.SpanID()
+	}
+	var traceID trace.TraceID
+	_, _ = rand.Read(traceID[:])
+	return traceID, newSpanID()
+}
+
+func (planIDGenerator) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	return newSpanID()
+}
+
+func newSpanID() trace.SpanID {
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+	return spanID
+}
+
+// planStartedAt is the earliest step timestamp of a plan, step 1 is only
+// finished when the workload was at its replicas. It is zero before the plan
+// started.
+func planStartedAt(scaleAnnotation *ScaleAnnotation) time.Time {
+	var startedAt time.Time
+	for _, step := range scaleAnnotation.Steps {
+		for _, t := range []*time.Time{step.StartedAt, step.FinishedAt} {
+			if t != nil && (startedAt.IsZero() || t.Before(startedAt)) {
+				startedAt = *t
+			}
+		}
+	}
+	return startedAt
+}
+
+// planSpanContext is the root span of the trace of a plan, derived from the
+// workload and the plan start so that every controller replica and restart
+// parents the step spans to the same span.
+func planSpanContext(workload *Workload, startedAt time.Time) trace.SpanContext {
+	sum := sha256.Sum256([]byte(string(workload.Object.GetUID()) + "/" + startedAt.UTC().Format(time.RFC3339Nano)))
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	copy(traceID[:], sum[:16])
+	copy(spanID[:], sum[16:24])
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+}
+
+func (r *DeploymentReconciler) tracer() trace.Tracer {
+	if r.tracerProvider == nil {
+		return otel.GetTracerProvider().Tracer(tracerName)
+	}
+	return r.tracerProvider.Tracer(tracerName)
+}
+
+// endSpan ends span with the status of err.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func workloadAttributes(workload *Workload) []attribute.KeyValue {
+	obj := workload.Object
+	return []attribute.KeyValue{
+		attribute.String("k8s.namespace.name", obj.GetNamespace()),
+		attribute.String("annotationscale.workload", obj.GetName()),
+		attribute.String("annotationscale.workload.uid", string(obj.GetUID())),
+	}
+}
+
+// tracePlan records the change of the plan of workload from before to after
+// on the reconcile span and in the trace of the plan: a span per finished or
+// failed step, and the root span once the plan completed or was aborted.
+func (r *DeploymentReconciler) tracePlan(ctx context.Context, workload *Workload, before stepSnapshot, after *ScaleAnnotation) {
+	reconcileSpan := trace.SpanFromContext(ctx)
+	reconcileSpan.SetAttributes(
+		attribute.Int("annotationscale.step", after.CurrentStepIndex),
+		attribute.String("annotationscale.state", string(after.CurrentStepState)),
+		attribute.Int("annotationscale.replicas", int(workload.Replicas)),
+		attribute.String("annotationscale.plan.id", after.ID),
+	)
+	transitioned := before.index != after.CurrentStepIndex || before.state != after.CurrentStepState
+	if transitioned {
+		reconcileSpan.AddEvent("transition", trace.WithAttributes(
+			attribute.Int("annotationscale.from.step", before.index),
+			attribute.String("annotationscale.from.state", string(before.state)),
+		))
+	}
+	startedAt := planStartedAt(after)
+	if startedAt.IsZero() {
+		return
+	}
+	plan := planSpanContext(workload, startedAt)
+	link := trace.LinkFromContext(ctx)
+	planCtx := trace.ContextWithRemoteSpanContext(ctx, plan)
+	tracer := r.tracer()
+
+	if before.index >= 1 && before.index <= len(after.Steps) {
+		step := after.Steps[before.index-1]
+		failed := transitioned && (after.CurrentStepState == StepStateTimeout || after.CurrentStepState == StepStateError)
+		if (!before.finished && step.FinishedAt != nil) || failed {
+			end := r.now()
+			if step.FinishedAt != nil && !failed {
+				end = *step.FinishedAt
+			}
+			start := end
+			if step.StartedAt != nil {
+				start = *step.StartedAt
+			}
+			_, span := tracer.Start(planCtx, "Step", trace.WithTimestamp(start), trace.WithLinks(link),
+				trace.WithAttributes(
+					attribute.Int("annotationscale.step", before.index),
+					attribute.Int("annotationscale.replicas", int(after.StepReplicas(before.index))),
+					attribute.Bool("annotationscale.pause", step.Pause),
+				))
+			if failed {
+				span.SetStatus(codes.Error, after.Message)
+			}
+			span.End(trace.WithTimestamp(end))
+		}
+	}
+
+	if !transitioned || (after.CurrentStepState != StepStateCompleted && after.CurrentStepState != StepStateAborted) {
+		return
+	}
+	_, span := tracer.Start(context.WithValue(ctx, planSpanKey{}, plan), "Plan",
+		trace.WithNewRoot(), trace.WithTimestamp(startedAt), trace.WithLinks(link),
+		trace.WithAttributes(append(workloadAttributes(workload),
+			attribute.Int("annotationscale.steps", len(after.Steps)),
+			attribute.String("annotationscale.plan.id", after.ID),
+			attribute.String("annotationscale.outcome", string(after.CurrentStepState)),
+		)...))
+	if after.CurrentStepState == StepStateAborted {
+		span.SetStatus(codes.Error, after.Message)
+	}
+	span.End(trace.WithTimestamp(after.LastUpdateTime))
+}
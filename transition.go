@@ -0,0 +1,226 @@
+package annotationscale
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// TransitionKind is what NextTransition decides to do with a plan.
+type TransitionKind string
+
+const (
+	// TransitionNone leaves the plan and the workload as they are.
+	TransitionNone TransitionKind = "None"
+	// TransitionFixReplicas scales the workload back to the current step.
+	TransitionFixReplicas TransitionKind = "FixReplicas"
+	// TransitionUnpause clears spec.paused.
+	TransitionUnpause TransitionKind = "Unpause"
+	// TransitionWaitRollout waits for the workload to create its replicas.
+	TransitionWaitRollout TransitionKind = "WaitRollout"
+	// TransitionRestartHold restarts the hold of a step that became
+	// unavailable while held.
+	TransitionRestartHold TransitionKind = "RestartHold"
+	// TransitionWaitAvailable waits for the step to be available until its
+	// deadline.
+	TransitionWaitAvailable TransitionKind = "WaitAvailable"
+	// TransitionFinishStep finishes the current step: StepUpgrade moves to
+	// StepReady or Completed, StepPaused pauses the workload.
+	TransitionFinishStep TransitionKind = "FinishStep"
+	// TransitionTimeout moves the plan to Timeout.
+	TransitionTimeout TransitionKind = "Timeout"
+	// TransitionComplete completes a plan ready at its last step.
+	TransitionComplete TransitionKind = "Complete"
+	// TransitionAdvance scales the workload to the next step.
+	TransitionAdvance TransitionKind = "Advance"
+	// TransitionPauseWorkload pauses the workload of a failed plan.
+	TransitionPauseWorkload TransitionKind = "PauseWorkload"
+)
+
+// Transition is the decision of NextTransition. State, StepIndex, Replicas
+// and Paused are the plan and workload after the transition is applied.
+type Transition struct {
+	Kind      TransitionKind
+	State     StepState
+	StepIndex int
+	Replicas  int32
+	Paused    bool
+	// Available is set when the workload has all replicas of the step
+	// available, the step's gates still have to pass before it finishes.
+	Available bool
+	Reason    string
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%s: %s", t.Kind, t.Reason)
+}
+
+// NextTransition decides the next transition of plan for workload at now,
+// from the plan and the workload's replicas, paused and status only. It
+// has no side effects: gates such as probes, analyses, holds, jobs, blackout
+// windows and budgets are run by the reconciler before it applies the
+// transition.
+func NextTransition(plan *ScaleAnnotation, workload *Workload, now time.Time) Transition {
+	index := plan.CurrentStepIndex
+	t := Transition{
+		Kind:      TransitionNone,
+		State:     plan.CurrentStepState,
+		StepIndex: index,
+		Replicas:  workload.Replicas,
+		Paused:    workload.Paused,
+	}
+	if index < 1 || index > len(plan.Steps) {
+		t.Reason = fmt.Sprintf("current step index %d out of range", index)
+		return t
+	}
+	switch plan.CurrentStepState {
+	case StepStateAborted:
+		t.Reason = "plan aborted"
+		return t
+	case StepStateCompleted:
+		if plan.HandedOff {
+			t.Reason = "plan completed and handed off"
+			return t
+		}
+	case StepStateUpgrade, StepStatePaused, StepStateReady, StepStateTimeout, StepStateError:
+	default:
+		t.Reason = fmt.Sprintf("unknown state %s", plan.CurrentStepState)
+		return t
+	}
+
+	if stepReplicas := plan.StepReplicas(index); workload.Replicas != stepReplicas {
+		t.Kind = TransitionFixReplicas
+		t.Replicas = stepReplicas
+		t.State = StepStateUpgrade
+		if plan.Steps[index-1].Pause {
+			t.State = StepStatePaused
+		}
+		t.Reason = fmt.Sprintf("replicas %d differ from step %d replicas %d", workload.Replicas, index, stepReplicas)
+		return t
+	}
+
+	lastStep := index == len(plan.Steps)
+	switch plan.CurrentStepState {
+	case StepStateCompleted:
+		t.Reason = "plan completed"
+		return t
+
+	case StepStateTimeout, StepStateError:
+		t.Kind = TransitionPauseWorkload
+		t.Paused = true
+		t.Reason = fmt.Sprintf("plan in %s", plan.CurrentStepState)
+		return t
+
+	case StepStateReady:
+		if workload.Paused {
+			t.Kind = TransitionUnpause
+			t.Paused = false
+			t.Reason = "spec.paused must be false in StepReady"
+			return t
+		}
+		if lastStep {
+			t.Kind = TransitionComplete
+			t.State = StepStateCompleted
+			t.Reason = "last step ready"
+			return t
+		}
+		t.Kind = TransitionAdvance
+		t.StepIndex = index + 1
+		t.Replicas = plan.StepReplicas(index + 1)
+		t.State = StepStateUpgrade
+		if plan.Steps[index].Pause {
+			t.State = StepStatePaused
+		}
+		t.Reason = fmt.Sprintf("step %d ready", index)
+		return t
+	}
+
+	// StepUpgrade and StepPaused wait for the step to be available
+	upgrade := plan.CurrentStepState == StepStateUpgrade
+	if upgrade && workload.Paused {
+		t.Kind = TransitionUnpause
+		t.Paused = false
+		t.Reason = "spec.paused must be false in StepUpgrade"
+		return t
+	}
+	status := workload.Status
+	if status.Replicas != workload.Replicas && status.ProgressDeadlineExceeded {
+		t.Kind = TransitionTimeout
+		t.State = StepStateTimeout
+		t.Reason = fmt.Sprintf("progress deadline exceeded with %d out of %d replicas", status.Replicas, workload.Replicas)
+		return t
+	}
+	if status.Replicas != workload.Replicas {
+		t.Kind = TransitionWaitRollout
+		t.Reason = fmt.Sprintf("waiting for rollout to finish: %d out of %d new replicas have been updated", status.Replicas, workload.Replicas)
+		return t
+	}
+	pauseFinished := !upgrade && (workload.Paused || !workload.SupportsPause) && plan.Steps[index-1].FinishedAt != nil
+	if status.TerminatingReplicas > 0 && status.Replicas == status.AvailableReplicas && !pauseFinished {
+		// pods stuck terminating do not hold the step beyond its deadline
+		if deadline := plan.StepDeadline(); now.Before(deadline) {
+			t.Kind = TransitionWaitAvailable
+			t.Reason = fmt.Sprintf("%d pods terminating, deadline %s", status.TerminatingReplicas, deadline.Format(time.RFC3339))
+			return t
+		}
+	}
+	if status.Replicas == status.AvailableReplicas {
+		if pauseFinished {
+			t.Reason = "paused at the step"
+			return t
+		}
+		t.Available = true
+		return finishedStep(t, upgrade, lastStep, fmt.Sprintf("step %d available", index))
+	}
+	if upgrade && !plan.StepAvailableTime.IsZero() {
+		t.Kind = TransitionRestartHold
+		t.Reason = "step became unavailable while holding"
+		return t
+	}
+	// a workload past its progress deadline will not become available
+	passed := "deadline passed"
+	if status.ProgressDeadlineExceeded {
+		passed = "progress deadline exceeded"
+	} else if deadline := plan.StepDeadline(); now.Before(deadline) {
+		t.Kind = TransitionWaitAvailable
+		t.Reason = fmt.Sprintf("%d of %d replicas available, deadline %s", status.AvailableReplicas, status.Replicas, deadline.Format(time.RFC3339))
+		return t
+	}
+	if status.UnavailableReplicas > int32(plan.MaxUnavailableReplicas) {
+		t.Kind = TransitionTimeout
+		t.State = StepStateTimeout
+		t.Reason = fmt.Sprintf("%s with %d unavailable replicas, more than %d", passed, status.UnavailableReplicas, plan.MaxUnavailableReplicas)
+		return t
+	}
+	if pauseFinished {
+		t.Reason = "paused at the step"
+		return t
+	}
+	// at the deadline, few enough unavailable replicas count as available
+	return finishedStep(t, upgrade, lastStep, fmt.Sprintf("%s with %d unavailable replicas, at most %d", passed, status.UnavailableReplicas, plan.MaxUnavailableReplicas))
+}
+
+func finishedStep(t Transition, upgrade, lastStep bool, reason string) Transition {
+	t.Kind = TransitionFinishStep
+	t.Reason = reason
+	switch {
+	case !upgrade:
+		t.Paused = true
+	case lastStep:
+		t.State = StepStateCompleted
+	default:
+		t.State = StepStateReady
+	}
+	return t
+}
+
+// DeploymentNextTransition is NextTransition for the plan of deployment, e.g.
+// for a dry-run of the next reconcile.
+func DeploymentNextTransition(deployment *appsv1.Deployment, now time.Time) (Transition, error) {
+	scaleAnnotation, err := ReadScaleAnnotation(deployment.Annotations)
+	if err != nil {
+		return Transition{}, err
+	}
+	return NextTransition(scaleAnnotation, newDeploymentWorkload(deployment), now), nil
+}
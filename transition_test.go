@@ -0,0 +1,191 @@
+package annotationscale
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextTransition(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	finished := start.Add(-time.Minute)
+	steps := func() []Step {
+		return []Step{{Replicas: 2}, {Replicas: 4}, {Replicas: 6}}
+	}
+	tests := []struct {
+		name     string
+		plan     ScaleAnnotation
+		workload Workload
+		after    time.Duration
+		want     Transition
+	}{
+		{
+			name:     "ready step advances",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 1, CurrentStepState: StepStateReady},
+			workload: Workload{Replicas: 2, SupportsPause: true},
+			want:     Transition{Kind: TransitionAdvance, State: StepStateUpgrade, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name: "ready step advances to a pause step",
+			plan: ScaleAnnotation{
+				Steps: []Step{{Replicas: 2}, {Replicas: 4, Pause: true}}, CurrentStepIndex: 1, CurrentStepState: StepStateReady,
+			},
+			workload: Workload{Replicas: 2, SupportsPause: true},
+			want:     Transition{Kind: TransitionAdvance, State: StepStatePaused, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name:     "ready last step completes",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 3, CurrentStepState: StepStateReady},
+			workload: Workload{Replicas: 6, SupportsPause: true},
+			want:     Transition{Kind: TransitionComplete, State: StepStateCompleted, StepIndex: 3, Replicas: 6},
+		},
+		{
+			name:     "ready step unpauses first",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 1, CurrentStepState: StepStateReady},
+			workload: Workload{Replicas: 2, Paused: true, SupportsPause: true},
+			want:     Transition{Kind: TransitionUnpause, State: StepStateReady, StepIndex: 1, Replicas: 2},
+		},
+		{
+			name:     "replicas of another step are fixed",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateReady},
+			workload: Workload{Replicas: 3, SupportsPause: true},
+			want:     Transition{Kind: TransitionFixReplicas, State: StepStateUpgrade, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name:     "available step finishes",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 4}},
+			want:     Transition{Kind: TransitionFinishStep, State: StepStateReady, StepIndex: 2, Replicas: 4, Available: true},
+		},
+		{
+			name:     "available last step completes",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 3, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60},
+			workload: Workload{Replicas: 6, SupportsPause: true, Status: WorkloadStatus{Replicas: 6, AvailableReplicas: 6}},
+			want:     Transition{Kind: TransitionFinishStep, State: StepStateCompleted, StepIndex: 3, Replicas: 6, Available: true},
+		},
+		{
+			name:     "rollout is waited for",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{Replicas: 2, AvailableReplicas: 2}},
+			want:     Transition{Kind: TransitionWaitRollout, State: StepStateUpgrade, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name:     "unavailable step waits until the deadline",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 3, UnavailableReplicas: 1}},
+			after:    59 * time.Second,
+			want:     Transition{Kind: TransitionWaitAvailable, State: StepStateUpgrade, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name:     "unavailable step times out after MaxWaitAvailableSecond",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 3, UnavailableReplicas: 1}},
+			after:    61 * time.Second,
+			want:     Transition{Kind: TransitionTimeout, State: StepStateTimeout, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name: "step MaxWaitAvailableSecond overrides the plan",
+			plan: ScaleAnnotation{
+				Steps: []Step{{Replicas: 2}, {Replicas: 4, MaxWaitAvailableSecond: 30}}, CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 600,
+			},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 3, UnavailableReplicas: 1}},
+			after:    31 * time.Second,
+			want:     Transition{Kind: TransitionTimeout, State: StepStateTimeout, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name: "unavailable replicas within MaxUnavailableReplicas finish at the deadline",
+			plan: ScaleAnnotation{
+				Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60, MaxUnavailableReplicas: 1,
+			},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 3, UnavailableReplicas: 1}},
+			after:    61 * time.Second,
+			want:     Transition{Kind: TransitionFinishStep, State: StepStateReady, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name: "progress deadline exceeded during the rollout times out",
+			plan: ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 600},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{
+				Replicas: 3, AvailableReplicas: 2, UnavailableReplicas: 1, ProgressDeadlineExceeded: true,
+			}},
+			want: Transition{Kind: TransitionTimeout, State: StepStateTimeout, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name: "progress deadline exceeded times out before the step deadline",
+			plan: ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 600},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{
+				Replicas: 4, AvailableReplicas: 3, UnavailableReplicas: 1, ProgressDeadlineExceeded: true,
+			}},
+			want: Transition{Kind: TransitionTimeout, State: StepStateTimeout, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name: "available pause step pauses the workload",
+			plan: ScaleAnnotation{
+				Steps: []Step{{Replicas: 2}, {Replicas: 4, Pause: true}}, CurrentStepIndex: 2, CurrentStepState: StepStatePaused, MaxWaitAvailableSecond: 60,
+			},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 4}},
+			want:     Transition{Kind: TransitionFinishStep, State: StepStatePaused, StepIndex: 2, Replicas: 4, Paused: true, Available: true},
+		},
+		{
+			name: "finished pause step stays paused",
+			plan: ScaleAnnotation{
+				Steps: []Step{{Replicas: 2}, {Replicas: 4, Pause: true, FinishedAt: &finished}}, CurrentStepIndex: 2, CurrentStepState: StepStatePaused, MaxWaitAvailableSecond: 60,
+			},
+			workload: Workload{Replicas: 4, Paused: true, SupportsPause: true, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 4}},
+			after:    time.Hour,
+			want:     Transition{Kind: TransitionNone, State: StepStatePaused, StepIndex: 2, Replicas: 4, Paused: true},
+		},
+		{
+			name: "finished pause step of a workload without spec.paused stays paused",
+			plan: ScaleAnnotation{
+				Steps: []Step{{Replicas: 2}, {Replicas: 4, Pause: true, FinishedAt: &finished}}, CurrentStepIndex: 2, CurrentStepState: StepStatePaused, MaxWaitAvailableSecond: 60,
+			},
+			workload: Workload{Replicas: 4, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 4}},
+			want:     Transition{Kind: TransitionNone, State: StepStatePaused, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name: "terminating pods are waited for until the deadline",
+			plan: ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{
+				Replicas: 4, AvailableReplicas: 4, TerminatingReplicas: 1,
+			}},
+			after: 59 * time.Second,
+			want:  Transition{Kind: TransitionWaitAvailable, State: StepStateUpgrade, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name: "terminating pods do not hold the step beyond the deadline",
+			plan: ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{
+				Replicas: 4, AvailableReplicas: 4, TerminatingReplicas: 1,
+			}},
+			after: 61 * time.Second,
+			want:  Transition{Kind: TransitionFinishStep, State: StepStateReady, StepIndex: 2, Replicas: 4, Available: true},
+		},
+		{
+			name:     "held step that became unavailable restarts the hold",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateUpgrade, MaxWaitAvailableSecond: 60, StepAvailableTime: start},
+			workload: Workload{Replicas: 4, SupportsPause: true, Status: WorkloadStatus{Replicas: 4, AvailableReplicas: 3, UnavailableReplicas: 1}},
+			want:     Transition{Kind: TransitionRestartHold, State: StepStateUpgrade, StepIndex: 2, Replicas: 4},
+		},
+		{
+			name:     "timed out plan pauses the workload",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateTimeout},
+			workload: Workload{Replicas: 4, SupportsPause: true},
+			want:     Transition{Kind: TransitionPauseWorkload, State: StepStateTimeout, StepIndex: 2, Replicas: 4, Paused: true},
+		},
+		{
+			name:     "aborted plan is left alone",
+			plan:     ScaleAnnotation{Steps: steps(), CurrentStepIndex: 2, CurrentStepState: StepStateAborted},
+			workload: Workload{Replicas: 3, SupportsPause: true},
+			want:     Transition{Kind: TransitionNone, State: StepStateAborted, StepIndex: 2, Replicas: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.plan.LastUpdateTime = start
+			got := NextTransition(&tt.plan, &tt.workload, start.Add(tt.after))
+			got.Reason = ""
+			if got != tt.want {
+				t.Errorf("NextTransition() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
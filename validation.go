@@ -0,0 +1,110 @@
+package annotationscale
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// maxPlanWaitSeconds bounds the waits of a plan, longer ones are taken as
+// typos such as milliseconds.
+const maxPlanWaitSeconds = 7 * 24 * 60 * 60
+
+var knownStepStates = []string{
+	string(StepStateUpgrade), string(StepStatePaused), string(StepStateReady),
+	string(StepStateCompleted), string(StepStateTimeout), string(StepStateError), string(StepStateAborted),
+}
+
+// ValidatePlan checks scaleAnnotation for mistakes the reconciler would
+// otherwise run into, e.g. empty steps, a current step out of range, zero
+// replicas before the last step, absurd waits or steps against Direction. The errors use the
+// annotation field names, ToAggregate joins them.
+func ValidatePlan(scaleAnnotation *ScaleAnnotation) field.ErrorList {
+	var errs field.ErrorList
+	if len(scaleAnnotation.Steps) == 0 {
+		errs = append(errs, field.Required(field.NewPath("steps"), "a plan needs at least one step"))
+	}
+	if index := scaleAnnotation.CurrentStepIndex; index < 1 || index > len(scaleAnnotation.Steps) {
+		errs = append(errs, field.Invalid(field.NewPath("current_step_index"), index, "must be a 1-based index of steps"))
+	}
+	if !isKnownStepState(scaleAnnotation.CurrentStepState) {
+		errs = append(errs, field.NotSupported(field.NewPath("current_step_state"), scaleAnnotation.CurrentStepState, knownStepStates))
+	}
+	errs = append(errs, validateWait(field.NewPath("max_wait_available_second"), scaleAnnotation.MaxWaitAvailableSecond)...)
+	if scaleAnnotation.MaxUnavailableReplicas < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("max_unavailable_replicas"), scaleAnnotation.MaxUnavailableReplicas, "must not be negative"))
+	}
+	if scaleAnnotation.TargetReplicas < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("target_replicas"), scaleAnnotation.TargetReplicas, "must not be negative"))
+	}
+
+	switch scaleAnnotation.Direction {
+	case "", DirectionAny, DirectionUp, DirectionDown:
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("direction"), scaleAnnotation.Direction,
+			[]string{string(DirectionUp), string(DirectionDown), string(DirectionAny)}))
+	}
+
+	stepsPath := field.NewPath("steps")
+	for i, step := range scaleAnnotation.Steps {
+		path := stepsPath.Index(i)
+		switch {
+		case step.Replicas < 0:
+			errs = append(errs, field.Invalid(path.Child("replicas"), step.Replicas, "must not be negative"))
+		case step.Replicas == 0 && step.Percent == 0 && i < len(scaleAnnotation.Steps)-1:
+			errs = append(errs, field.Invalid(path.Child("replicas"), step.Replicas, "only the last step may scale to 0"))
+		}
+		if step.Percent < 0 {
+			errs = append(errs, field.Invalid(path.Child("percent"), step.Percent, "must not be negative"))
+		} else if step.Percent > 0 && scaleAnnotation.TargetReplicas == 0 {
+			errs = append(errs, field.Required(field.NewPath("target_replicas"), "percent steps need target_replicas"))
+		}
+		if step.MaxWaitAvailableSecond != 0 {
+			errs = append(errs, validateWait(path.Child("max_wait_available_second"), step.MaxWaitAvailableSecond)...)
+		}
+		if step.HoldSeconds < 0 || step.HoldSeconds > maxPlanWaitSeconds {
+			errs = append(errs, field.Invalid(path.Child("hold_seconds"), step.HoldSeconds, "must be between 0 and 7 days"))
+		}
+		if step.MinReadySeconds != nil && (*step.MinReadySeconds < 0 || *step.MinReadySeconds > maxPlanWaitSeconds) {
+			errs = append(errs, field.Invalid(path.Child("min_ready_seconds"), *step.MinReadySeconds, "must be between 0 and 7 days"))
+		}
+		if len(step.Approvers) > 0 && !step.Pause {
+			errs = append(errs, field.Invalid(path.Child("approvers"), step.Approvers, "only pause steps are approved"))
+		}
+		if i > 0 {
+			previous, replicas := scaleAnnotation.StepReplicas(i), scaleAnnotation.StepReplicas(i+1)
+			if scaleAnnotation.Direction == DirectionUp && replicas < previous {
+				errs = append(errs, field.Invalid(path.Child("replicas"), replicas, fmt.Sprintf("scales down from %d in a plan with direction Up", previous)))
+			}
+			if scaleAnnotation.Direction == DirectionDown && replicas > previous {
+				errs = append(errs, field.Invalid(path.Child("replicas"), replicas, fmt.Sprintf("scales up from %d in a plan with direction Down", previous)))
+			}
+		}
+	}
+	return errs
+}
+
+func validateWait(path *field.Path, seconds int) field.ErrorList {
+	if seconds <= 0 || seconds > maxPlanWaitSeconds {
+		return field.ErrorList{field.Invalid(path, seconds, "must be between 1 second and 7 days")}
+	}
+	return nil
+}
+
+func isKnownStepState(state StepState) bool {
+	for _, known := range knownStepStates {
+		if string(state) == known {
+			return true
+		}
+	}
+	return false
+}
+
+// SetScaleAnnotationStrict is SetScaleAnnotation refusing plans ValidatePlan
+// rejects.
+func SetScaleAnnotationStrict(annotations map[string]string, scaleAnnotation *ScaleAnnotation) (map[string]string, error) {
+	if errs := ValidatePlan(scaleAnnotation); len(errs) > 0 {
+		return annotations, errs.ToAggregate()
+	}
+	return SetScaleAnnotation(annotations, scaleAnnotation)
+}
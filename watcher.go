@@ -0,0 +1,199 @@
+package annotationscale
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+type PlanEventType string
+
+const (
+	PlanEventStepAdvanced PlanEventType = "StepAdvanced"
+	// PlanEventPaused is sent when a pause step reached its replicas.
+	PlanEventPaused    PlanEventType = "Paused"
+	PlanEventCompleted PlanEventType = "Completed"
+	PlanEventTimeout   PlanEventType = "Timeout"
+	PlanEventError     PlanEventType = "Error"
+	PlanEventAborted   PlanEventType = "Aborted"
+)
+
+type PlanEvent struct {
+	Type       PlanEventType
+	Deployment types.NamespacedName
+	Step       int
+	TotalSteps int
+	State      StepState
+	Message    string
+	Time       time.Time
+}
+
+type PlanWatchOptions struct {
+	// Namespace to watch, all namespaces when empty.
+	Namespace string
+	// Name watches a single Deployment.
+	Name string
+	// Selector restricts the watched Deployments by label.
+	Selector labels.Selector
+	// ResyncPeriod of the informer, 0 disables resyncs.
+	ResyncPeriod time.Duration
+}
+
+// PlanWatcher delivers the plan transitions of the watched Deployments.
+// Plans found when the watch starts only serve as the baseline.
+type PlanWatcher struct {
+	clientset kubernetes.Interface
+	options   PlanWatchOptions
+
+	mutex sync.Mutex
+	plans map[types.NamespacedName]*ScaleAnnotation
+}
+
+func NewPlanWatcher(clientset kubernetes.Interface, opts PlanWatchOptions) *PlanWatcher {
+	return &PlanWatcher{
+		clientset: clientset,
+		options:   opts,
+		plans:     make(map[types.NamespacedName]*ScaleAnnotation),
+	}
+}
+
+// Watch starts the informer and returns the event channel, closed once ctx
+// is done.
+func (w *PlanWatcher) Watch(ctx context.Context) (<-chan PlanEvent, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(w.clientset, w.options.ResyncPeriod,
+		informers.WithNamespace(w.options.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			if w.options.Name != "" {
+				o.FieldSelector = fields.OneTermEqualSelector("metadata.name", w.options.Name).String()
+			}
+			if w.options.Selector != nil {
+				o.LabelSelector = w.options.Selector.String()
+			}
+		}))
+	informer := factory.Apps().V1().Deployments().Informer()
+
+	events := make(chan PlanEvent, 100)
+	// handlers may still run after ctx is done, closed guards the channel
+	var sendMutex sync.Mutex
+	closed := false
+	send := func(deployment *appsv1.Deployment) {
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+		for _, event := range w.observe(deployment) {
+			if closed {
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				send(deployment)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				send(deployment)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				w.mutex.Lock()
+				delete(w.plans, types.NamespacedName{Namespace: deployment.Namespace, Name: deployment.Name})
+				w.mutex.Unlock()
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, fmt.Errorf("plan watcher cache did not sync: %w", ctx.Err())
+	}
+	go func() {
+		<-ctx.Done()
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+		closed = true
+		close(events)
+	}()
+	return events, nil
+}
+
+// observe records the plan of deployment and returns the events for what
+// changed since it was last seen.
+func (w *PlanWatcher) observe(deployment *appsv1.Deployment) []PlanEvent {
+	key := types.NamespacedName{Namespace: deployment.Namespace, Name: deployment.Name}
+	current, err := ReadScaleAnnotation(deployment.Annotations)
+	if err != nil {
+		return nil
+	}
+	w.mutex.Lock()
+	previous, seen := w.plans[key]
+	w.plans[key] = current
+	w.mutex.Unlock()
+	if !seen {
+		return nil
+	}
+	return planEvents(key, previous, current)
+}
+
+func planEvents(key types.NamespacedName, previous, current *ScaleAnnotation) []PlanEvent {
+	newEvent := func(eventType PlanEventType) PlanEvent {
+		return PlanEvent{
+			Type:       eventType,
+			Deployment: key,
+			Step:       current.CurrentStepIndex,
+			TotalSteps: len(current.Steps),
+			State:      current.CurrentStepState,
+			Message:    current.Message,
+			Time:       current.LastUpdateTime,
+		}
+	}
+	var events []PlanEvent
+	if current.CurrentStepIndex > previous.CurrentStepIndex {
+		events = append(events, newEvent(PlanEventStepAdvanced))
+	}
+	if current.CurrentStepState == StepStatePaused && pauseReached(current) &&
+		!(previous.CurrentStepIndex == current.CurrentStepIndex && previous.CurrentStepState == StepStatePaused && pauseReached(previous)) {
+		events = append(events, newEvent(PlanEventPaused))
+	}
+	if current.CurrentStepState != previous.CurrentStepState || current.CurrentStepIndex != previous.CurrentStepIndex {
+		switch current.CurrentStepState {
+		case StepStateCompleted:
+			events = append(events, newEvent(PlanEventCompleted))
+		case StepStateTimeout:
+			events = append(events, newEvent(PlanEventTimeout))
+		case StepStateError:
+			events = append(events, newEvent(PlanEventError))
+		case StepStateAborted:
+			events = append(events, newEvent(PlanEventAborted))
+		}
+	}
+	return events
+}
+
+func pauseReached(scaleAnnotation *ScaleAnnotation) bool {
+	index := scaleAnnotation.CurrentStepIndex
+	return index >= 1 && index <= len(scaleAnnotation.Steps) && scaleAnnotation.Steps[index-1].FinishedAt != nil
+}
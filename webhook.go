@@ -0,0 +1,188 @@
+package annotationscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// DefaultingWebhookPath is where the plan defaulting webhook is served, see
+// config/webhook for a matching MutatingWebhookConfiguration.
+const DefaultingWebhookPath = "/mutate-annotationscale"
+
+// DefaultScaleAnnotation fills in the plan fields a user left out when only
+// steps were applied: current_step_index starts at 1, current_step_state at
+// StepReady, and the remaining fields take the NewScaleAnnotation defaults.
+// Annotations without steps are returned unchanged.
+func DefaultScaleAnnotation(annotations map[string]string) (map[string]string, error) {
+	if planJSON, ok := annotations[PlanAnnotationKey]; ok {
+		scaleAnnotation := NewScaleAnnotation()
+		if err := json.Unmarshal([]byte(planJSON), &scaleAnnotation); err != nil {
+			return annotations, err
+		}
+		if len(scaleAnnotation.Steps) == 0 {
+			return annotations, nil
+		}
+		defaultStep(&scaleAnnotation)
+		return SetScaleAnnotationJSON(copyAnnotations(annotations), &scaleAnnotation)
+	}
+
+	if _, ok := annotations["steps"]; !ok {
+		return annotations, nil
+	}
+	fixed := copyAnnotations(annotations)
+	if _, ok := fixed["current_step_index"]; !ok {
+		fixed["current_step_index"] = "1"
+	}
+	if _, ok := fixed["current_step_state"]; !ok {
+		fixed["current_step_state"] = string(StepStateReady)
+	}
+	scaleAnnotation, err := ReadScaleAnnotation(fixed)
+	if err != nil {
+		return annotations, err
+	}
+	return SetScaleAnnotation(fixed, scaleAnnotation)
+}
+
+func defaultStep(scaleAnnotation *ScaleAnnotation) {
+	if scaleAnnotation.CurrentStepIndex == 0 {
+		scaleAnnotation.CurrentStepIndex = 1
+	}
+	if scaleAnnotation.CurrentStepState == "" {
+		scaleAnnotation.CurrentStepState = StepStateReady
+	}
+}
+
+func copyAnnotations(annotations map[string]string) map[string]string {
+	copied := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		copied[key] = value
+	}
+	return copied
+}
+
+// planDefaulter is a mutating admission handler applying
+// DefaultScaleAnnotation to any object carrying a plan, and denying plans
+// ValidatePlan rejects.
+type planDefaulter struct {
+	log *logr.Logger
+	// clock stamps the transitions recorded for users, the wall clock by
+	// default.
+	clock Clock
+}
+
+func (d *planDefaulter) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock.Now()
+}
+
+func (d *planDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	annotations := obj.GetAnnotations()
+	fixed, err := DefaultScaleAnnotation(annotations)
+	if err != nil {
+		// a plan the reconciler cannot read either, let it through and let
+		// the reconciler report it
+		d.log.V(2).Info("skip defaulting", "object", req.Name, "error", err)
+		return admission.Allowed("")
+	}
+	if errs := d.validate(req, fixed); len(errs) > 0 {
+		d.log.V(2).Info("deny invalid plan", "object", req.Name, "namespace", req.Namespace, "error", errs.ToAggregate())
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+	fixed, denied := recordApprover(req, fixed)
+	if denied != "" {
+		d.log.V(2).Info("deny approval", "object", req.Name, "namespace", req.Namespace, "reason", denied)
+		return admission.Denied(denied)
+	}
+	fixed = recordActor(req, fixed, d.now())
+	if reflect.DeepEqual(fixed, annotations) {
+		return admission.Allowed("")
+	}
+	d.log.V(2).Info("default scale annotation", "object", req.Name, "namespace", req.Namespace)
+	obj.SetAnnotations(fixed)
+	marshaled, err := obj.MarshalJSON()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// validate runs ValidatePlan on plans changed by req, so that objects already
+// carrying an invalid plan can still be updated otherwise.
+func (d *planDefaulter) validate(req admission.Request, annotations map[string]string) field.ErrorList {
+	if _, ok := annotations["steps"]; !ok {
+		if _, ok := annotations[PlanAnnotationKey]; !ok {
+			return nil
+		}
+	}
+	if len(req.OldObject.Raw) > 0 {
+		old := &unstructured.Unstructured{}
+		if err := old.UnmarshalJSON(req.OldObject.Raw); err == nil && !scaleAnnotationsChanged(old.GetAnnotations(), annotations) {
+			return nil
+		}
+	}
+	scaleAnnotation, err := ReadScaleAnnotation(annotations)
+	if err != nil {
+		return nil
+	}
+	return ValidatePlan(scaleAnnotation)
+}
+
+// recordApprover sets ApprovedByAnnotationKey to the user of req when req
+// approves a step, or approves it again without ApprovedByAnnotationKey, and
+// keeps it from being written otherwise. It goes when ApproveStepAnnotationKey
+// is removed. It returns why the approval is denied, if so.
+func recordApprover(req admission.Request, annotations map[string]string) (map[string]string, string) {
+	var before map[string]string
+	if len(req.OldObject.Raw) > 0 {
+		old := &unstructured.Unstructured{}
+		if err := old.UnmarshalJSON(req.OldObject.Raw); err == nil {
+			before = old.GetAnnotations()
+		}
+	}
+	approveStep, approving := annotations[ApproveStepAnnotationKey]
+	if annotations[ApproveStepAnnotationKey] == before[ApproveStepAnnotationKey] &&
+		annotations[ApprovedByAnnotationKey] == before[ApprovedByAnnotationKey] {
+		return annotations, ""
+	}
+	fixed := copyAnnotations(annotations)
+	if _, approved := before[ApproveStepAnnotationKey]; approved && !approving {
+		delete(fixed, ApprovedByAnnotationKey)
+		return fixed, ""
+	}
+	_, hadApprover := before[ApprovedByAnnotationKey]
+	_, hasApprover := annotations[ApprovedByAnnotationKey]
+	reapproving := approving && hadApprover && !hasApprover
+	if !approving || (approveStep == before[ApproveStepAnnotationKey] && !reapproving) {
+		// only the webhook records approvers
+		if approvedBy, ok := before[ApprovedByAnnotationKey]; ok {
+			fixed[ApprovedByAnnotationKey] = approvedBy
+		} else {
+			delete(fixed, ApprovedByAnnotationKey)
+		}
+		return fixed, ""
+	}
+	fixed[ApprovedByAnnotationKey] = req.UserInfo.Username
+	if scaleAnnotation, err := ReadScaleAnnotation(fixed); err == nil &&
+		scaleAnnotation.CurrentStepIndex >= 1 && scaleAnnotation.CurrentStepIndex <= len(scaleAnnotation.Steps) {
+		if _, ok := approver(fixed, scaleAnnotation); !ok && approveStep == strconv.Itoa(scaleAnnotation.CurrentStepIndex) {
+			return annotations, fmt.Sprintf("%s may not approve step %s", req.UserInfo.Username, approveStep)
+		}
+	}
+	return fixed, ""
+}
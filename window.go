@@ -0,0 +1,104 @@
+package annotationscale
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a recurring daily time window, e.g. a deploy freeze. Start and
+// End are "15:04" clock times in Timezone (UTC by default); an End before
+// Start spans midnight. Days limits the window to the given weekdays ("Mon",
+// "Tuesday", ...) counted from the window start, every day when empty.
+type Window struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Days     []string `json:"days,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%s-%s %s %v", w.Start, w.End, w.Timezone, w.Days)
+}
+
+// Contains reports whether t falls inside the window.
+func (w Window) Contains(t time.Time) (bool, error) {
+	location := time.UTC
+	if w.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(w.Timezone)
+		if err != nil {
+			return false, err
+		}
+	}
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return false, fmt.Errorf("window start: %w", err)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return false, fmt.Errorf("window end: %w", err)
+	}
+
+	t = t.In(location)
+	// check the window starting today and the one starting yesterday, which
+	// may still be open after midnight
+	for _, dayOffset := range []int{0, -1} {
+		day := t.AddDate(0, 0, dayOffset)
+		windowStart := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, location)
+		windowEnd := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, location)
+		if !windowEnd.After(windowStart) {
+			windowEnd = windowEnd.AddDate(0, 0, 1)
+		}
+		if t.Before(windowStart) || !t.Before(windowEnd) {
+			continue
+		}
+		matched, err := w.matchDay(windowStart.Weekday())
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+func (w Window) matchDay(weekday time.Weekday) (bool, error) {
+	if len(w.Days) == 0 {
+		return true, nil
+	}
+	for _, day := range w.Days {
+		d, err := parseWeekday(day)
+		if err != nil {
+			return false, err
+		}
+		if d == weekday {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func parseWeekday(day string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := d.String()
+		if strings.EqualFold(day, name) || strings.EqualFold(day, name[:3]) {
+			return d, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown weekday %q", day)
+}
+
+// activeWindow returns the first window containing t, if any.
+func activeWindow(t time.Time, windowLists ...[]Window) (*Window, error) {
+	for _, windows := range windowLists {
+		for i := range windows {
+			contains, err := windows[i].Contains(t)
+			if err != nil {
+				return nil, err
+			}
+			if contains {
+				return &windows[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,293 @@
+package annotationscale
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Workload is the view of a scalable object the reconciler drives. Replicas
+// and Paused are the desired values; they are written back by Patch.
+type Workload struct {
+	Object        client.Object
+	Replicas      int32
+	Paused        bool
+	SupportsPause bool
+	Status        WorkloadStatus
+	// Selector matches the pods of the workload, nil when unknown.
+	Selector labels.Selector
+	// MinReadySeconds is the desired spec.minReadySeconds of Deployments,
+	// nil for the other kinds.
+	MinReadySeconds *int32
+
+	client workloadClient
+	// planID is the ID of the plan being reconciled, for its Events.
+	planID string
+}
+
+type WorkloadStatus struct {
+	Replicas            int32
+	AvailableReplicas   int32
+	UnavailableReplicas int32
+	ReadyReplicas       int32
+	UpdatedReplicas     int32
+	// RolloutInProgress is set while pods of an older template remain, e.g.
+	// after an image update. Only Deployments report it.
+	RolloutInProgress bool
+	// ProgressDeadlineExceeded is set once the workload made no progress for
+	// its progressDeadlineSeconds, as reported by Deployments and Rollouts.
+	ProgressDeadlineExceeded bool
+	// TerminatingReplicas counts the pods of the workload being deleted, only
+	// with ReconcilerOptions.WaitForTerminatingPods.
+	TerminatingReplicas int32
+}
+
+type workloadClient interface {
+	Get(ctx context.Context, key types.NamespacedName) (*Workload, error)
+	Patch(ctx context.Context, workload *Workload) error
+}
+
+type deploymentClient struct {
+	client client.Client
+}
+
+func newDeploymentWorkload(deployment *appsv1.Deployment) *Workload {
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		selector = nil
+	}
+	minReadySeconds := deployment.Spec.MinReadySeconds
+	return &Workload{
+		Object:          deployment,
+		Selector:        selector,
+		MinReadySeconds: &minReadySeconds,
+		Replicas:        replicas,
+		Paused:          deployment.Spec.Paused,
+		SupportsPause:   true,
+		Status: WorkloadStatus{
+			Replicas:            deployment.Status.Replicas,
+			AvailableReplicas:   deployment.Status.AvailableReplicas,
+			UnavailableReplicas: deployment.Status.UnavailableReplicas,
+			ReadyReplicas:       deployment.Status.ReadyReplicas,
+			UpdatedReplicas:     deployment.Status.UpdatedReplicas,
+			// a status of an older generation may predate the update
+			RolloutInProgress: deployment.Status.ObservedGeneration == deployment.Generation &&
+				deployment.Status.UpdatedReplicas < deployment.Status.Replicas,
+			ProgressDeadlineExceeded: deploymentProgressDeadlineExceeded(deployment),
+		},
+	}
+}
+
+// deploymentProgressDeadlineExceeded reports the Progressing=False condition
+// the deployment controller sets after progressDeadlineSeconds. A condition
+// of an older generation may predate the last patch, e.g. of a stuck rollout
+// before the step.
+func deploymentProgressDeadlineExceeded(deployment *appsv1.Deployment) bool {
+	if deployment.Status.ObservedGeneration != deployment.Generation {
+		return false
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing {
+			return condition.Status == corev1.ConditionFalse && condition.Reason == progressDeadlineExceededReason
+		}
+	}
+	return false
+}
+
+// progressDeadlineExceededReason is the reason of the Progressing condition
+// of Deployments and Rollouts past their progress deadline.
+const progressDeadlineExceededReason = "ProgressDeadlineExceeded"
+
+func (c *deploymentClient) Get(ctx context.Context, key types.NamespacedName) (*Workload, error) {
+	deployment := &appsv1.Deployment{}
+	if err := c.client.Get(ctx, key, deployment); err != nil {
+		return nil, err
+	}
+	workload := newDeploymentWorkload(deployment)
+	workload.client = c
+	return workload, nil
+}
+
+// Patch applies replicas, paused and the plan annotations with server-side
+// apply, other fields are left to their owners. minReadySeconds is only
+// applied when it must change or was applied before.
+func (c *deploymentClient) Patch(ctx context.Context, workload *Workload) error {
+	apply := applyObject(appsv1.SchemeGroupVersion.WithKind("Deployment"), workload)
+	if err := unstructured.SetNestedField(apply.Object, int64(workload.Replicas), "spec", "replicas"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(apply.Object, workload.Paused, "spec", "paused"); err != nil {
+		return err
+	}
+	if deployment, ok := workload.Object.(*appsv1.Deployment); ok && workload.MinReadySeconds != nil &&
+		(*workload.MinReadySeconds != deployment.Spec.MinReadySeconds || appliedField(deployment, "spec", "minReadySeconds")) {
+		if err := unstructured.SetNestedField(apply.Object, int64(*workload.MinReadySeconds), "spec", "minReadySeconds"); err != nil {
+			return err
+		}
+	}
+	return c.client.Patch(ctx, apply, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// FieldManager owns the fields the controller applies.
+const FieldManager = "annotationscale"
+
+// applyObject is the apply configuration of the plan annotations of workload.
+// Plan annotations the controller applied before and left out are removed.
+func applyObject(gvk schema.GroupVersionKind, workload *Workload) *unstructured.Unstructured {
+	apply := newUnstructured(gvk)
+	apply.SetNamespace(workload.Object.GetNamespace())
+	apply.SetName(workload.Object.GetName())
+	annotations := map[string]string{}
+	for key, value := range workload.Object.GetAnnotations() {
+		if isPlanAnnotation(key) {
+			annotations[key] = value
+		}
+	}
+	apply.SetAnnotations(annotations)
+	return apply
+}
+
+func isPlanAnnotation(key string) bool {
+	switch key {
+	case PlanAnnotationKey, HistoryAnnotationKey, ScheduleLastRunAnnotationKey, OriginalMinReadySecondsAnnotationKey:
+		return true
+	}
+	for _, legacyKey := range legacyAnnotationKeys {
+		if key == legacyKey {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleClient drives any resource implementing the scale subresource. The
+// object itself is read as unstructured for annotations and availability,
+// replicas are read and written through /scale.
+type scaleClient struct {
+	client   client.Client
+	scales   scale.ScalesGetter
+	gvk      schema.GroupVersionKind
+	resource schema.GroupResource
+	// cluster labels the conflicts counted by patchConflictsTotal.
+	cluster string
+}
+
+func (c *scaleClient) newObject() *unstructured.Unstructured {
+	return newUnstructured(c.gvk)
+}
+
+func (c *scaleClient) Get(ctx context.Context, key types.NamespacedName) (*Workload, error) {
+	obj := c.newObject()
+	if err := c.client.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	s, err := c.scales.Scales(key.Namespace).Get(ctx, c.resource, key.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	workload := newScaleWorkload(obj, s)
+	workload.client = c
+	return workload, nil
+}
+
+func newScaleWorkload(obj *unstructured.Unstructured, s *autoscalingv1.Scale) *Workload {
+	status := WorkloadStatus{Replicas: s.Status.Replicas}
+	if replicas, ok := nestedInt32(obj, "status", "replicas"); ok {
+		status.Replicas = replicas
+	}
+	if available, ok := nestedInt32(obj, "status", "availableReplicas"); ok {
+		status.AvailableReplicas = available
+	} else if ready, ok := nestedInt32(obj, "status", "readyReplicas"); ok {
+		status.AvailableReplicas = ready
+	}
+	if ready, ok := nestedInt32(obj, "status", "readyReplicas"); ok {
+		status.ReadyReplicas = ready
+	}
+	if updated, ok := nestedInt32(obj, "status", "updatedReplicas"); ok {
+		status.UpdatedReplicas = updated
+	}
+	if unavailable, ok := nestedInt32(obj, "status", "unavailableReplicas"); ok {
+		status.UnavailableReplicas = unavailable
+	} else if status.Replicas > status.AvailableReplicas {
+		status.UnavailableReplicas = status.Replicas - status.AvailableReplicas
+	}
+	selector, err := labels.Parse(s.Status.Selector)
+	if err != nil || s.Status.Selector == "" {
+		selector = nil
+	}
+	return &Workload{
+		Object:   obj,
+		Replicas: s.Spec.Replicas,
+		Status:   status,
+		Selector: selector,
+	}
+}
+
+// Patch scales the object before applying the plan annotations, so that a
+// failed write never leaves the plan at a step the object was not scaled to.
+// The scale update is skipped when the replicas are already set, a retry
+// applies the annotations only. The update carries the resourceVersion of the
+// scale read before it, so it is retried a few times when it conflicts with a
+// concurrent writer; the forced apply of the annotations cannot conflict.
+func (c *scaleClient) Patch(ctx context.Context, workload *Workload) error {
+	apply := applyObject(c.gvk, workload)
+	scales := c.scales.Scales(apply.GetNamespace())
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		s, err := scales.Get(ctx, c.resource, apply.GetName(), metav1.GetOptions{})
+		if err != nil || s.Spec.Replicas == workload.Replicas {
+			return err
+		}
+		s.Spec.Replicas = workload.Replicas
+		_, err = scales.Update(ctx, c.resource, s, metav1.UpdateOptions{})
+		if kerrors.IsConflict(err) {
+			patchConflictsTotal.WithLabelValues(c.cluster, apply.GetNamespace(), apply.GetName()).Inc()
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return c.client.Patch(ctx, apply, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// nestedSelector is the metav1.LabelSelector at fields of obj, nil when
+// missing or invalid.
+func nestedSelector(obj *unstructured.Unstructured, fields ...string) labels.Selector {
+	raw, found, err := unstructured.NestedMap(obj.Object, fields...)
+	if err != nil || !found {
+		return nil
+	}
+	labelSelector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, labelSelector); err != nil {
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil
+	}
+	return selector
+}
+
+func nestedInt32(obj *unstructured.Unstructured, fields ...string) (int32, bool) {
+	value, found, err := unstructured.NestedInt64(obj.Object, fields...)
+	if err != nil || !found {
+		return 0, false
+	}
+	return int32(value), true
+}